@@ -7,6 +7,34 @@ import (
 
 type AstNode int
 
+// Span is the part of the source a node was parsed from, it is the zero value for nodes made by the evaluator
+type Span struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+func (s Span) NodeSpan() Span {
+	return s
+}
+
+func (s *Span) SetSpan(span Span) {
+	*s = span
+}
+
+// Spanned is implemented by every node through its embedded Span
+type Spanned interface {
+	NodeSpan() Span
+	SetSpan(span Span)
+}
+
+// SpanOf returns the span of n, or the zero Span if n doesn't carry one
+func SpanOf(n Node) Span {
+	if s, ok := n.(Spanned); ok {
+		return s.NodeSpan()
+	}
+	return Span{}
+}
+
 type Node interface {
 	NodeType() AstNode
 	String() string
@@ -26,6 +54,8 @@ const (
 	ReferenceExpr
 	VarReassign
 	ArrReassign
+	CompoundAssign
+	FieldReassign
 
 	//Exprs
 	InfixExpr
@@ -34,6 +64,8 @@ const (
 	EmptyExpr
 	ReturnExpr
 	ArrRef
+	FieldAccess
+	MethodCall
 
 	//Datatypes
 	IntLiteral
@@ -41,6 +73,9 @@ const (
 	StringLiteral
 	FloatLiteral
 	ArrLiteral
+	NullLiteral
+	StructLiteral
+	Module
 
 	//Statements
 	IfStmt
@@ -50,10 +85,15 @@ const (
 	CallBuiltin
 	ContinueStmt
 	BreakSmt
+	StructDec
+	ImportStmt
+	ExportStmt
 )
 
 func (n AstNode) String() string {
 	switch n {
+	case Program:
+		return "PROGRAM"
 	case LetStmt:
 		return "LET_STMT"
 	case InfixExpr:
@@ -92,19 +132,41 @@ func (n AstNode) String() string {
 		return "FLOAT_LITERAL"
 	case ArrLiteral:
 		return "ARR_LITERAL"
+	case NullLiteral:
+		return "NULL_LITERAL"
 	case ArrRef:
 		return "ARR_REF"
 	case ArrReassign:
 		return "ARR_REASSIGN"
+	case CompoundAssign:
+		return "COMPOUND_ASSIGN"
+	case FieldReassign:
+		return "FIELD_REASSIGN"
+	case FieldAccess:
+		return "FIELD_ACCESS"
+	case MethodCall:
+		return "METHOD_CALL"
+	case StructLiteral:
+		return "STRUCT_LITERAL"
+	case StructDec:
+		return "STRUCT_DEC"
+	case Module:
+		return "MODULE"
+	case ImportStmt:
+		return "IMPORT_STMT"
+	case ExportStmt:
+		return "EXPORT_STMT"
 	default:
 		return "ILLEGAL"
 	}
 }
 
-// Let Expression
+// Let Expression, Const is set for const declarations which can't be reassigned
 type LetStmtNode struct {
+	Span
 	Name  string
 	Value Node
+	Const bool
 }
 
 func (n *LetStmtNode) NodeType() AstNode {
@@ -112,11 +174,15 @@ func (n *LetStmtNode) NodeType() AstNode {
 }
 
 func (n *LetStmtNode) String() string {
+	if n.Const {
+		return fmt.Sprintf("const %v = %v", n.Name, n.Value)
+	}
 	return fmt.Sprintf("let %v = %v", n.Name, n.Value)
 }
 
 // Infix Expression
 type InfixExprNode struct {
+	Span
 	Left     Node
 	Operator token.TokenType
 	Right    Node
@@ -132,6 +198,7 @@ func (n *InfixExprNode) String() string {
 
 // Integer Literal
 type IntLiteralNode struct {
+	Span
 	Value int
 }
 
@@ -145,6 +212,7 @@ func (n *IntLiteralNode) String() string {
 
 // Variable Reference
 type ReferenceExprNode struct {
+	Span
 	Name string
 }
 
@@ -157,6 +225,7 @@ func (n *ReferenceExprNode) String() string {
 func (n *ReferenceExprNode) isBool() {}
 
 type VarReassignNode struct {
+	Span
 	Var    ReferenceExprNode
 	NewVal Node
 }
@@ -166,11 +235,12 @@ func (n *VarReassignNode) NodeType() AstNode {
 }
 
 func (n *VarReassignNode) String() string {
-	return fmt.Sprintf("REASSIGN(%v) = %v", n.Var, n.NewVal)
+	return fmt.Sprintf("REASSIGN(%v) = %v", n.Var.Name, n.NewVal)
 }
 
 // Program
 type ProgramNode struct {
+	Span
 	Statements []Node
 }
 
@@ -189,6 +259,7 @@ func (n *ProgramNode) String() string {
 
 // Bool literal
 type BoolLiteralNode struct {
+	Span
 	Value bool
 }
 
@@ -206,6 +277,7 @@ func (n *BoolLiteralNode) String() string {
 func (n *BoolLiteralNode) isBool() {}
 
 type BoolInfixNode struct {
+	Span
 	Left     Node
 	Operator token.TokenType
 	Right    Node
@@ -220,6 +292,7 @@ func (n *BoolInfixNode) String() string {
 func (n *BoolInfixNode) isBool() {}
 
 type PrefixExprNode struct {
+	Span
 	Value    Node
 	Operator token.TokenType
 }
@@ -233,9 +306,12 @@ func (n *PrefixExprNode) String() string {
 func (n *PrefixExprNode) isBool() {}
 
 type IfStmtNode struct {
+	Span
 	Cond Bool
 	Body []Node
 	Alt  []Node
+	// Where the else keyword is, zero when there is no else
+	Else token.Position
 }
 
 func (n *IfStmtNode) NodeType() AstNode {
@@ -259,6 +335,7 @@ func (n *IfStmtNode) String() string {
 }
 
 type EmptyExprNode struct {
+	Span
 	Child Node
 }
 
@@ -270,6 +347,7 @@ func (n *EmptyExprNode) String() string {
 }
 
 type ReturnExprNode struct {
+	Span
 	Val Node
 }
 
@@ -281,10 +359,13 @@ func (n *ReturnExprNode) String() string {
 }
 
 type FuncDecNode struct {
+	Span
 	Name   string
 	Params []ReferenceExprNode
 	Body   []Node
 	Return ReturnExprNode
+	// How many of the last params can be left out, they are null when they are. Only builtins have any
+	Optional int
 }
 
 func (n *FuncDecNode) NodeType() AstNode {
@@ -310,6 +391,7 @@ func (n *FuncDecNode) String() string {
 }
 
 type FuncCallNode struct {
+	Span
 	Name   ReferenceExprNode
 	Params []Node
 }
@@ -322,6 +404,7 @@ func (n *FuncCallNode) String() string {
 }
 
 type StringLiteralNode struct {
+	Span
 	Value string
 }
 
@@ -333,6 +416,7 @@ func (n *StringLiteralNode) String() string {
 }
 
 type CallBuiltinNode struct {
+	Span
 	Name   string
 	Params []Node
 }
@@ -345,6 +429,7 @@ func (n *CallBuiltinNode) String() string {
 }
 
 type WhileStmtNode struct {
+	Span
 	Cond Bool
 	Body []Node
 }
@@ -361,7 +446,9 @@ func (n *WhileStmtNode) String() string {
 	return str
 }
 
-type BreakStmtNode struct{}
+type BreakStmtNode struct {
+	Span
+}
 
 func (n *BreakStmtNode) NodeType() AstNode {
 	return BreakSmt
@@ -370,7 +457,9 @@ func (n *BreakStmtNode) String() string {
 	return "BREAK"
 }
 
-type ContinueStmtNode struct{}
+type ContinueStmtNode struct {
+	Span
+}
 
 func (n *ContinueStmtNode) NodeType() AstNode {
 	return ContinueStmt
@@ -380,6 +469,7 @@ func (n *ContinueStmtNode) String() string {
 }
 
 type FloatLiteralNode struct {
+	Span
 	Value float64
 }
 
@@ -390,8 +480,21 @@ func (n *FloatLiteralNode) String() string {
 	return fmt.Sprintf("FLOAT(%g)", n.Value)
 }
 
+// The null value, also what a function without a return statement evaluates to
+type NullLiteralNode struct {
+	Span
+}
+
+func (n *NullLiteralNode) NodeType() AstNode {
+	return NullLiteral
+}
+func (n *NullLiteralNode) String() string {
+	return "NULL"
+}
+
 // Arrays are hashmaps under the hood arr["hi"] = true is totally valid
 type ArrLiteralNode struct {
+	Span
 	Elems map[string]Node
 }
 
@@ -400,8 +503,8 @@ func (n *ArrLiteralNode) NodeType() AstNode {
 }
 func (n *ArrLiteralNode) String() string {
 	str := "["
-	for key, val := range n.Elems {
-		str += fmt.Sprintf("{%v : %v},", key, val)
+	for _, key := range ElemKeys(n) {
+		str += fmt.Sprintf("{%v : %v},", key, n.Elems[key])
 	}
 	str = str[:len(str)-1]
 	str += "]"
@@ -409,6 +512,7 @@ func (n *ArrLiteralNode) String() string {
 }
 
 type ArrRefNode struct {
+	Span
 	Arr ReferenceExprNode
 	Idx Node
 }
@@ -417,10 +521,11 @@ func (n *ArrRefNode) NodeType() AstNode {
 	return ArrRef
 }
 func (n *ArrRefNode) String() string {
-	return fmt.Sprintf("%v[%v]", n.Arr, n.Idx)
+	return fmt.Sprintf("%v[%v]", n.Arr.Name, n.Idx)
 }
 
 type ArrReassignNode struct {
+	Span
 	Arr    ReferenceExprNode
 	Idx    Node
 	NewVal Node
@@ -430,5 +535,191 @@ func (n *ArrReassignNode) NodeType() AstNode {
 	return ArrReassign
 }
 func (n *ArrReassignNode) String() string {
-	return fmt.Sprintf("%v[%v] = %v", n.Arr, n.Idx, n.NewVal)
+	return fmt.Sprintf("%v[%v] = %v", n.Arr.Name, n.Idx, n.NewVal)
+}
+
+// Compound assignment like x += 1 or arr[i]++, Target is a ReferenceExprNode or an ArrRefNode
+// and Operator is the arithmetic operator applied between the old value and Value
+type CompoundAssignNode struct {
+	Span
+	Target   Node
+	Operator token.TokenType
+	Value    Node
+	// Set for x++ and x-- so tools can tell them apart from x += 1
+	Postfix bool
+}
+
+func (n *CompoundAssignNode) NodeType() AstNode {
+	return CompoundAssign
+}
+func (n *CompoundAssignNode) String() string {
+	op := n.Operator.String()
+	// The token names of these aren't the symbols they are written with
+	switch n.Operator {
+	case token.MODULO:
+		op = "%"
+	case token.EXPONENT:
+		op = "**"
+	}
+	return fmt.Sprintf("%v %v= %v", n.Target, op, n.Value)
+}
+
+// struct Point { x, y fn sum(){ return self.x + self.y; } }
+type StructDecNode struct {
+	Span
+	Name    string
+	Fields  []string
+	Methods []FuncDecNode
+}
+
+func (n *StructDecNode) NodeType() AstNode {
+	return StructDec
+}
+func (n *StructDecNode) String() string {
+	str := fmt.Sprintf("struct %v {\n", n.Name)
+	for _, field := range n.Fields {
+		str += fmt.Sprintf("\t%v\n", field)
+	}
+	for _, method := range n.Methods {
+		str += fmt.Sprintf("\t%v", method.String())
+	}
+	str += "}"
+	return str
+}
+
+func (n *StructDecNode) HasField(name string) bool {
+	for _, field := range n.Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *StructDecNode) GetMethod(name string) (FuncDecNode, bool) {
+	for _, method := range n.Methods {
+		if method.Name == name {
+			return method, true
+		}
+	}
+	return FuncDecNode{}, false
+}
+
+type StructField struct {
+	Name  string
+	Value Node
+}
+
+// Point{x: 1, y: 2}, also used as the value of a struct instance at runtime with fields in declaration order
+type StructLiteralNode struct {
+	Span
+	Name   string
+	Fields []StructField
+}
+
+func (n *StructLiteralNode) NodeType() AstNode {
+	return StructLiteral
+}
+func (n *StructLiteralNode) String() string {
+	str := n.Name + "{"
+	for i, field := range n.Fields {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v: %v", field.Name, field.Value)
+	}
+	str += "}"
+	return str
+}
+
+// Returns the field named name and whether it exists
+func (n *StructLiteralNode) GetField(name string) (Node, bool) {
+	for _, field := range n.Fields {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Sets an existing field, returns false if the struct has no field called name
+func (n *StructLiteralNode) SetField(name string, val Node) bool {
+	for i, field := range n.Fields {
+		if field.Name == name {
+			n.Fields[i].Value = val
+			return true
+		}
+	}
+	return false
+}
+
+// p.x
+type FieldAccessNode struct {
+	Span
+	Obj   Node
+	Field string
+}
+
+func (n *FieldAccessNode) NodeType() AstNode {
+	return FieldAccess
+}
+func (n *FieldAccessNode) String() string {
+	return fmt.Sprintf("%v.%v", n.Obj, n.Field)
+}
+
+// p.x = 3
+type FieldReassignNode struct {
+	Span
+	Obj    Node
+	Field  string
+	NewVal Node
+}
+
+func (n *FieldReassignNode) NodeType() AstNode {
+	return FieldReassign
+}
+func (n *FieldReassignNode) String() string {
+	return fmt.Sprintf("%v.%v = %v", n.Obj, n.Field, n.NewVal)
+}
+
+// p.sum(1, 2)
+type MethodCallNode struct {
+	Span
+	Obj    Node
+	Name   string
+	Params []Node
+}
+
+func (n *MethodCallNode) NodeType() AstNode {
+	return MethodCall
+}
+func (n *MethodCallNode) String() string {
+	return fmt.Sprintf("%v.%v(%+v)", n.Obj, n.Name, n.Params)
+}
+
+// import "lib/math.toy" as m;
+type ImportStmtNode struct {
+	Span
+	Path  string
+	Alias string
+}
+
+func (n *ImportStmtNode) NodeType() AstNode {
+	return ImportStmt
+}
+func (n *ImportStmtNode) String() string {
+	return fmt.Sprintf("import %q as %v", n.Path, n.Alias)
+}
+
+// export fn f(){...} or export const x = 1;
+type ExportStmtNode struct {
+	Span
+	Stmt Node
+}
+
+func (n *ExportStmtNode) NodeType() AstNode {
+	return ExportStmt
+}
+func (n *ExportStmtNode) String() string {
+	return fmt.Sprintf("export %v", n.Stmt)
 }
@@ -0,0 +1,312 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"toy_lang/ast"
+	"toy_lang/lexer"
+	"toy_lang/parser"
+	"toy_lang/token"
+)
+
+func parse(src string) *ast.ProgramNode {
+	program := parser.NewParser().Parse(lexer.NewLexer().Lex(src))
+	return &program
+}
+
+// Uses every kind of node the parser makes
+const everything = `import "lib.toy" as lib;
+export const c = 1;
+let x = -(2 + 3) * 4;
+x = x % 2;
+x += 1;
+let s = "hi";
+let f = 1.5;
+let n = null;
+let arr = [1, true, s];
+arr[0] = arr[1];
+struct P {
+    x
+    fn get() { return self.x; }
+}
+let p = P{x: 1};
+p.x = p.get();
+fn add(a, b) { return a + b; }
+while !false {
+    if x > 0 && x != 2 {
+        break;
+    } else {
+        continue;
+    }
+}
+println(add(p.x, lib.y));
+`
+
+func TestInspect(t *testing.T) {
+	program := parse(everything)
+	seen := make(map[ast.AstNode]int)
+	ast.Inspect(program, func(n ast.Node) bool {
+		seen[n.NodeType()]++
+		return true
+	})
+
+	kinds := []ast.AstNode{
+		ast.Program, ast.LetStmt, ast.ReferenceExpr, ast.VarReassign, ast.ArrReassign, ast.CompoundAssign,
+		ast.FieldReassign, ast.InfixExpr, ast.BoolInfix, ast.PrefixExpr, ast.EmptyExpr, ast.ReturnExpr, ast.ArrRef,
+		ast.FieldAccess, ast.MethodCall, ast.IntLiteral, ast.BoolLiteral, ast.StringLiteral, ast.FloatLiteral,
+		ast.ArrLiteral, ast.NullLiteral, ast.StructLiteral, ast.IfStmt, ast.WhileStmt, ast.FuncDec, ast.FuncCall,
+		ast.ContinueStmt, ast.BreakSmt, ast.StructDec, ast.ImportStmt, ast.ExportStmt,
+	}
+	for _, kind := range kinds {
+		if seen[kind] == 0 {
+			t.Errorf("[FAILURE] Inspect never reached a %v node", kind)
+		}
+	}
+	if !t.Failed() {
+		fmt.Println("\033[32m[PASS] Test number 1 has passed\033[0m")
+	}
+
+	// Returning false skips the children of a node
+	count := 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		count++
+		return n.NodeType() == ast.Program
+	})
+	if count != len(program.Statements)+1 {
+		t.Errorf("[FAILURE] Expected to only visit the program and its statements, visited %d nodes", count)
+	} else {
+		fmt.Println("\033[32m[PASS] Test number 2 has passed\033[0m")
+	}
+}
+
+type depthVisitor struct {
+	depth *int
+	max   *int
+	out   *strings.Builder
+}
+
+func (v depthVisitor) Visit(n ast.Node) ast.Visitor {
+	if n == nil {
+		*v.depth--
+		return nil
+	}
+	*v.depth++
+	if *v.depth > *v.max {
+		*v.max = *v.depth
+	}
+	fmt.Fprintf(v.out, "%v ", n.NodeType())
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	depth, max := 0, 0
+	out := &strings.Builder{}
+	ast.Walk(depthVisitor{&depth, &max, out}, parse("if a { b = [c]; }"))
+	want := "PROGRAM IF_STMT BOOL_INFIX REF_EXPR BOOL_LITERAL VAR_REASSIGN REF_EXPR ARR_LITERAL REF_EXPR "
+	if out.String() != want || depth != 0 || max != 5 {
+		t.Errorf("[FAILURE] Walk visited %q with depth %d and max depth %d", out.String(), depth, max)
+	} else {
+		fmt.Println("\033[32m[PASS] Test number 1 has passed\033[0m")
+	}
+}
+
+// Walking doesn't write to the tree, so the language server can inspect a document from several requests at once
+func TestInspectConcurrent(t *testing.T) {
+	program := parse("fn f(a){ a = a[0]; if a { return f(a); } } struct P { x fn m(){ return self.x; } }")
+	count := func() int {
+		n := 0
+		ast.Inspect(program, func(ast.Node) bool {
+			n++
+			return true
+		})
+		return n
+	}
+	want := count()
+	counts := make(chan int, 8)
+	for range 8 {
+		go func() { counts <- count() }()
+	}
+	for range 8 {
+		if got := <-counts; got != want {
+			t.Fatalf("[FAILURE] Inspect visited %d nodes, want %d", got, want)
+		}
+	}
+	fmt.Println("\033[32m[PASS] Test number 1 has passed\033[0m")
+}
+
+func TestRewrite(t *testing.T) {
+	// Folds additions of integer literals
+	fold := func(n ast.Node) ast.Node {
+		if paren, ok := n.(*ast.EmptyExprNode); ok {
+			if lit, ok := paren.Child.(*ast.IntLiteralNode); ok {
+				return lit
+			}
+		}
+		infix, ok := n.(*ast.InfixExprNode)
+		if !ok || infix.Operator != token.PLUS {
+			return n
+		}
+		left, lok := infix.Left.(*ast.IntLiteralNode)
+		right, rok := infix.Right.(*ast.IntLiteralNode)
+		if !lok || !rok {
+			return n
+		}
+		return &ast.IntLiteralNode{Value: left.Value + right.Value}
+	}
+	rename := func(n ast.Node) ast.Node {
+		if ref, ok := n.(*ast.ReferenceExprNode); ok && ref.Name == "old" {
+			return &ast.ReferenceExprNode{Name: "new"}
+		}
+		return n
+	}
+
+	tests := []struct {
+		input  string
+		f      func(ast.Node) ast.Node
+		output string
+		id     int
+	}{
+		{
+			input:  "let x = (1 + 2) + 3; fn f() { return 4 + 5; }",
+			f:      fold,
+			output: "let x = INT(6)|fn f() {\n\treturn INT(9)\n}\n",
+			id:     1,
+		},
+		{
+			input:  "fn old(old) { old = old + 1; } old(old); let a = [old]; a[old] = old;",
+			f:      rename,
+			output: "fn old(REFERENCE(new)) {\n\tREASSIGN(new) = (REFERENCE(new) + INT(1))\n}\n|new([REFERENCE(new)])|let a = [{INT(0) : REFERENCE(new)}]|a[REFERENCE(new)] = REFERENCE(new)",
+			id:     2,
+		},
+		{
+			input:  "while old { if old { old += 1; } }",
+			f:      rename,
+			output: "while (REFERENCE(new) || BOOL(false)) {\n\tif (REFERENCE(new) || BOOL(false)) {\n\tREFERENCE(new) += INT(1)\n}\n}",
+			id:     3,
+		},
+	}
+
+	for _, tt := range tests {
+		program := ast.Rewrite(parse(tt.input), tt.f).(*ast.ProgramNode)
+		var strs []string
+		for _, stmt := range program.Statements {
+			if paren, ok := stmt.(*ast.EmptyExprNode); ok {
+				stmt = paren.Child
+			}
+			strs = append(strs, stmt.String())
+		}
+		got := strings.Join(strs, "|")
+		if got != tt.output {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %q\nWant: %q\n", tt.id, got, tt.output)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("[FAILURE] Replacing a condition with a non boolean should panic")
+			} else {
+				fmt.Println("\033[32m[PASS] Test number 4 has passed\033[0m")
+			}
+		}()
+		ast.Rewrite(parse("if a > b { }"), func(n ast.Node) ast.Node {
+			if n.NodeType() == ast.BoolInfix {
+				return &ast.IntLiteralNode{Value: 1}
+			}
+			return n
+		})
+	}()
+}
+
+func TestCompoundAssignString(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+		id     int
+	}{
+		{input: "x += 1;", output: "REFERENCE(x) += INT(1)", id: 1},
+		{input: "x -= 1;", output: "REFERENCE(x) -= INT(1)", id: 2},
+		{input: "x *= 2;", output: "REFERENCE(x) *= INT(2)", id: 3},
+		{input: "x /= 2;", output: "REFERENCE(x) /= INT(2)", id: 4},
+		{input: "x %= 2;", output: "REFERENCE(x) %= INT(2)", id: 5},
+		{input: "a[0] **= 2;", output: "a[INT(0)] **= INT(2)", id: 6},
+		{input: "x++;", output: "REFERENCE(x) += INT(1)", id: 7},
+	}
+
+	for _, tt := range tests {
+		got := parse(tt.input).Statements[0].String()
+		if got != tt.output {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %q\nWant: %q\n", tt.id, got, tt.output)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	program := parse(everything)
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("[FAILURE] EncodeJSON failed: %v", err)
+	}
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("[FAILURE] DecodeJSON failed: %v", err)
+	}
+	again, err := ast.EncodeJSON(decoded)
+	if err != nil {
+		t.Fatalf("[FAILURE] EncodeJSON of the decoded tree failed: %v", err)
+	}
+	if string(again) != string(data) || decoded.String() != program.String() {
+		t.Errorf("[FAILURE] Round trip changed the tree\nFirst: %s\nSecond: %s\n", data, again)
+	} else {
+		fmt.Println("\033[32m[PASS] Test number 1 has passed\033[0m")
+	}
+
+	// Positions survive the round trip
+	var before, after []ast.Span
+	ast.Inspect(program, func(n ast.Node) bool {
+		before = append(before, ast.SpanOf(n))
+		return true
+	})
+	ast.Inspect(decoded, func(n ast.Node) bool {
+		after = append(after, ast.SpanOf(n))
+		return true
+	})
+	if fmt.Sprint(before) != fmt.Sprint(after) {
+		t.Errorf("[FAILURE] Spans changed in the round trip\nBefore: %v\nAfter: %v\n", before, after)
+	} else {
+		fmt.Println("\033[32m[PASS] Test number 2 has passed\033[0m")
+	}
+
+	data, _ = ast.EncodeJSON(parse("let x = 1 + 2;").Statements[0])
+	want := `{"const":false,"kind":"LET_STMT","name":"x","span":{"start":{"line":1,"col":1},"end":{"line":1,"col":13}},` +
+		`"value":{"kind":"INFIX_EXPR","left":{"kind":"INTEGER_LITERAL","span":{"start":{"line":1,"col":9},"end":{"line":1,"col":9}},"value":1},` +
+		`"operator":"+","right":{"kind":"INTEGER_LITERAL","span":{"start":{"line":1,"col":13},"end":{"line":1,"col":13}},"value":2},` +
+		`"span":{"start":{"line":1,"col":9},"end":{"line":1,"col":13}}}}`
+	if string(data) != want {
+		t.Errorf("[FAILURE] Unexpected JSON\nGot: %s\nWant: %s\n", data, want)
+	} else {
+		fmt.Println("\033[32m[PASS] Test number 3 has passed\033[0m")
+	}
+
+	errs := []struct {
+		input string
+		err   string
+	}{
+		{`{"kind": "NOPE"}`, `[ERROR] Unknown node kind "NOPE"`},
+		{`{"kind": "LET_STMT", "value": null}`, `[ERROR] JSON node is missing "name"`},
+		{`{"kind": "IF_STMT", "cond": {"kind": "INTEGER_LITERAL", "value": 1}, "body": [], "alt": []}`, `[ERROR] "cond" in JSON node must be a boolean expression`},
+		{`[]`, `[ERROR] JSON node must be an object: json: cannot unmarshal array into Go value of type ast.rawObj`},
+	}
+	for i, tt := range errs {
+		if _, err := ast.DecodeJSON([]byte(tt.input)); err == nil || err.Error() != tt.err {
+			t.Errorf("[FAILURE] Decoding %s\nGot: %v\nWant: %v\n", tt.input, err, tt.err)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", i+4)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"toy_lang/token"
+)
+
+// EncodeJSON writes a node and everything under it as JSON. Every node is an object with a "kind" (the
+// AstNode name like LET_STMT), a "span" when it has a position, and its fields with child nodes nested as
+// objects, like {"kind": "LET_STMT", "name": "x", "const": false, "value": {"kind": "INTEGER_LITERAL", "value": 1}}
+func EncodeJSON(n Node) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return json.Marshal(encodeNode(n))
+}
+
+// DecodeJSON reads a node written by EncodeJSON
+func DecodeJSON(data []byte) (n Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			n, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return decodeNode(data), nil
+}
+
+type jsonObj map[string]any
+
+func encodeNode(n Node) jsonObj {
+	if n == nil {
+		return nil
+	}
+	obj := jsonObj{"kind": n.NodeType().String()}
+	if span := SpanOf(n); span != (Span{}) {
+		obj["span"] = span
+	}
+
+	switch n := n.(type) {
+	case *ProgramNode:
+		obj["statements"] = encodeList(n.Statements)
+	case *LetStmtNode:
+		obj["name"] = n.Name
+		obj["const"] = n.Const
+		obj["value"] = encodeNode(n.Value)
+	case *ReferenceExprNode:
+		obj["name"] = n.Name
+	case *VarReassignNode:
+		obj["var"] = encodeNode(&n.Var)
+		obj["newVal"] = encodeNode(n.NewVal)
+	case *ArrReassignNode:
+		obj["arr"] = encodeNode(&n.Arr)
+		obj["idx"] = encodeNode(n.Idx)
+		obj["newVal"] = encodeNode(n.NewVal)
+	case *CompoundAssignNode:
+		obj["target"] = encodeNode(n.Target)
+		obj["operator"] = n.Operator
+		obj["value"] = encodeNode(n.Value)
+		obj["postfix"] = n.Postfix
+	case *FieldReassignNode:
+		obj["obj"] = encodeNode(n.Obj)
+		obj["field"] = n.Field
+		obj["newVal"] = encodeNode(n.NewVal)
+	case *InfixExprNode:
+		obj["left"] = encodeNode(n.Left)
+		obj["operator"] = n.Operator
+		obj["right"] = encodeNode(n.Right)
+	case *BoolInfixNode:
+		obj["left"] = encodeNode(n.Left)
+		obj["operator"] = n.Operator
+		obj["right"] = encodeNode(n.Right)
+	case *PrefixExprNode:
+		obj["operator"] = n.Operator
+		obj["value"] = encodeNode(n.Value)
+	case *EmptyExprNode:
+		obj["child"] = encodeNode(n.Child)
+	case *ReturnExprNode:
+		if n.Val != nil {
+			obj["val"] = encodeNode(n.Val)
+		}
+	case *ArrRefNode:
+		obj["arr"] = encodeNode(&n.Arr)
+		obj["idx"] = encodeNode(n.Idx)
+	case *FieldAccessNode:
+		obj["obj"] = encodeNode(n.Obj)
+		obj["field"] = n.Field
+	case *MethodCallNode:
+		obj["obj"] = encodeNode(n.Obj)
+		obj["name"] = n.Name
+		obj["params"] = encodeList(n.Params)
+	case *IntLiteralNode:
+		obj["value"] = n.Value
+	case *BoolLiteralNode:
+		obj["value"] = n.Value
+	case *StringLiteralNode:
+		obj["value"] = n.Value
+	case *FloatLiteralNode:
+		obj["value"] = n.Value
+	case *NullLiteralNode:
+	case *ArrLiteralNode:
+		elems := []jsonObj{}
+		for _, key := range ElemKeys(n) {
+			elems = append(elems, jsonObj{"key": key, "value": encodeNode(n.Elems[key])})
+		}
+		obj["elems"] = elems
+	case *StructLiteralNode:
+		fields := []jsonObj{}
+		for _, field := range n.Fields {
+			fields = append(fields, jsonObj{"name": field.Name, "value": encodeNode(field.Value)})
+		}
+		obj["name"] = n.Name
+		obj["fields"] = fields
+	case *IfStmtNode:
+		obj["cond"] = encodeNode(n.Cond)
+		obj["body"] = encodeList(n.Body)
+		obj["alt"] = encodeList(n.Alt)
+	case *WhileStmtNode:
+		obj["cond"] = encodeNode(n.Cond)
+		obj["body"] = encodeList(n.Body)
+	case *FuncDecNode:
+		params := []jsonObj{}
+		for i := range n.Params {
+			params = append(params, encodeNode(&n.Params[i]))
+		}
+		obj["name"] = n.Name
+		obj["params"] = params
+		obj["body"] = encodeList(n.Body)
+	case *FuncCallNode:
+		obj["func"] = encodeNode(&n.Name)
+		obj["params"] = encodeList(n.Params)
+	case *CallBuiltinNode:
+		obj["name"] = n.Name
+		obj["params"] = encodeList(n.Params)
+	case *ContinueStmtNode, *BreakStmtNode:
+	case *StructDecNode:
+		methods := []jsonObj{}
+		for i := range n.Methods {
+			methods = append(methods, encodeNode(&n.Methods[i]))
+		}
+		obj["name"] = n.Name
+		obj["fields"] = append([]string{}, n.Fields...)
+		obj["methods"] = methods
+	case *ImportStmtNode:
+		obj["path"] = n.Path
+		obj["alias"] = n.Alias
+	case *ExportStmtNode:
+		obj["stmt"] = encodeNode(n.Stmt)
+	default:
+		panic(fmt.Sprintf("[ERROR] Can't write %v to JSON", n.NodeType()))
+	}
+	return obj
+}
+
+func encodeList(nodes []Node) []jsonObj {
+	list := []jsonObj{}
+	for _, n := range nodes {
+		list = append(list, encodeNode(n))
+	}
+	return list
+}
+
+// Decoding keeps the raw fields of an object so each field can be read as the type its kind needs
+type rawObj map[string]json.RawMessage
+
+func (o rawObj) get(key string, v any) {
+	data, ok := o[key]
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] JSON node is missing %q", key))
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		panic(fmt.Sprintf("[ERROR] Bad %q in JSON node: %v", key, err))
+	}
+}
+
+func (o rawObj) node(key string) Node {
+	data, ok := o[key]
+	if !ok || string(data) == "null" {
+		return nil
+	}
+	return decodeNode(data)
+}
+
+func (o rawObj) nodes(key string) []Node {
+	var raws []json.RawMessage
+	o.get(key, &raws)
+	nodes := []Node{}
+	for _, raw := range raws {
+		nodes = append(nodes, decodeNode(raw))
+	}
+	return nodes
+}
+
+func (o rawObj) ref(key string) ReferenceExprNode {
+	if ref, ok := o.node(key).(*ReferenceExprNode); ok {
+		return *ref
+	}
+	panic(fmt.Sprintf("[ERROR] %q in JSON node must be a %v", key, ReferenceExpr))
+}
+
+func (o rawObj) cond(key string) Bool {
+	if b, ok := o.node(key).(Bool); ok {
+		return b
+	}
+	panic(fmt.Sprintf("[ERROR] %q in JSON node must be a boolean expression", key))
+}
+
+func (o rawObj) operator() token.TokenType {
+	var op token.TokenType
+	o.get("operator", &op)
+	return op
+}
+
+func kindByName(name string) (AstNode, bool) {
+	for kind := Program; kind <= ExportStmt; kind++ {
+		if kind.String() == name {
+			return kind, true
+		}
+	}
+	return 0, false
+}
+
+func decodeNode(data []byte) Node {
+	var o rawObj
+	if err := json.Unmarshal(data, &o); err != nil {
+		panic(fmt.Sprintf("[ERROR] JSON node must be an object: %v", err))
+	}
+	if o == nil {
+		panic("[ERROR] JSON node must be an object, got null")
+	}
+	var name string
+	o.get("kind", &name)
+	kind, ok := kindByName(name)
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] Unknown node kind %q", name))
+	}
+
+	var n Node
+	switch kind {
+	case Program:
+		n = &ProgramNode{Statements: o.nodes("statements")}
+	case LetStmt:
+		node := &LetStmtNode{Value: o.node("value")}
+		o.get("name", &node.Name)
+		o.get("const", &node.Const)
+		n = node
+	case ReferenceExpr:
+		node := &ReferenceExprNode{}
+		o.get("name", &node.Name)
+		n = node
+	case VarReassign:
+		n = &VarReassignNode{Var: o.ref("var"), NewVal: o.node("newVal")}
+	case ArrReassign:
+		n = &ArrReassignNode{Arr: o.ref("arr"), Idx: o.node("idx"), NewVal: o.node("newVal")}
+	case CompoundAssign:
+		node := &CompoundAssignNode{Target: o.node("target"), Operator: o.operator(), Value: o.node("value")}
+		o.get("postfix", &node.Postfix)
+		n = node
+	case FieldReassign:
+		node := &FieldReassignNode{Obj: o.node("obj"), NewVal: o.node("newVal")}
+		o.get("field", &node.Field)
+		n = node
+	case InfixExpr:
+		n = &InfixExprNode{Left: o.node("left"), Operator: o.operator(), Right: o.node("right")}
+	case BoolInfix:
+		n = &BoolInfixNode{Left: o.node("left"), Operator: o.operator(), Right: o.node("right")}
+	case PrefixExpr:
+		n = &PrefixExprNode{Operator: o.operator(), Value: o.node("value")}
+	case EmptyExpr:
+		n = &EmptyExprNode{Child: o.node("child")}
+	case ReturnExpr:
+		n = &ReturnExprNode{Val: o.node("val")}
+	case ArrRef:
+		n = &ArrRefNode{Arr: o.ref("arr"), Idx: o.node("idx")}
+	case FieldAccess:
+		node := &FieldAccessNode{Obj: o.node("obj")}
+		o.get("field", &node.Field)
+		n = node
+	case MethodCall:
+		node := &MethodCallNode{Obj: o.node("obj"), Params: o.nodes("params")}
+		o.get("name", &node.Name)
+		n = node
+	case IntLiteral:
+		node := &IntLiteralNode{}
+		o.get("value", &node.Value)
+		n = node
+	case BoolLiteral:
+		node := &BoolLiteralNode{}
+		o.get("value", &node.Value)
+		n = node
+	case StringLiteral:
+		node := &StringLiteralNode{}
+		o.get("value", &node.Value)
+		n = node
+	case FloatLiteral:
+		node := &FloatLiteralNode{}
+		o.get("value", &node.Value)
+		n = node
+	case NullLiteral:
+		n = &NullLiteralNode{}
+	case ArrLiteral:
+		var elems []rawObj
+		o.get("elems", &elems)
+		node := &ArrLiteralNode{Elems: make(map[string]Node)}
+		for _, elem := range elems {
+			var key string
+			elem.get("key", &key)
+			node.Elems[key] = elem.node("value")
+		}
+		n = node
+	case StructLiteral:
+		var fields []rawObj
+		o.get("fields", &fields)
+		node := &StructLiteralNode{Fields: []StructField{}}
+		o.get("name", &node.Name)
+		for _, field := range fields {
+			f := StructField{Value: field.node("value")}
+			field.get("name", &f.Name)
+			node.Fields = append(node.Fields, f)
+		}
+		n = node
+	case IfStmt:
+		n = &IfStmtNode{Cond: o.cond("cond"), Body: o.nodes("body"), Alt: o.nodes("alt")}
+	case WhileStmt:
+		n = &WhileStmtNode{Cond: o.cond("cond"), Body: o.nodes("body")}
+	case FuncDec:
+		n = decodeFunc(o)
+	case FuncCall:
+		n = &FuncCallNode{Name: o.ref("func"), Params: o.nodes("params")}
+	case CallBuiltin:
+		node := &CallBuiltinNode{Params: o.nodes("params")}
+		o.get("name", &node.Name)
+		n = node
+	case ContinueStmt:
+		n = &ContinueStmtNode{}
+	case BreakSmt:
+		n = &BreakStmtNode{}
+	case StructDec:
+		node := &StructDecNode{Methods: []FuncDecNode{}}
+		o.get("name", &node.Name)
+		o.get("fields", &node.Fields)
+		for _, method := range o.nodes("methods") {
+			f, ok := method.(*FuncDecNode)
+			if !ok {
+				panic(fmt.Sprintf("[ERROR] Methods of %v must be %v nodes", node.Name, FuncDec))
+			}
+			node.Methods = append(node.Methods, *f)
+		}
+		n = node
+	case ImportStmt:
+		node := &ImportStmtNode{}
+		o.get("path", &node.Path)
+		o.get("alias", &node.Alias)
+		n = node
+	case ExportStmt:
+		n = &ExportStmtNode{Stmt: o.node("stmt")}
+	default:
+		panic(fmt.Sprintf("[ERROR] Can't read %v from JSON", kind))
+	}
+
+	if _, ok := o["span"]; ok {
+		var span Span
+		o.get("span", &span)
+		n.(Spanned).SetSpan(span)
+	}
+	return n
+}
+
+func decodeFunc(o rawObj) *FuncDecNode {
+	node := &FuncDecNode{Params: []ReferenceExprNode{}, Body: o.nodes("body")}
+	o.get("name", &node.Name)
+	var params []json.RawMessage
+	o.get("params", &params)
+	for _, raw := range params {
+		ref, ok := decodeNode(raw).(*ReferenceExprNode)
+		if !ok {
+			panic(fmt.Sprintf("[ERROR] Parameters of %v must be %v nodes", node.Name, ReferenceExpr))
+		}
+		node.Params = append(node.Params, *ref)
+	}
+	return node
+}
@@ -0,0 +1,314 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Visitor's Visit is called for every node reached by Walk. If it returns a non nil visitor w, Walk visits the
+// children of node with w and then calls w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth first, parents before children and children in source order
+func Walk(v Visitor, node Node) {
+	if node == nil {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	forEachChild(node, func(child Node) {
+		Walk(v, child)
+	})
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if node != nil && f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect calls f for every node under node in the order Walk visits them, returning false skips the children
+// of a node
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite replaces every node under node, and node itself, with the result of f. Children are rewritten before
+// their parent so f sees the new children. Slots that need a particular node type, like the name of a function
+// call or the condition of an if, panic if f returns something else
+func Rewrite(node Node, f func(Node) Node) Node {
+	if node == nil {
+		return nil
+	}
+	editChildren(node, func(child Node) Node {
+		return Rewrite(child, f)
+	})
+	return f(node)
+}
+
+// Children returns the direct children of node in the order Walk visits them
+func Children(node Node) []Node {
+	var children []Node
+	forEachChild(node, func(child Node) {
+		children = append(children, child)
+	})
+	return children
+}
+
+// Calls f on every non nil child of node without changing it, so trees can be walked from several goroutines
+func forEachChild(node Node, f func(Node)) {
+	list := func(nodes []Node) {
+		for _, child := range nodes {
+			if child != nil {
+				f(child)
+			}
+		}
+	}
+	one := func(child Node) {
+		if child != nil {
+			f(child)
+		}
+	}
+
+	switch n := node.(type) {
+	case *ProgramNode:
+		list(n.Statements)
+	case *LetStmtNode:
+		one(n.Value)
+	case *VarReassignNode:
+		f(&n.Var)
+		one(n.NewVal)
+	case *ArrReassignNode:
+		f(&n.Arr)
+		one(n.Idx)
+		one(n.NewVal)
+	case *CompoundAssignNode:
+		one(n.Target)
+		one(n.Value)
+	case *FieldReassignNode:
+		one(n.Obj)
+		one(n.NewVal)
+	case *InfixExprNode:
+		one(n.Left)
+		one(n.Right)
+	case *BoolInfixNode:
+		one(n.Left)
+		one(n.Right)
+	case *PrefixExprNode:
+		one(n.Value)
+	case *EmptyExprNode:
+		one(n.Child)
+	case *ReturnExprNode:
+		one(n.Val)
+	case *ArrRefNode:
+		f(&n.Arr)
+		one(n.Idx)
+	case *FieldAccessNode:
+		one(n.Obj)
+	case *MethodCallNode:
+		one(n.Obj)
+		list(n.Params)
+	case *ArrLiteralNode:
+		for _, key := range ElemKeys(n) {
+			one(n.Elems[key])
+		}
+	case *StructLiteralNode:
+		for i := range n.Fields {
+			one(n.Fields[i].Value)
+		}
+	case *IfStmtNode:
+		if n.Cond != nil {
+			f(n.Cond)
+		}
+		list(n.Body)
+		list(n.Alt)
+	case *WhileStmtNode:
+		if n.Cond != nil {
+			f(n.Cond)
+		}
+		list(n.Body)
+	case *FuncDecNode:
+		for i := range n.Params {
+			f(&n.Params[i])
+		}
+		list(n.Body)
+		if n.Return.Val != nil {
+			f(&n.Return)
+		}
+	case *FuncCallNode:
+		f(&n.Name)
+		list(n.Params)
+	case *CallBuiltinNode:
+		list(n.Params)
+	case *StructDecNode:
+		for i := range n.Methods {
+			f(&n.Methods[i])
+		}
+	case *ExportStmtNode:
+		one(n.Stmt)
+	}
+	// Literals, references, break, continue and import have no children
+}
+
+// Calls edit on every non nil child of node and stores the result back in its place, only Rewrite uses it
+// since the stores race with anything else reading the tree. It visits the same children as forEachChild
+func editChildren(node Node, edit func(Node) Node) {
+	list := func(nodes []Node) {
+		for i, child := range nodes {
+			if child != nil {
+				nodes[i] = edit(child)
+			}
+		}
+	}
+	one := func(child Node) Node {
+		if child == nil {
+			return nil
+		}
+		return edit(child)
+	}
+
+	switch n := node.(type) {
+	case *ProgramNode:
+		list(n.Statements)
+	case *LetStmtNode:
+		n.Value = one(n.Value)
+	case *VarReassignNode:
+		n.Var = *asRef(edit(&n.Var), n)
+		n.NewVal = one(n.NewVal)
+	case *ArrReassignNode:
+		n.Arr = *asRef(edit(&n.Arr), n)
+		n.Idx = one(n.Idx)
+		n.NewVal = one(n.NewVal)
+	case *CompoundAssignNode:
+		n.Target = one(n.Target)
+		n.Value = one(n.Value)
+	case *FieldReassignNode:
+		n.Obj = one(n.Obj)
+		n.NewVal = one(n.NewVal)
+	case *InfixExprNode:
+		n.Left = one(n.Left)
+		n.Right = one(n.Right)
+	case *BoolInfixNode:
+		n.Left = one(n.Left)
+		n.Right = one(n.Right)
+	case *PrefixExprNode:
+		n.Value = one(n.Value)
+	case *EmptyExprNode:
+		n.Child = one(n.Child)
+	case *ReturnExprNode:
+		n.Val = one(n.Val)
+	case *ArrRefNode:
+		n.Arr = *asRef(edit(&n.Arr), n)
+		n.Idx = one(n.Idx)
+	case *FieldAccessNode:
+		n.Obj = one(n.Obj)
+	case *MethodCallNode:
+		n.Obj = one(n.Obj)
+		list(n.Params)
+	case *ArrLiteralNode:
+		for _, key := range ElemKeys(n) {
+			n.Elems[key] = one(n.Elems[key])
+		}
+	case *StructLiteralNode:
+		for i := range n.Fields {
+			n.Fields[i].Value = one(n.Fields[i].Value)
+		}
+	case *IfStmtNode:
+		if n.Cond != nil {
+			n.Cond = asBool(edit(n.Cond), n)
+		}
+		list(n.Body)
+		list(n.Alt)
+	case *WhileStmtNode:
+		if n.Cond != nil {
+			n.Cond = asBool(edit(n.Cond), n)
+		}
+		list(n.Body)
+	case *FuncDecNode:
+		for i := range n.Params {
+			n.Params[i] = *asRef(edit(&n.Params[i]), n)
+		}
+		list(n.Body)
+		if n.Return.Val != nil {
+			n.Return = *asReturn(edit(&n.Return), n)
+		}
+	case *FuncCallNode:
+		n.Name = *asRef(edit(&n.Name), n)
+		list(n.Params)
+	case *CallBuiltinNode:
+		list(n.Params)
+	case *StructDecNode:
+		for i := range n.Methods {
+			n.Methods[i] = *asFunc(edit(&n.Methods[i]), n)
+		}
+	case *ExportStmtNode:
+		n.Stmt = one(n.Stmt)
+	}
+	// Literals, references, break, continue and import have no children
+}
+
+// ElemKeys returns the keys of an array literal with integer keys first in numeric order, then the rest sorted
+func ElemKeys(n *ArrLiteralNode) []string {
+	keys := make([]string, 0, len(n.Elems))
+	for key := range n.Elems {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, aInt := intKey(keys[i])
+		b, bInt := intKey(keys[j])
+		if aInt && bInt {
+			return a < b
+		}
+		if aInt != bInt {
+			return aInt
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// Array keys are the String() of the key value, like INT(3)
+func intKey(key string) (int, bool) {
+	if !strings.HasPrefix(key, "INT(") || !strings.HasSuffix(key, ")") {
+		return 0, false
+	}
+	val, err := strconv.Atoi(key[len("INT(") : len(key)-1])
+	return val, err == nil
+}
+
+func asRef(n Node, parent Node) *ReferenceExprNode {
+	if ref, ok := n.(*ReferenceExprNode); ok {
+		return ref
+	}
+	panic(fmt.Sprintf("[ERROR] Rewrite can only replace a name in %v with another name, got %v\n", parent.NodeType(), n))
+}
+
+func asBool(n Node, parent Node) Bool {
+	if b, ok := n.(Bool); ok {
+		return b
+	}
+	panic(fmt.Sprintf("[ERROR] Rewrite can only replace the condition of %v with a boolean expression, got %v\n", parent.NodeType(), n))
+}
+
+func asReturn(n Node, parent Node) *ReturnExprNode {
+	if ret, ok := n.(*ReturnExprNode); ok {
+		return ret
+	}
+	panic(fmt.Sprintf("[ERROR] Rewrite can only replace the return of %v with another return, got %v\n", parent.NodeType(), n))
+}
+
+func asFunc(n Node, parent Node) *FuncDecNode {
+	if f, ok := n.(*FuncDecNode); ok {
+		return f
+	}
+	panic(fmt.Sprintf("[ERROR] Rewrite can only replace a method of %v with another function, got %v\n", parent.NodeType(), n))
+}
@@ -0,0 +1,482 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/dap"
+	"toy_lang/evaluator"
+	"toy_lang/formatter"
+	"toy_lang/internal/wire"
+	"toy_lang/lexer"
+	"toy_lang/lsp"
+	"toy_lang/parser"
+	"toy_lang/resolver"
+	"toy_lang/token"
+)
+
+// Exit codes returned by Run
+const (
+	ExitOK = 0
+	// The program hit a runtime error, a test failed or a file could not be read
+	ExitRuntime = 1
+	ExitUsage   = 2
+	// Lexing, parsing or resolving failed
+	ExitCompile = 3
+)
+
+const usage = `Usage: toy_lang <command> [arguments]
+
+Commands:
+    run [flags] <file> [args...]
+                            run a program, args are available through args().
+                            Flags write to a file, - is stderr:
+                            --trace <out> every statement run, with where it is
+                              and the variables it changed
+                            --trace-format line|json
+                            --profile <out> a pprof profile of the toy code
+                            --profile-report <out> calls, times and line hits
+                            --seed <n> seeds randInt, randf, choice and
+                              shuffle so every run gives the same values
+                            --files <dir> lets readFile, writeFile and the
+                              other file builtins use the files under dir
+                            --max-steps <n> stops the program with an error
+                              after n statements and loop iterations
+    check <files...>        lex, parse and resolve without running
+    debug <file> [args...]  run a program in the terminal debugger
+    fmt [--check] <files...>
+                            print files in the canonical format, --check lists
+                            the files that aren't formatted and exits with 1
+    tokens [--json] <file>  print the tokens of a file
+    ast [--json] <file>     print the parsed tree of a file
+    test [flags] [paths...] run every *_test.toy file under paths (default .),
+                            each fn test_xxx() in a file runs as its own test
+                            --cover prints the statements and if/else
+                            branches that ran in each file, --cover-html <out>
+                            and --cover-lcov <out> also write a report
+    repl                    start an interactive session
+    lsp                     start a language server on stdin and stdout
+    dap                     start a debug adapter on stdin and stdout
+    -e [flags] <code> [args...]
+                            run code given on the command line, with the
+                            flags of run
+    help                    show this message
+
+toy_lang <file> runs a file and toy_lang with no arguments starts the repl.
+Exit codes: 0 ok, 1 runtime error or failing test, 2 bad usage, 3 compile error.
+`
+
+// Run executes the command line args (without the program name) and returns the exit code
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return runRepl(stdin, stdout, stderr)
+	}
+
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return ExitOK
+	case "run":
+		opts, rest, err := runFlags(rest)
+		if err != nil {
+			return usageError(stderr, err.Error())
+		}
+		if len(rest) == 0 {
+			return usageError(stderr, "run needs a file")
+		}
+		return runFile(rest[0], rest[1:], opts, stdin, stdout, stderr)
+	case "-e":
+		opts, rest, err := runFlags(rest)
+		if err != nil {
+			return usageError(stderr, err.Error())
+		}
+		if len(rest) == 0 {
+			return usageError(stderr, "-e needs code to run")
+		}
+		return runSource("<eval>", rest[0], "", rest[1:], opts, stdin, stdout, stderr)
+	case "check":
+		return checkFiles(rest, stderr)
+	case "debug":
+		return debugFile(rest, stdin, stdout, stderr)
+	case "fmt":
+		return fmtFiles(rest, stdout, stderr)
+	case "tokens":
+		return dumpTokens(rest, stdout, stderr)
+	case "ast":
+		return dumpAst(rest, stdout, stderr)
+	case "test":
+		return runTests(rest, stdout, stderr)
+	case "repl":
+		return runRepl(stdin, stdout, stderr)
+	case "lsp":
+		if err := lsp.NewServer(stdin, stdout).Serve(); err != nil {
+			fmt.Fprintf(stderr, "lsp: %v\n", err)
+			return ExitRuntime
+		}
+		return ExitOK
+	case "dap":
+		if err := dap.NewServer(stdin, stdout).Serve(); err != nil {
+			fmt.Fprintf(stderr, "dap: %v\n", err)
+			return ExitRuntime
+		}
+		return ExitOK
+	}
+	if strings.HasSuffix(cmd, ".toy") {
+		return runFile(cmd, rest, runOptions{}, stdin, stdout, stderr)
+	}
+	return usageError(stderr, fmt.Sprintf("unknown command %q", cmd))
+}
+
+func usageError(stderr io.Writer, msg string) int {
+	fmt.Fprintf(stderr, "%v\n\n%v", msg, usage)
+	return ExitUsage
+}
+
+// Lexes, parses and resolves source
+func compile(source string) (program ast.ProgramNode, errs []error) {
+	if msg := wire.Catch(func() { program = parser.NewParser().Parse(lexer.NewLexer().Lex(source)) }); msg != "" {
+		return program, []error{errors.New(msg)}
+	}
+	return program, resolver.NewResolver().Resolve(program)
+}
+
+func execute(in *evaluator.Interpreter, program ast.ProgramNode) error {
+	if msg := wire.Catch(func() { in.Execute(program, false) }); msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func printErrors(stderr io.Writer, name string, errs []error) {
+	for _, err := range errs {
+		fmt.Fprintf(stderr, "%v: %v\n", name, err)
+	}
+}
+
+func readFiles(paths []string, stderr io.Writer) (map[string]string, bool) {
+	sources := make(map[string]string)
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "[ERROR] Could not read %v: %v\n", path, err)
+			return nil, false
+		}
+		sources[path] = string(source)
+	}
+	return sources, true
+}
+
+// Options of run and -e, given before the file or code. Files named "-" are stderr
+type runOptions struct {
+	// File to write a trace of every statement to
+	trace       string
+	traceFormat evaluator.TraceFormat
+	// Files to write a pprof profile and a text report of it to
+	profile       string
+	profileReport string
+	// Seed for the interpreter's random numbers, only used when seeded is set
+	seed   int64
+	seeded bool
+	// Directory the file builtins are given, "" gives them nothing
+	files string
+	// Statements and loop iterations the program may run, 0 means no limit
+	maxSteps int
+}
+
+// Splits the leading --trace <file>, --trace-format line|json, --profile <file>, --profile-report <file>,
+// --seed <n>, --files <dir> and --max-steps <n> flags off args
+func runFlags(args []string) (runOptions, []string, error) {
+	var opts runOptions
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		if len(args) < 2 {
+			return opts, args, fmt.Errorf("%v needs a value", args[0])
+		}
+		switch flag, val := args[0], args[1]; flag {
+		case "--profile":
+			opts.profile = val
+		case "--profile-report":
+			opts.profileReport = val
+		case "--seed":
+			seed, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return opts, args, fmt.Errorf("--seed needs an integer, got %q", val)
+			}
+			opts.seed, opts.seeded = seed, true
+		case "--files":
+			if info, err := os.Stat(val); err != nil || !info.IsDir() {
+				return opts, args, fmt.Errorf("--files needs a directory, got %q", val)
+			}
+			opts.files = val
+		case "--max-steps":
+			steps, err := strconv.Atoi(val)
+			if err != nil || steps <= 0 {
+				return opts, args, fmt.Errorf("--max-steps needs a positive integer, got %q", val)
+			}
+			opts.maxSteps = steps
+		case "--trace":
+			opts.trace = val
+		case "--trace-format":
+			switch val {
+			case "line":
+				opts.traceFormat = evaluator.TraceLines
+			case "json":
+				opts.traceFormat = evaluator.TraceJSON
+			default:
+				return opts, args, fmt.Errorf("unknown trace format %q, expected line or json", val)
+			}
+		default:
+			return opts, args, fmt.Errorf("unknown flag %q", flag)
+		}
+		args = args[2:]
+	}
+	if opts.trace != "" && (opts.profile != "" || opts.profileReport != "") {
+		return opts, args, errors.New("--trace can't be used with --profile, tracing would be in the profile")
+	}
+	return opts, args, nil
+}
+
+func runFile(path string, args []string, opts runOptions, stdin io.Reader, stdout, stderr io.Writer) int {
+	sources, ok := readFiles([]string{path}, stderr)
+	if !ok {
+		return ExitRuntime
+	}
+	return runSource(path, sources[path], path, args, opts, stdin, stdout, stderr)
+}
+
+// Runs source, path is used to resolve imports and can be empty for code that isn't in a file
+func runSource(name, source, path string, args []string, opts runOptions, stdin io.Reader, stdout, stderr io.Writer) int {
+	program, errs := compile(source)
+	if len(errs) > 0 {
+		printErrors(stderr, name, errs)
+		return ExitCompile
+	}
+	in := evaluator.NewInterpreter()
+	in.Out = stdout
+	in.In = stdin
+	in.Args = args
+	if path != "" {
+		in.SetFile(path)
+	}
+	if opts.seeded {
+		in.Seed(opts.seed)
+	}
+	in.MaxSteps = opts.maxSteps
+	if opts.files != "" {
+		in.FS = evaluator.DirFS(opts.files)
+	}
+	if opts.trace != "" {
+		trace, err := openOutput(opts.trace, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "[ERROR] Could not create trace file %v: %v\n", opts.trace, err)
+			return ExitRuntime
+		}
+		tracer := evaluator.NewTracer(trace, opts.traceFormat)
+		in.Hook = tracer
+		defer func() {
+			tracer.Flush()
+			trace.Close()
+		}()
+	}
+	var profiler *evaluator.Profiler
+	if opts.profile != "" || opts.profileReport != "" {
+		profiler = evaluator.NewProfiler()
+		in.Hook = profiler
+	}
+	err := execute(&in, program)
+	// A profile of a program that failed still shows where the time went
+	if profiler != nil && !writeProfile(profiler, opts, stderr) {
+		return ExitRuntime
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%v: %v\n", name, err)
+		return ExitRuntime
+	}
+	return ExitOK
+}
+
+func writeProfile(profiler *evaluator.Profiler, opts runOptions, stderr io.Writer) bool {
+	if opts.profile != "" {
+		out, err := openOutput(opts.profile, stderr)
+		if err == nil {
+			err = profiler.WritePprof(out)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "[ERROR] Could not write profile %v: %v\n", opts.profile, err)
+			return false
+		}
+	}
+	if opts.profileReport != "" {
+		out, err := openOutput(opts.profileReport, stderr)
+		if err == nil {
+			profiler.WriteReport(out)
+			err = out.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "[ERROR] Could not write profile report %v: %v\n", opts.profileReport, err)
+			return false
+		}
+	}
+	return true
+}
+
+// A buffered output file, closing it flushes the buffer
+type outputFile struct {
+	*bufio.Writer
+	file io.Closer
+}
+
+func (t outputFile) Close() error {
+	err := t.Flush()
+	if t.file != nil {
+		if cerr := t.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func openOutput(path string, stderr io.Writer) (io.WriteCloser, error) {
+	if path == "-" {
+		return outputFile{Writer: bufio.NewWriter(stderr)}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return outputFile{Writer: bufio.NewWriter(file), file: file}, nil
+}
+
+func checkFiles(paths []string, stderr io.Writer) int {
+	if len(paths) == 0 {
+		return usageError(stderr, "check needs at least one file")
+	}
+	sources, ok := readFiles(paths, stderr)
+	if !ok {
+		return ExitRuntime
+	}
+	code := ExitOK
+	for _, path := range paths {
+		if _, errs := compile(sources[path]); len(errs) > 0 {
+			printErrors(stderr, path, errs)
+			code = ExitCompile
+		}
+	}
+	return code
+}
+
+// Prints the formatted files, with --check it only lists the files that aren't formatted
+func fmtFiles(args []string, stdout, stderr io.Writer) int {
+	check := len(args) > 0 && args[0] == "--check"
+	paths := args
+	if check {
+		paths = args[1:]
+	}
+	if len(paths) == 0 {
+		return usageError(stderr, "fmt needs at least one file")
+	}
+	sources, ok := readFiles(paths, stderr)
+	if !ok {
+		return ExitRuntime
+	}
+	code := ExitOK
+	for _, path := range paths {
+		formatted, err := formatter.Source(sources[path])
+		if err != nil {
+			printErrors(stderr, path, []error{err})
+			return ExitCompile
+		}
+		if !check {
+			fmt.Fprint(stdout, formatted)
+			continue
+		}
+		if formatted != sources[path] {
+			fmt.Fprintln(stdout, path)
+			code = ExitRuntime
+		}
+	}
+	return code
+}
+
+// Splits a leading --json flag off args
+func jsonFlag(args []string) (bool, []string) {
+	if len(args) > 0 && args[0] == "--json" {
+		return true, args[1:]
+	}
+	return false, args
+}
+
+func printJSON(stdout io.Writer, data []byte) {
+	var out bytes.Buffer
+	json.Indent(&out, data, "", "  ")
+	out.WriteString("\n")
+	out.WriteTo(stdout)
+}
+
+func dumpTokens(args []string, stdout, stderr io.Writer) int {
+	asJSON, paths := jsonFlag(args)
+	if len(paths) != 1 {
+		return usageError(stderr, "tokens needs exactly one file")
+	}
+	sources, ok := readFiles(paths, stderr)
+	if !ok {
+		return ExitRuntime
+	}
+	var toks []token.Token
+	if msg := wire.Catch(func() { toks = lexer.NewLexer().Lex(sources[paths[0]]) }); msg != "" {
+		printErrors(stderr, paths[0], []error{errors.New(msg)})
+		return ExitCompile
+	}
+	if asJSON {
+		data, err := json.Marshal(toks)
+		if err != nil {
+			printErrors(stderr, paths[0], []error{err})
+			return ExitRuntime
+		}
+		printJSON(stdout, data)
+		return ExitOK
+	}
+	for _, tok := range toks {
+		fmt.Fprintf(stdout, "%v %q\n", tok.TokType, tok.Literal)
+	}
+	return ExitOK
+}
+
+func dumpAst(args []string, stdout, stderr io.Writer) int {
+	asJSON, paths := jsonFlag(args)
+	if len(paths) != 1 {
+		return usageError(stderr, "ast needs exactly one file")
+	}
+	sources, ok := readFiles(paths, stderr)
+	if !ok {
+		return ExitRuntime
+	}
+	program, errs := compile(sources[paths[0]])
+	if len(errs) > 0 {
+		printErrors(stderr, paths[0], errs)
+		return ExitCompile
+	}
+	if asJSON {
+		data, err := ast.EncodeJSON(&program)
+		if err != nil {
+			printErrors(stderr, paths[0], []error{err})
+			return ExitRuntime
+		}
+		printJSON(stdout, data)
+		return ExitOK
+	}
+	for _, stmt := range program.Statements {
+		fmt.Fprintln(stdout, stmt)
+	}
+	return ExitOK
+}
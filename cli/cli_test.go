@@ -0,0 +1,550 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"hello.toy":          `let a = args(); println("hello " + a[0]);`,
+		"crash.toy":          `let x = 1 / 0;`,
+		"broken.toy":         `const x = 1; x = 2;`,
+		"messy.toy":          "fn add(a,b){return a+b;}\nlet x=add(1,2);",
+		"small.toy":          "let x = 1;",
+		"tidy.toy":           "let x = 1;\n",
+		"tests/ok_test.toy":  `let x = 1;`,
+		"tests/bad_test.toy": `let x = 1 / 0;`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		args     []string
+		stdin    string
+		code     int
+		want_out string
+		// Substring expected in stderr
+		want_err string
+		id       int
+	}{
+		{
+			args:     []string{"run", file("hello.toy"), "world"},
+			code:     ExitOK,
+			want_out: "hello world\n",
+			id:       1,
+		},
+		{
+			args:     []string{file("hello.toy"), "there"},
+			code:     ExitOK,
+			want_out: "hello there\n",
+			id:       2,
+		},
+		{
+			args:     []string{"-e", `println(1 + 2);`},
+			code:     ExitOK,
+			want_out: "3\n",
+			id:       3,
+		},
+		{
+			args:     []string{"run", file("crash.toy")},
+			code:     ExitRuntime,
+			want_err: "crash.toy",
+			id:       4,
+		},
+		{
+			args:     []string{"check", file("broken.toy")},
+			code:     ExitCompile,
+			want_err: "[ERROR] Cannot reassign constant x",
+			id:       5,
+		},
+		{
+			args: []string{"check", file("messy.toy"), file("small.toy")},
+			code: ExitOK,
+			id:   6,
+		},
+		{
+			args:     []string{"fmt", file("messy.toy")},
+			code:     ExitOK,
+			want_out: "fn add(a, b) {\n    return a + b;\n}\nlet x = add(1, 2);\n",
+			id:       7,
+		},
+		{
+			args:     []string{"fmt", "--check", file("messy.toy"), file("tidy.toy")},
+			code:     ExitRuntime,
+			want_out: file("messy.toy") + "\n",
+			id:       15,
+		},
+		{
+			args: []string{"fmt", "--check", file("tidy.toy")},
+			code: ExitOK,
+			id:   16,
+		},
+		{
+			args:     []string{"tokens", file("small.toy")},
+			code:     ExitOK,
+			want_out: "LET \"let\"\nVAR_NAME \"x\"\nASSIGN \"=\"\nINTEGER \"1\"\nSEMICOLON \";\"\n",
+			id:       8,
+		},
+		{
+			args:     []string{"ast", "--json", file("small.toy")},
+			code:     ExitOK,
+			want_out: "{\n  \"kind\": \"PROGRAM\",\n  \"statements\": [\n    {\n      \"const\": false,\n      \"kind\": \"LET_STMT\",\n      \"name\": \"x\",\n      \"span\": {\n        \"start\": {\n          \"line\": 1,\n          \"col\": 1\n        },\n        \"end\": {\n          \"line\": 1,\n          \"col\": 9\n        }\n      },\n      \"value\": {\n        \"kind\": \"INTEGER_LITERAL\",\n        \"span\": {\n          \"start\": {\n            \"line\": 1,\n            \"col\": 9\n          },\n          \"end\": {\n            \"line\": 1,\n            \"col\": 9\n          }\n        },\n        \"value\": 1\n      }\n    }\n  ]\n}\n",
+			id:       17,
+		},
+		{
+			args:     []string{"tokens", "--json", file("small.toy")},
+			code:     ExitOK,
+			want_out: "[\n  {\n    \"type\": \"LET\",\n    \"literal\": \"let\",\n    \"pos\": {\n      \"line\": 1,\n      \"col\": 1\n    }\n  },\n  {\n    \"type\": \"VAR_NAME\",\n    \"literal\": \"x\",\n    \"pos\": {\n      \"line\": 1,\n      \"col\": 5\n    }\n  },\n  {\n    \"type\": \"ASSIGN\",\n    \"literal\": \"=\",\n    \"pos\": {\n      \"line\": 1,\n      \"col\": 7\n    }\n  },\n  {\n    \"type\": \"INTEGER\",\n    \"literal\": \"1\",\n    \"pos\": {\n      \"line\": 1,\n      \"col\": 9\n    }\n  },\n  {\n    \"type\": \"SEMICOLON\",\n    \"literal\": \";\",\n    \"pos\": {\n      \"line\": 1,\n      \"col\": 10\n    }\n  }\n]\n",
+			id:       18,
+		},
+		{
+			args:     []string{"ast", file("small.toy")},
+			code:     ExitOK,
+			want_out: "let x = INT(1)\n",
+			id:       9,
+		},
+		{
+			args: []string{"test", file("tests")},
+			code: ExitRuntime,
+			id:   10,
+		},
+		{
+			args:     []string{"repl"},
+			stdin:    "let x = 2;\nprintln(x * 3);\nprintln(z);\n",
+			code:     ExitOK,
+			want_out: ">>6\n>>\n",
+			want_err: "repl: ",
+			id:       11,
+		},
+		{
+			args:     []string{"frobnicate"},
+			code:     ExitUsage,
+			want_err: "unknown command \"frobnicate\"",
+			id:       12,
+		},
+		{
+			args:     []string{"run"},
+			code:     ExitUsage,
+			want_err: "run needs a file",
+			id:       13,
+		},
+		{
+			args:     []string{"run", file("nope.toy")},
+			code:     ExitRuntime,
+			want_err: "[ERROR] Could not read",
+			id:       14,
+		},
+		{
+			args:     []string{"-e", "--trace", "-", "let x = 1; x += 1;"},
+			code:     ExitOK,
+			want_err: "1 <eval>:1:1 <main> depth=1 scope=1: let x = 1 => x = 1\n2 <eval>:1:12 <main> depth=1 scope=1: x += 1 => x = 2\n",
+			id:       15,
+		},
+		{
+			args:     []string{"run", "--trace", "-", "--trace-format", "json", file("crash.toy")},
+			code:     ExitRuntime,
+			want_err: `"stmt":"let x = 1 / 0","unfinished":true}`,
+			id:       16,
+		},
+		{
+			args:     []string{"run", "--trace", "-", "--trace-format", "xml", file("small.toy")},
+			code:     ExitUsage,
+			want_err: `unknown trace format "xml"`,
+			id:       17,
+		},
+		{
+			args:     []string{"run", "--trace", filepath.Join(dir, "missing", "trace.log"), file("small.toy")},
+			code:     ExitRuntime,
+			want_err: "[ERROR] Could not create trace file",
+			id:       18,
+		},
+		{
+			args:     []string{"-e", "--profile-report", "-", "fn f() { return 1; } let x = f();"},
+			code:     ExitOK,
+			want_err: "           1  <eval>:1 (f)\n",
+			id:       19,
+		},
+		{
+			args:     []string{"run", "--profile", file("out.pprof"), "--profile-report", "-", file("crash.toy")},
+			code:     ExitRuntime,
+			want_err: "Functions by exclusive time:",
+			id:       20,
+		},
+		{
+			args:     []string{"run", "--profile", "-", "--trace", "-", file("small.toy")},
+			code:     ExitUsage,
+			want_err: "--trace can't be used with --profile",
+			id:       21,
+		},
+		{
+			args:     []string{"run", "--fast", "yes", file("small.toy")},
+			code:     ExitUsage,
+			want_err: `unknown flag "--fast"`,
+			id:       22,
+		},
+		{
+			args:     []string{"-e", "--seed", "3", `println(randInt(1, 1000)); println(choice(["a", "b", "c"]));`},
+			code:     ExitOK,
+			want_out: "9\nc\n",
+			id:       23,
+		},
+		{
+			args:     []string{"-e", "--seed", "x", "let x = 1;"},
+			code:     ExitUsage,
+			want_err: `--seed needs an integer, got "x"`,
+			id:       24,
+		},
+		{
+			args:     []string{"-e", "--files", filepath.Join(dir, "tests"), `println(readFile("ok_test.toy"));`},
+			code:     ExitOK,
+			want_out: "let x = 1;\n",
+			id:       25,
+		},
+		{
+			args:     []string{"-e", `println(readFile("small.toy"));`},
+			code:     ExitRuntime,
+			want_err: "[ERROR] readFile is not allowed, the program was not given any files",
+			id:       26,
+		},
+		{
+			args:     []string{"-e", "--files", file("small.toy"), "let x = 1;"},
+			code:     ExitUsage,
+			want_err: "--files needs a directory",
+			id:       27,
+		},
+		{
+			args:     []string{"repl"},
+			stdin:    "let name = input(\"name? \");\nbob\nprintln(\"hi \" + name);\n",
+			code:     ExitOK,
+			want_out: ">name? >hi bob\n>\n",
+			id:       28,
+		},
+		{
+			args:     []string{"-e", "--max-steps", "100", "println(1); while true {}"},
+			code:     ExitRuntime,
+			want_out: "1\n",
+			want_err: "[ERROR] Program took more than 100 steps",
+			id:       29,
+		},
+		{
+			args:     []string{"-e", "--max-steps", "0", "let x = 1;"},
+			code:     ExitUsage,
+			want_err: `--max-steps needs a positive integer, got "0"`,
+			id:       30,
+		},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := Run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		failed := code != tt.code || !strings.Contains(stderr.String(), tt.want_err)
+		if tt.want_out != "" && stdout.String() != tt.want_out {
+			failed = true
+		}
+		if failed {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot code %d, want %d\nStdout: %q\nWant: %q\nStderr: %q\n", tt.id, code, tt.code, stdout.String(), tt.want_out, stderr.String())
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.pprof")
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"-e", "--profile", path, "println(1);"}, nil, &stdout, &stderr)
+	data, err := os.ReadFile(path)
+	// A gzip header
+	if code != ExitOK || err != nil || len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Errorf("[FAILURE] profile gave code %d, %v, %q", code, err, stderr.String())
+	} else {
+		fmt.Printf("\033[32m[PASS] Test number 1 has passed\033[0m\n")
+	}
+}
+
+func TestCover(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.toy":      "export fn double(n) {\n    if n < 0 {\n        return 0;\n    }\n    return n * 2;\n}\n",
+		"lib_test.toy": "import \"lib.toy\" as lib;\nlet x = lib.double(2);\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	html, lcov := filepath.Join(dir, "cover.html"), filepath.Join(dir, "cover.lcov")
+
+	tests := []struct {
+		args []string
+		code int
+		// Substrings expected in stdout and stderr, in order
+		want []string
+		id   int
+	}{
+		{
+			args: []string{"test", "--cover", dir},
+			code: ExitOK,
+			want: []string{"1 passed, 0 failed\nCoverage:\n", "lib.toy       statements  75.0% (3/4)  branches  50.0% (1/2)\n",
+				"lib_test.toy  statements 100.0% (2/2)  branches      - (0/0)\n", "total", "statements  83.3% (5/6)  branches  50.0% (1/2)\n"},
+			id: 1,
+		},
+		{
+			args: []string{"test", "--cover-html", html, "--cover-lcov", lcov, dir},
+			code: ExitOK,
+			want: []string{"Coverage:", "<title>toy_lang coverage</title>", "SF:" + filepath.Join(dir, "lib.toy") + "\nBRDA:2,0,0,0\nBRDA:2,0,1,1\n", "DA:3,0\n"},
+			id:   2,
+		},
+		{
+			args: []string{"test", "--cover-html"},
+			code: ExitUsage,
+			want: []string{"--cover-html needs a value"},
+			id:   3,
+		},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := Run(tt.args, nil, &stdout, &stderr)
+		out := stdout.String() + stderr.String()
+		for _, path := range []string{html, lcov} {
+			if data, err := os.ReadFile(path); err == nil {
+				out += string(data)
+			}
+		}
+		rest := out
+		failed := code != tt.code
+		for _, w := range tt.want {
+			j := strings.Index(rest, w)
+			if j < 0 {
+				failed = true
+				break
+			}
+			rest = rest[j+len(w):]
+		}
+		if failed {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot code %d, want %d\n%v\nWant: %q\n", tt.id, code, tt.code, out, tt.want)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{"a_test.toy": "let x = 1;", "b_test.toy": "let y = 1 / 0;", "helper.toy": "let z = 1 / 0;"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"test", dir}, nil, &stdout, &stderr)
+	out := stdout.String()
+	if code != ExitRuntime || !strings.Contains(out, "ok   "+filepath.Join(dir, "a_test.toy")) ||
+		!strings.Contains(out, "FAIL "+filepath.Join(dir, "b_test.toy")) || !strings.Contains(out, "1 passed, 1 failed") {
+		t.Errorf("[FAILURE] test command gave code %d\n%v", code, out)
+	} else {
+		fmt.Printf("\033[32m[PASS] Test number 1 has passed\033[0m\n")
+	}
+
+	// Test functions run one by one and failures point at the assertion
+	dir = t.TempDir()
+	src := `fn add(a, b) {
+    return a + b;
+}
+fn test_add() {
+    assertEq(add(1, 2), 3);
+}
+fn test_wrong() {
+    let x = add(1, 1);
+    assertEq(x, 3);
+}
+fn test_crash() {
+    let y = 1 / 0;
+}
+fn helper(a) {
+    assert(false);
+}
+`
+	path := filepath.Join(dir, "math_test.toy")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	code = Run([]string{"test", dir}, nil, &stdout, &stderr)
+	want := "FAIL " + path + " (2 of 3 tests failed)\n" +
+		"    --- FAIL test_wrong\n" +
+		"        " + path + ":9: [ERROR] assertEq failed\n" +
+		"            got:  2\n" +
+		"            want: 3\n" +
+		"    --- FAIL test_crash\n" +
+		"        " + path + ":12: [ERROR] Integer divide by zero\n" +
+		"1 passed, 2 failed\n"
+	if code != ExitRuntime || stdout.String() != want {
+		t.Errorf("[FAILURE] Test number 2 has failed\nGot: %q\nWant: %q\n", stdout.String(), want)
+	} else {
+		fmt.Printf("\033[32m[PASS] Test number 2 has passed\033[0m\n")
+	}
+}
+
+func TestDebug(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prog.toy")
+	src := `fn add(a, b) {
+    let sum = a + b;
+    return sum;
+}
+let x = 1;
+let y = add(x, 2);
+println(y + int(input("")));
+`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		stdin string
+		code  int
+		// Substrings expected in stdout, in order
+		want []string
+		id   int
+	}{
+		{
+			stdin: "b 3\nc\nbt\nv\nf 1\np x\nn\nc\n4\n",
+			code:  ExitOK,
+			want: []string{
+				"in <main> (step)", "=>    1  fn add(a, b) {",
+				"Breakpoint set at", "prog.toy:3",
+				"in add (breakpoint)", "=>    3      return sum;",
+				"> #0 add at", "  #1 <main> at",
+				"Locals:\n    a = 1\n    b = 2\n    sum = 3\nGlobals:\n    x = 1\n",
+				"#1 <main> at", "x = 1\n",
+				"in <main> (step)", "=>    7  println",
+				"7\nProgram finished\n",
+			},
+			id: 1,
+		},
+		{
+			stdin: "s\ns\ns\ns\no\nl\nq\n",
+			code:  ExitOK,
+			want:  []string{"prog.toy:5 in <main>", "prog.toy:6 in <main>", "prog.toy:2 in add", "prog.toy:3 in add", "prog.toy:7 in <main>", "      6  let y = add(x, 2);\n=>    7  println(y + int(input(\"\")));\n(debug) "},
+			id:    2,
+		},
+		{
+			stdin: "p nope\nb x\nfly\nc\n1\n",
+			code:  ExitOK,
+			want:  []string{`No variable "nope" in this frame`, `Expected a line number, got "x"`, `Unknown command "fly"`, "4\nProgram finished"},
+			id:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"debug", path}, strings.NewReader(tt.stdin), &stdout, &stderr)
+		out := stdout.String()
+		failed := code != tt.code
+		rest := out
+		for _, want := range tt.want {
+			idx := strings.Index(rest, want)
+			if idx < 0 {
+				failed = true
+				break
+			}
+			rest = rest[idx+len(want):]
+		}
+		if failed {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot code %d, want %d\nStdout: %v\nStderr: %v\n", tt.id, code, tt.code, out, stderr.String())
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the .out and .err golden files of TestGolden")
+
+// Steps each golden program may take, prog5 computes fib(35) for profiling and is stopped by it
+const goldenSteps = 1000000
+
+// Runs every program in test_programs and compares what it printed with the golden files next to it. name.out
+// is stdout and name.err is stderr followed by the exit code, it only exists if the program wrote to stderr or
+// failed. name.in is given as stdin. Programs that take more than goldenSteps steps end with that error.
+// Run go test ./cli -run TestGolden -update to write the golden files again
+func TestGolden(t *testing.T) {
+	// Run from the repository root so the paths in errors don't depend on where the test runs
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	programs, err := filepath.Glob(filepath.Join("test_programs", "*.toy"))
+	if err != nil || len(programs) == 0 {
+		t.Fatalf("no test programs found: %v", err)
+	}
+	for _, program := range programs {
+		base := strings.TrimSuffix(program, ".toy")
+		stdin, err := os.ReadFile(base + ".in")
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"run", "--max-steps", strconv.Itoa(goldenSteps), program}, bytes.NewReader(stdin), &stdout, &stderr)
+		errText := stderr.String()
+		if errText != "" || code != ExitOK {
+			errText += fmt.Sprintf("exit code %d\n", code)
+		}
+
+		if *update {
+			if err := os.WriteFile(base+".out", stdout.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if errText == "" {
+				err = os.Remove(base + ".err")
+				if os.IsNotExist(err) {
+					err = nil
+				}
+			} else {
+				err = os.WriteFile(base+".err", []byte(errText), 0o644)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		wantOut, err := os.ReadFile(base + ".out")
+		if err != nil {
+			t.Errorf("[FAILURE] %v has no golden file, run go test ./cli -run TestGolden -update\n", program)
+			continue
+		}
+		wantErr, err := os.ReadFile(base + ".err")
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if stdout.String() != string(wantOut) || errText != string(wantErr) {
+			t.Errorf("[FAILURE] %v has failed\nGot stdout: %q\nWant stdout: %q\nGot stderr: %q\nWant stderr: %q\n",
+				program, stdout.String(), wantOut, errText, wantErr)
+		} else {
+			fmt.Printf("\033[32m[PASS] %v has passed\033[0m\n", program)
+		}
+	}
+}
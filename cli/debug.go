@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/evaluator"
+)
+
+const debugHelp = `Commands:
+    b, break [file:]<line>  set a breakpoint, the file defaults to the one being debugged
+    d, delete [file:]<line> remove a breakpoint
+    c, continue             run to the next breakpoint
+    s, step                 run to the next statement, going into calls
+    n, next                 run to the next statement, stepping over calls
+    o, out                  run until the current function returns
+    bt, stack               show the call stack
+    f, frame <n>            select a frame of the stack, 0 is the innermost
+    p, print <name>         show a variable as seen from the selected frame
+    v, vars                 show the variables of the selected frame
+    l, list                 show the code around the selected frame's line
+    q, quit                 stop the program
+    h, help                 show this message
+`
+
+// A terminal session that pauses before the first statement and reads commands from stdin, the program's
+// input() reads from the same stream
+type debugSession struct {
+	path    string
+	in      *bufio.Reader
+	out     io.Writer
+	dbg     *evaluator.Debugger
+	stack   []*evaluator.Frame
+	frame   int
+	sources map[string][]string
+}
+
+func debugFile(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return usageError(stderr, "debug needs a file")
+	}
+	path := args[0]
+	sources, ok := readFiles([]string{path}, stderr)
+	if !ok {
+		return ExitRuntime
+	}
+	program, errs := compile(sources[path])
+	if len(errs) > 0 {
+		printErrors(stderr, path, errs)
+		return ExitCompile
+	}
+
+	s := &debugSession{
+		path:    path,
+		in:      bufio.NewReader(stdin),
+		out:     stdout,
+		sources: make(map[string][]string),
+	}
+	s.dbg = evaluator.NewDebugger(s.pause)
+	s.dbg.Step(evaluator.StepInto)
+
+	in := evaluator.NewInterpreter()
+	in.Out = stdout
+	in.In = s.in
+	in.Args = args[1:]
+	in.SetFile(path)
+	in.Hook = s.dbg
+	err := execute(&in, program)
+	if err != nil && err.Error() == evaluator.StoppedByDebugger {
+		return ExitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%v: %v\n", path, err)
+		return ExitRuntime
+	}
+	fmt.Fprintln(stdout, "Program finished")
+	return ExitOK
+}
+
+// Reads commands until one of them resumes the program
+func (s *debugSession) pause(stack []*evaluator.Frame, reason string) evaluator.StepMode {
+	s.stack, s.frame = stack, len(stack)-1
+	top := stack[len(stack)-1]
+	fmt.Fprintf(s.out, "Stopped at %v in %v (%v)\n", s.location(top), top.Name, reason)
+	s.printLine(top.File, top.Pos.Line, "=> ")
+
+	for {
+		fmt.Fprint(s.out, "(debug) ")
+		line, err := s.in.ReadString('\n')
+		if err != nil && line == "" {
+			// Nothing left to read, let the program finish
+			fmt.Fprintln(s.out)
+			return evaluator.Continue
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "c", "continue":
+			return evaluator.Continue
+		case "s", "step":
+			return evaluator.StepInto
+		case "n", "next":
+			return evaluator.StepOver
+		case "o", "out":
+			return evaluator.StepOut
+		case "q", "quit":
+			return evaluator.Stop
+		case "b", "break":
+			if file, line, ok := s.breakpointArg(arg); ok {
+				s.dbg.SetBreakpoint(file, line)
+				fmt.Fprintf(s.out, "Breakpoint set at %v:%d\n", displayPath(file), line)
+			}
+		case "d", "delete":
+			if file, line, ok := s.breakpointArg(arg); ok {
+				s.dbg.ClearBreakpoint(file, line)
+				fmt.Fprintf(s.out, "Breakpoint removed from %v:%d\n", displayPath(file), line)
+			}
+		case "bt", "stack":
+			for j := len(s.stack) - 1; j >= 0; j-- {
+				marker := "  "
+				if j == s.frame {
+					marker = "> "
+				}
+				frame := s.stack[j]
+				fmt.Fprintf(s.out, "%v#%d %v at %v\n", marker, len(s.stack)-1-j, frame.Name, s.location(frame))
+			}
+		case "f", "frame":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 || n >= len(s.stack) {
+				fmt.Fprintf(s.out, "Frame must be a number from 0 to %d\n", len(s.stack)-1)
+				continue
+			}
+			s.frame = len(s.stack) - 1 - n
+			frame := s.stack[s.frame]
+			fmt.Fprintf(s.out, "#%d %v at %v\n", n, frame.Name, s.location(frame))
+			s.printLine(frame.File, frame.Pos.Line, "=> ")
+		case "p", "print":
+			if val, ok := s.stack[s.frame].Lookup(arg); ok {
+				fmt.Fprintf(s.out, "%v = %v\n", arg, evaluator.FormatValue(val))
+			} else {
+				fmt.Fprintf(s.out, "No variable %q in this frame\n", arg)
+			}
+		case "v", "vars":
+			frame := s.stack[s.frame]
+			s.printVars("Locals", frame.Locals())
+			s.printVars("Globals", frame.Globals())
+		case "l", "list":
+			frame := s.stack[s.frame]
+			for line := max(frame.Pos.Line-3, 1); line <= frame.Pos.Line+3; line++ {
+				prefix := "   "
+				if line == frame.Pos.Line {
+					prefix = "=> "
+				}
+				if !s.printLine(frame.File, line, prefix) {
+					break
+				}
+			}
+		case "h", "help":
+			fmt.Fprint(s.out, debugHelp)
+		case "":
+		default:
+			fmt.Fprintf(s.out, "Unknown command %q, type help for a list\n", cmd)
+		}
+	}
+}
+
+// Parses [file:]line, files are relative to the file being debugged
+func (s *debugSession) breakpointArg(arg string) (string, int, bool) {
+	file := s.path
+	if name, line, ok := strings.Cut(arg, ":"); ok {
+		file, arg = name, line
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(s.path), file)
+		}
+	}
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 {
+		fmt.Fprintf(s.out, "Expected a line number, got %q\n", arg)
+		return "", 0, false
+	}
+	return file, line, true
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "<eval>"
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+func (s *debugSession) location(frame *evaluator.Frame) string {
+	return fmt.Sprintf("%v:%d", displayPath(frame.File), frame.Pos.Line)
+}
+
+// Prints a numbered source line, it returns false past the end of the file
+func (s *debugSession) printLine(file string, line int, prefix string) bool {
+	lines, ok := s.sources[file]
+	if !ok {
+		source, _ := os.ReadFile(file)
+		lines = strings.Split(strings.TrimSuffix(string(source), "\n"), "\n")
+		s.sources[file] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return false
+	}
+	fmt.Fprintf(s.out, "%v%4d  %v\n", prefix, line, lines[line-1])
+	return true
+}
+
+func (s *debugSession) printVars(title string, vars map[string]ast.Node) {
+	if len(vars) == 0 {
+		return
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(s.out, "%v:\n", title)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "    %v = %v\n", name, evaluator.FormatValue(vars[name]))
+	}
+}
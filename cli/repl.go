@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"toy_lang/evaluator"
+)
+
+// Reads a line at a time and runs it in one interpreter so declarations carry over between lines
+func runRepl(stdin io.Reader, stdout, stderr io.Writer) int {
+	// input() reads from the same reader as the prompt, so a line read ahead for it isn't lost
+	reader := bufio.NewReader(stdin)
+	in := evaluator.NewInterpreter()
+	in.Out = stdout
+	in.In = reader
+	for {
+		fmt.Fprint(stdout, ">")
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(stdout)
+			return ExitOK
+		}
+		program, errs := compile(strings.TrimRight(line, "\r\n"))
+		if len(errs) > 0 {
+			printErrors(stderr, "repl", errs)
+			continue
+		}
+		if err := execute(&in, program); err != nil {
+			fmt.Fprintf(stderr, "repl: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/evaluator"
+)
+
+// Collects every *_test.toy file under paths, a path can also name a single file
+func findTestFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, "_test.toy") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Options of test, given before the paths
+type testOptions struct {
+	// Print a coverage summary, also set by the report flags
+	cover bool
+	// Files to write HTML and lcov coverage reports to
+	coverHTML string
+	coverLcov string
+}
+
+// Splits the leading --cover, --cover-html <file> and --cover-lcov <file> flags off args
+func testFlags(args []string) (testOptions, []string, error) {
+	var opts testOptions
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		flag := args[0]
+		if flag == "--cover" {
+			opts.cover = true
+			args = args[1:]
+			continue
+		}
+		if len(args) < 2 {
+			return opts, args, fmt.Errorf("%v needs a value", flag)
+		}
+		switch flag {
+		case "--cover-html":
+			opts.coverHTML = args[1]
+		case "--cover-lcov":
+			opts.coverLcov = args[1]
+		default:
+			return opts, args, fmt.Errorf("unknown flag %q", flag)
+		}
+		opts.cover = true
+		args = args[2:]
+	}
+	return opts, args, nil
+}
+
+// Runs every test file, a file with fn test_xxx() functions runs each of them in a fresh interpreter after its
+// top level code and the file's other tests, otherwise the file is one test that passes if it runs without
+// an error
+func runTests(args []string, stdout, stderr io.Writer) int {
+	opts, paths, err := testFlags(args)
+	if err != nil {
+		return usageError(stderr, err.Error())
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findTestFiles(paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "[ERROR] %v\n", err)
+		return ExitRuntime
+	}
+
+	var coverage *evaluator.Coverage
+	if opts.cover {
+		coverage = evaluator.NewCoverage()
+	}
+	passed, failed := 0, 0
+	for _, file := range files {
+		p, f := runTestFile(file, coverage, stdout)
+		passed += p
+		failed += f
+	}
+	fmt.Fprintf(stdout, "%v passed, %v failed\n", passed, failed)
+	if coverage != nil {
+		printCoverage(stdout, coverage)
+		if !writeCoverage(coverage, opts, stderr) {
+			return ExitRuntime
+		}
+	}
+	if failed > 0 {
+		return ExitRuntime
+	}
+	return ExitOK
+}
+
+// Runs the tests of a file and prints the results, coverage can be nil. It returns how many passed and failed
+func runTestFile(path string, coverage *evaluator.Coverage, stdout io.Writer) (passed, failed int) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stdout, "FAIL %v\n    %v\n", path, err)
+		return 0, 1
+	}
+	program, errs := compile(string(source))
+	if len(errs) > 0 {
+		fmt.Fprintf(stdout, "FAIL %v\n%v", path, indent(fmt.Sprintf("%v: %v", displayPath(path), errs[0]), "    "))
+		return 0, 1
+	}
+
+	names := testFuncs(program)
+	if len(names) == 0 {
+		if msg := runTest(path, string(source), "", coverage); msg != "" {
+			fmt.Fprintf(stdout, "FAIL %v\n%v", path, indent(msg, "    "))
+			return 0, 1
+		}
+		fmt.Fprintf(stdout, "ok   %v\n", path)
+		return 1, 0
+	}
+
+	var report strings.Builder
+	for _, name := range names {
+		if msg := runTest(path, string(source), name, coverage); msg != "" {
+			failed++
+			fmt.Fprintf(&report, "    --- FAIL %v\n%v", name, indent(msg, "        "))
+		} else {
+			passed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(stdout, "FAIL %v (%d of %d tests failed)\n%v", path, failed, len(names), report.String())
+	} else {
+		fmt.Fprintf(stdout, "ok   %v (%d tests)\n", path, len(names))
+	}
+	return passed, failed
+}
+
+// The top level functions named test_xxx, in the order they are declared
+func testFuncs(program ast.ProgramNode) []string {
+	var names []string
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStmtNode); ok {
+			stmt = export.Stmt
+		}
+		if f, ok := stmt.(*ast.FuncDecNode); ok && strings.HasPrefix(f.Name, "test_") && len(f.Params) == 0 {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// Runs a file in a fresh interpreter and then calls the test function name, if there is one. It returns the
+// error prefixed with where it happened, or "" if the test passed
+func runTest(path, source, name string, coverage *evaluator.Coverage) string {
+	// Each test parses the file again so nothing one test does to the tree can leak into the next
+	program, _ := compile(source)
+	if name != "" {
+		program.Statements = append(program.Statements, &ast.FuncCallNode{Name: ast.ReferenceExprNode{Name: name}})
+	}
+	in := evaluator.NewInterpreter()
+	in.Out = io.Discard
+	in.In = strings.NewReader("")
+	in.SetFile(path)
+	hook := &testHook{coverage: coverage}
+	in.Hook = hook
+	if err := execute(&in, program); err != nil {
+		return hook.where(err) + err.Error()
+	}
+	return ""
+}
+
+type testLocation struct {
+	file string
+	line int
+}
+
+// Keeps track of where a test is so a failure can point at its line, and passes statements on to coverage
+type testHook struct {
+	coverage *evaluator.Coverage
+	// The last statement that started and the statement with the last assertion
+	last, assertion testLocation
+}
+
+func (h *testHook) Statement(stack []*evaluator.Frame) {
+	top := stack[len(stack)-1]
+	h.last = testLocation{top.File, top.Pos.Line}
+	if h.coverage != nil {
+		h.coverage.Statement(stack)
+	}
+}
+
+func (h *testHook) Program(file string, program *ast.ProgramNode) {
+	if h.coverage != nil {
+		h.coverage.Program(file, program)
+	}
+}
+
+func (h *testHook) Branch(stack []*evaluator.Frame, stmt *ast.IfStmtNode, taken bool) {
+	if h.coverage != nil {
+		h.coverage.Branch(stack, stmt, taken)
+	}
+}
+
+// The arguments of a call are evaluated before its frame is pushed, so when an assertion's frame is pushed its
+// caller is still on the statement with the assertion
+func (h *testHook) Call(stack []*evaluator.Frame) {
+	top := stack[len(stack)-1]
+	if (top.Name == "assert" || top.Name == "assertEq") && len(stack) > 1 {
+		caller := stack[len(stack)-2]
+		h.assertion = testLocation{caller.File, caller.Pos.Line}
+	}
+}
+
+func (h *testHook) Return(stack []*evaluator.Frame) {}
+
+// Formats where err happened as "file:line: ", a failed assertion is always the last one that was called
+func (h *testHook) where(err error) string {
+	loc := h.last
+	if strings.HasPrefix(err.Error(), "[ERROR] assert") && h.assertion.line > 0 {
+		loc = h.assertion
+	}
+	if loc.line == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%v:%d: ", displayPath(loc.file), loc.line)
+}
+
+// Puts prefix before every line of text and ends it with a newline
+func indent(text, prefix string) string {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix) + "\n"
+}
+
+// Prints the statements and branches covered in each file and in total
+func printCoverage(stdout io.Writer, coverage *evaluator.Coverage) {
+	files := coverage.Files()
+	width := len("total")
+	for _, f := range files {
+		width = max(width, len(displayPath(f.Path)))
+	}
+	line := func(name string, run, stmts, taken, branches int) {
+		fmt.Fprintf(stdout, "    %-*v  statements %6v (%d/%d)  branches %6v (%d/%d)\n",
+			width, name, evaluator.Percent(run, stmts), run, stmts, evaluator.Percent(taken, branches), taken, branches)
+	}
+	fmt.Fprintln(stdout, "Coverage:")
+	var totals [4]int
+	for _, f := range files {
+		run, stmts, taken, branches := f.Summary()
+		line(displayPath(f.Path), run, stmts, taken, branches)
+		for j, n := range []int{run, stmts, taken, branches} {
+			totals[j] += n
+		}
+	}
+	line("total", totals[0], totals[1], totals[2], totals[3])
+}
+
+func writeCoverage(coverage *evaluator.Coverage, opts testOptions, stderr io.Writer) bool {
+	reports := []struct {
+		path  string
+		write func(io.Writer)
+	}{
+		{opts.coverHTML, coverage.WriteHTML},
+		{opts.coverLcov, coverage.WriteLcov},
+	}
+	for _, report := range reports {
+		if report.path == "" {
+			continue
+		}
+		out, err := openOutput(report.path, stderr)
+		if err == nil {
+			report.write(out)
+			err = out.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "[ERROR] Could not write coverage report %v: %v\n", report.path, err)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"toy_lang/internal/wire"
+)
+
+// A scripted client, it sends requests and waits for the responses and events it expects
+type client struct {
+	t    *testing.T
+	w    io.WriteCloser
+	seq  int
+	msgs chan map[string]any
+	// Messages read while waiting for something else
+	pending []map[string]any
+	output  strings.Builder
+	served  chan error
+}
+
+func newClient(t *testing.T) *client {
+	toServer, serverIn := io.Pipe()
+	serverOut, fromServer := io.Pipe()
+	c := &client{t: t, w: serverIn, msgs: make(chan map[string]any, 100), served: make(chan error, 1)}
+	go func() {
+		c.served <- NewServer(toServer, fromServer).Serve()
+		fromServer.Close()
+	}()
+	go func() {
+		in := bufio.NewReader(serverOut)
+		for {
+			body, err := wire.ReadMessage(in)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			var msg map[string]any
+			json.Unmarshal(body, &msg)
+			c.msgs <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) send(command string, args any) {
+	c.seq++
+	body, _ := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// Waits for the response to command or the event called name, messages that came first are kept for later
+// calls and program output is collected
+func (c *client) expect(kind, name string) map[string]any {
+	c.t.Helper()
+	matches := func(msg map[string]any) bool {
+		return msg["type"] == kind && (msg["command"] == name || msg["event"] == name)
+	}
+	for j, msg := range c.pending {
+		if matches(msg) {
+			c.pending = append(c.pending[:j], c.pending[j+1:]...)
+			return msg
+		}
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.msgs:
+			if !ok {
+				c.t.Fatalf("[FAILURE] Server closed the stream while waiting for %s %s", kind, name)
+			}
+			if msg["type"] == "event" && msg["event"] == "output" {
+				c.output.WriteString(msg["body"].(map[string]any)["output"].(string))
+			}
+			if matches(msg) {
+				return msg
+			}
+			c.pending = append(c.pending, msg)
+		case <-timeout:
+			c.t.Fatalf("[FAILURE] Timed out waiting for %s %s", kind, name)
+		}
+	}
+}
+
+// Sends a request and returns its response
+func (c *client) request(command string, args any) map[string]any {
+	c.t.Helper()
+	c.send(command, args)
+	return c.expect("response", command)
+}
+
+// Messages are decoded into maps so the keys of a body come out sorted
+func body(msg map[string]any) string {
+	data, _ := json.Marshal(msg["body"])
+	return string(data)
+}
+
+func check(t *testing.T, id int, got string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("\033[31m[FAILURE] Test number %d has failed\033[0m\nGot:  %s\nWant: %s\n", id, got, w)
+			return
+		}
+	}
+	fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", id)
+}
+
+func writeProgram(t *testing.T, src string) string {
+	path := filepath.Join(t.TempDir(), "prog.toy")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSession(t *testing.T) {
+	path := writeProgram(t, `fn add(a, b) {
+    let sum = a + b;
+    return sum;
+}
+let arr = [1, 2];
+let y = add(arr[0], 2);
+println(y);
+`)
+	c := newClient(t)
+
+	check(t, 1, body(c.request("initialize", map[string]any{"adapterID": "toy_lang"})), `"supportsConfigurationDoneRequest":true`)
+	c.expect("event", "initialized")
+	check(t, 2, fmt.Sprint(c.request("launch", map[string]any{"program": path})["success"]), "true")
+	bps := c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": []any{map[string]any{"line": 3}}})
+	check(t, 3, body(bps), `{"breakpoints":[{"line":3,"verified":true}]}`)
+	c.request("configurationDone", nil)
+
+	check(t, 4, body(c.expect("event", "stopped")), `"reason":"breakpoint"`, `"threadId":1`)
+	check(t, 5, body(c.request("threads", nil)), `{"threads":[{"id":1,"name":"main"}]}`)
+	check(t, 6, body(c.request("stackTrace", map[string]any{"threadId": 1})),
+		`{"column":5,"id":1,"line":3,"name":"add","source":{"name":"prog.toy","path":"`+path+`"}}`,
+		`{"column":1,"id":2,"line":6,"name":"\u003cmain\u003e","source":{"name":"prog.toy","path":"`+path+`"}}`,
+		`"totalFrames":2`)
+
+	scopes := c.request("scopes", map[string]any{"frameId": 1})
+	check(t, 7, body(scopes), `{"expensive":false,"name":"Locals","variablesReference":1}`, `{"expensive":false,"name":"Globals","variablesReference":2}`)
+	check(t, 8, body(c.request("variables", map[string]any{"variablesReference": 1})),
+		`{"variables":[{"name":"a","type":"int","value":"1","variablesReference":0},{"name":"b","type":"int","value":"2","variablesReference":0},{"name":"sum","type":"int","value":"3","variablesReference":0}]}`)
+	check(t, 9, body(c.request("variables", map[string]any{"variablesReference": 2})), `{"name":"arr","type":"array","value":"[1, 2]","variablesReference":3}`)
+	check(t, 10, body(c.request("variables", map[string]any{"variablesReference": 3})), `[{"name":"0","type":"int","value":"1","variablesReference":0},{"name":"1","type":"int","value":"2","variablesReference":0}]`)
+	check(t, 11, body(c.request("evaluate", map[string]any{"expression": "sum", "frameId": 1})), `"result":"3"`)
+	check(t, 12, fmt.Sprint(c.request("evaluate", map[string]any{"expression": "nope"})["message"]), `No variable "nope"`)
+
+	c.request("stepOut", map[string]any{"threadId": 1})
+	c.expect("event", "stopped")
+	check(t, 13, body(c.request("stackTrace", map[string]any{"threadId": 1})), `"line":7`, `"totalFrames":1`)
+
+	c.request("next", map[string]any{"threadId": 1})
+	check(t, 14, body(c.expect("event", "exited")), `{"exitCode":0}`)
+	c.expect("event", "terminated")
+	check(t, 15, c.output.String(), "3\n")
+	check(t, 16, fmt.Sprint(c.request("continue", map[string]any{"threadId": 1})["message"]), "not paused")
+	c.request("disconnect", nil)
+	check(t, 17, fmt.Sprint(<-c.served), "<nil>")
+}
+
+func TestControl(t *testing.T) {
+	// Stop on entry, then a breakpoint set while paused
+	path := writeProgram(t, "let x = 1;\nlet y = 2;\nlet z = 1 / 0;\n")
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", map[string]any{"program": path, "stopOnEntry": true})
+	c.request("configurationDone", nil)
+	check(t, 1, body(c.expect("event", "stopped")), `"reason":"entry"`)
+	c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": []any{map[string]any{"line": 2}}})
+	c.request("continue", map[string]any{"threadId": 1})
+	check(t, 2, body(c.expect("event", "stopped")), `"reason":"breakpoint"`)
+	c.request("continue", map[string]any{"threadId": 1})
+	check(t, 3, body(c.expect("event", "exited")), `{"exitCode":1}`)
+	check(t, 4, c.output.String(), "divide by zero")
+	c.request("disconnect", nil)
+	<-c.served
+
+	// Pausing a running program and disconnecting from it
+	path = writeProgram(t, "let i = 0;\nwhile true {\n    i += 1;\n}\n")
+	c = newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", map[string]any{"program": path})
+	c.request("configurationDone", nil)
+	c.request("pause", map[string]any{"threadId": 1})
+	check(t, 5, body(c.expect("event", "stopped")), `"reason":"pause"`)
+	check(t, 6, body(c.request("stackTrace", map[string]any{"threadId": 1})), `"totalFrames":1`)
+	c.request("continue", map[string]any{"threadId": 1})
+	c.request("disconnect", nil)
+	c.expect("event", "terminated")
+	check(t, 7, fmt.Sprint(<-c.served), "<nil>")
+
+	// Bad launches are reported in the response
+	c = newClient(t)
+	c.request("initialize", nil)
+	check(t, 8, fmt.Sprint(c.request("launch", map[string]any{"program": "/does/not/exist.toy"})["message"]), "Could not read")
+	check(t, 9, fmt.Sprint(c.request("launch", map[string]any{"program": writeProgram(t, "const x = 1; x = 2;")})["message"]), "Cannot reassign constant x")
+	check(t, 10, fmt.Sprint(c.request("stepBack", nil)["message"]), "not supported")
+	c.w.Close()
+	check(t, 11, fmt.Sprint(<-c.served), "<nil>")
+}
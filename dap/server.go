@@ -0,0 +1,493 @@
+// Package dap is a Debug Adapter Protocol server for toy_lang, it drives an evaluator.Debugger over a pair of
+// streams so editors can set breakpoints, step and look at the call stack and variables
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"toy_lang/ast"
+	"toy_lang/evaluator"
+	"toy_lang/internal/wire"
+	"toy_lang/lexer"
+	"toy_lang/parser"
+	"toy_lang/resolver"
+)
+
+// The program runs on a single thread
+const threadID = 1
+
+// Server handles requests on the goroutine that calls Serve while the program runs on its own. The debugger is
+// only touched by the program's goroutine, breakpoint changes are queued for it
+type Server struct {
+	in *bufio.Reader
+
+	// Guards out and seq, both goroutines send messages
+	writeMu sync.Mutex
+	out     io.Writer
+	seq     int
+
+	program     ast.ProgramNode
+	path        string
+	args        []string
+	stopOnEntry bool
+	launched    bool
+	started     bool
+
+	dbg *evaluator.Debugger
+	// Breakpoint changes waiting for the program's goroutine, by file
+	pendingMu sync.Mutex
+	pending   map[string][]int
+	// Set by pause and disconnect requests while the program runs
+	pauseRequested atomic.Bool
+	stopRequested  atomic.Bool
+	// Whether the next stop is because of a pause request or stopOnEntry
+	pausing bool
+	entry   bool
+
+	// Guards the state of a stopped program, the stack and variable references are only valid until it resumes
+	stateMu sync.Mutex
+	paused  bool
+	stack   []*evaluator.Frame
+	refs    []any
+	resume  chan evaluator.StepMode
+	done    chan struct{}
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:      bufio.NewReader(in),
+		out:     out,
+		pending: make(map[string][]int),
+		resume:  make(chan evaluator.StepMode),
+		done:    make(chan struct{}),
+	}
+}
+
+// Serve handles requests until the client disconnects or closes the stream, a program that is still running
+// is stopped first
+func (s *Server) Serve() error {
+	for {
+		body, err := wire.ReadMessage(s.in)
+		if err == io.EOF {
+			s.stop()
+			return nil
+		}
+		if err != nil {
+			s.stop()
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.stop()
+			return fmt.Errorf("[ERROR] Invalid message: %v", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if s.handle(req) {
+			return nil
+		}
+	}
+}
+
+func (s *Server) send(msg func(seq int) any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	wire.WriteMessage(s.out, msg(s.seq))
+}
+
+func (s *Server) reply(req request, body any) {
+	s.send(func(seq int) any {
+		return response{Seq: seq, Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body}
+	})
+}
+
+func (s *Server) fail(req request, msg string) {
+	s.send(func(seq int) any {
+		return response{Seq: seq, Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: msg}
+	})
+}
+
+func (s *Server) event(name string, body any) {
+	s.send(func(seq int) any {
+		return event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+func decode(args json.RawMessage, v any) {
+	if len(args) == 0 {
+		return
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		panic(fmt.Sprintf("[ERROR] Invalid arguments: %v", err))
+	}
+}
+
+// Handles one request, it returns true when the session is over
+func (s *Server) handle(req request) (done bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.fail(req, wire.Message(r))
+		}
+	}()
+
+	switch req.Command {
+	case "initialize":
+		s.reply(req, map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportTerminateDebuggee":         true,
+		})
+		s.event("initialized", nil)
+	case "launch":
+		var args launchArguments
+		decode(req.Arguments, &args)
+		s.launch(req, args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		decode(req.Arguments, &args)
+		breakpoints := []Breakpoint{}
+		lines := []int{}
+		for _, bp := range args.Breakpoints {
+			lines = append(lines, bp.Line)
+			breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: bp.Line})
+		}
+		s.pendingMu.Lock()
+		s.pending[args.Source.Path] = lines
+		s.pendingMu.Unlock()
+		s.reply(req, map[string]any{"breakpoints": breakpoints})
+	case "configurationDone":
+		if !s.launched {
+			panic("[ERROR] configurationDone before launch")
+		}
+		s.reply(req, nil)
+		s.start()
+	case "threads":
+		s.reply(req, map[string]any{"threads": []Thread{{ID: threadID, Name: "main"}}})
+	case "stackTrace":
+		s.reply(req, s.stackTrace())
+	case "scopes":
+		var args frameArguments
+		decode(req.Arguments, &args)
+		s.reply(req, s.scopes(args.FrameID))
+	case "variables":
+		var args variablesArguments
+		decode(req.Arguments, &args)
+		s.reply(req, s.variables(args.VariablesReference))
+	case "evaluate":
+		var args evaluateArguments
+		decode(req.Arguments, &args)
+		s.reply(req, s.evaluate(args))
+	case "continue":
+		s.resumeWith(req, evaluator.Continue, map[string]any{"allThreadsContinued": true})
+	case "next":
+		s.resumeWith(req, evaluator.StepOver, nil)
+	case "stepIn":
+		s.resumeWith(req, evaluator.StepInto, nil)
+	case "stepOut":
+		s.resumeWith(req, evaluator.StepOut, nil)
+	case "pause":
+		s.pauseRequested.Store(true)
+		s.reply(req, nil)
+	case "disconnect", "terminate":
+		s.stop()
+		s.reply(req, nil)
+		return req.Command == "disconnect"
+	default:
+		panic(fmt.Sprintf("[ERROR] Request %s is not supported", req.Command))
+	}
+	return false
+}
+
+func (s *Server) launch(req request, args launchArguments) {
+	if args.Program == "" {
+		panic("[ERROR] launch needs a program")
+	}
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		panic(fmt.Sprintf("[ERROR] Could not read %v: %v", args.Program, err))
+	}
+	var program ast.ProgramNode
+	if msg := wire.Catch(func() { program = parser.NewParser().Parse(lexer.NewLexer().Lex(string(source))) }); msg != "" {
+		panic(msg)
+	}
+	if errs := resolver.NewResolver().Resolve(program); len(errs) > 0 {
+		panic(errs[0].Error())
+	}
+	s.program, s.path, s.args, s.stopOnEntry = program, args.Program, args.Args, args.StopOnEntry
+	s.launched = true
+	s.reply(req, nil)
+}
+
+// Starts the program on its own goroutine
+func (s *Server) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.dbg = evaluator.NewDebugger(s.pause)
+	if s.stopOnEntry {
+		s.entry = true
+		s.dbg.Step(evaluator.StepInto)
+	}
+
+	in := evaluator.NewInterpreter()
+	in.Out = outputWriter{s}
+	in.In = strings.NewReader("")
+	in.Args = s.args
+	in.SetFile(s.path)
+	in.Hook = hook{s}
+	go func() {
+		defer close(s.done)
+		code := 0
+		if msg := wire.Catch(func() { in.Execute(s.program, false) }); msg != "" && msg != evaluator.StoppedByDebugger {
+			s.event("output", map[string]any{"category": "stderr", "output": msg + "\n"})
+			code = 1
+		}
+		s.event("exited", map[string]any{"exitCode": code})
+		s.event("terminated", nil)
+	}()
+}
+
+// Ends a running program and waits for it
+func (s *Server) stop() {
+	if !s.started {
+		return
+	}
+	s.stopRequested.Store(true)
+	s.release(evaluator.Stop)
+	<-s.done
+}
+
+func (s *Server) resumeWith(req request, mode evaluator.StepMode, body any) {
+	s.stateMu.Lock()
+	paused := s.paused
+	s.stateMu.Unlock()
+	if !paused {
+		panic("[ERROR] The program is not paused")
+	}
+	s.reply(req, body)
+	s.release(mode)
+}
+
+// Hands mode to a paused program, the paused state is cleared first so it is only released once
+func (s *Server) release(mode evaluator.StepMode) {
+	s.stateMu.Lock()
+	paused := s.paused
+	s.paused, s.stack = false, nil
+	s.stateMu.Unlock()
+	if paused {
+		s.resume <- mode
+	}
+}
+
+// hook runs on the program's goroutine before each statement
+type hook struct {
+	s *Server
+}
+
+func (h hook) Statement(stack []*evaluator.Frame) {
+	s := h.s
+	if s.stopRequested.Load() {
+		panic(evaluator.StoppedByDebugger)
+	}
+	s.applyBreakpoints()
+	if s.pauseRequested.Swap(false) {
+		s.pausing = true
+		s.dbg.Step(evaluator.StepInto)
+	}
+	s.dbg.Statement(stack)
+}
+
+func (s *Server) applyBreakpoints() {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	for file, lines := range s.pending {
+		s.dbg.ClearBreakpoints(file)
+		for _, line := range lines {
+			s.dbg.SetBreakpoint(file, line)
+		}
+	}
+	clear(s.pending)
+}
+
+// Called by the debugger on the program's goroutine, it blocks until the client resumes
+func (s *Server) pause(stack []*evaluator.Frame, reason string) evaluator.StepMode {
+	if s.pausing {
+		reason, s.pausing = "pause", false
+	} else if s.entry {
+		reason, s.entry = "entry", false
+	}
+	s.stateMu.Lock()
+	// stop sets stopRequested before it checks paused, so one of the two sees the other
+	if s.stopRequested.Load() {
+		s.stateMu.Unlock()
+		return evaluator.Stop
+	}
+	s.paused, s.stack, s.refs = true, stack, []any{}
+	s.stateMu.Unlock()
+
+	s.event("stopped", map[string]any{"reason": reason, "threadId": threadID, "allThreadsStopped": true})
+	mode := <-s.resume
+	s.applyBreakpoints()
+	return mode
+}
+
+// Returns the stopped stack, the lock is held until the returned function is called
+func (s *Server) stopped() ([]*evaluator.Frame, func()) {
+	s.stateMu.Lock()
+	if !s.paused {
+		s.stateMu.Unlock()
+		panic("[ERROR] The program is not paused")
+	}
+	return s.stack, s.stateMu.Unlock
+}
+
+// Frame ids count from 1 at the innermost frame
+func frameAt(stack []*evaluator.Frame, id int) *evaluator.Frame {
+	if id < 1 || id > len(stack) {
+		panic(fmt.Sprintf("[ERROR] No frame with id %d", id))
+	}
+	return stack[len(stack)-id]
+}
+
+func (s *Server) stackTrace() map[string]any {
+	stack, unlock := s.stopped()
+	defer unlock()
+	frames := []StackFrame{}
+	for j := len(stack) - 1; j >= 0; j-- {
+		f := stack[j]
+		frames = append(frames, StackFrame{
+			ID:     len(stack) - j,
+			Name:   f.Name,
+			Source: Source{Name: filepath.Base(f.File), Path: f.File},
+			Line:   f.Pos.Line,
+			Column: f.Pos.Col,
+		})
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// Hands out a variables reference for a scope's variables or a value with children, 0 means nothing to expand
+func (s *Server) ref(v any) int {
+	switch v := v.(type) {
+	case *ast.ArrLiteralNode:
+		if len(v.Elems) == 0 {
+			return 0
+		}
+	case *ast.StructLiteralNode:
+		if len(v.Fields) == 0 {
+			return 0
+		}
+	case map[string]ast.Node:
+	default:
+		return 0
+	}
+	s.refs = append(s.refs, v)
+	return len(s.refs)
+}
+
+func (s *Server) scopes(frameID int) map[string]any {
+	stack, unlock := s.stopped()
+	defer unlock()
+	f := frameAt(stack, frameID)
+	return map[string]any{"scopes": []Scope{
+		{Name: "Locals", VariablesReference: s.ref(f.Locals())},
+		{Name: "Globals", VariablesReference: s.ref(f.Globals())},
+	}}
+}
+
+func (s *Server) variables(ref int) map[string]any {
+	_, unlock := s.stopped()
+	defer unlock()
+	if ref < 1 || ref > len(s.refs) {
+		panic(fmt.Sprintf("[ERROR] No variables with reference %d", ref))
+	}
+	vars := []Variable{}
+	switch v := s.refs[ref-1].(type) {
+	case map[string]ast.Node:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			vars = append(vars, s.variable(name, v[name]))
+		}
+	case *ast.ArrLiteralNode:
+		for _, key := range ast.ElemKeys(v) {
+			// Integer keys are shown as plain indexes
+			name := key
+			if strings.HasPrefix(key, "INT(") && strings.HasSuffix(key, ")") {
+				name = key[len("INT(") : len(key)-1]
+			}
+			vars = append(vars, s.variable(name, v.Elems[key]))
+		}
+	case *ast.StructLiteralNode:
+		for _, field := range v.Fields {
+			vars = append(vars, s.variable(field.Name, field.Value))
+		}
+	}
+	return map[string]any{"variables": vars}
+}
+
+func (s *Server) variable(name string, val ast.Node) Variable {
+	return Variable{Name: name, Value: evaluator.FormatValue(val), Type: typeName(val), VariablesReference: s.ref(val)}
+}
+
+func typeName(val ast.Node) string {
+	switch v := val.(type) {
+	case *ast.IntLiteralNode:
+		return "int"
+	case *ast.FloatLiteralNode:
+		return "float"
+	case *ast.StringLiteralNode:
+		return "string"
+	case *ast.BoolLiteralNode:
+		return "bool"
+	case *ast.NullLiteralNode:
+		return "null"
+	case *ast.ArrLiteralNode:
+		return "array"
+	case *ast.StructLiteralNode:
+		return v.Name
+	case *evaluator.Module:
+		return "module"
+	}
+	return ""
+}
+
+// Only variable names can be evaluated, running code while paused could change the program
+func (s *Server) evaluate(args evaluateArguments) map[string]any {
+	stack, unlock := s.stopped()
+	defer unlock()
+	f := stack[len(stack)-1]
+	if args.FrameID != 0 {
+		f = frameAt(stack, args.FrameID)
+	}
+	name := strings.TrimSpace(args.Expression)
+	val, ok := f.Lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] No variable %q in this frame", name))
+	}
+	return map[string]any{"result": evaluator.FormatValue(val), "type": typeName(val), "variablesReference": s.ref(val)}
+}
+
+// Sends what the program prints to the client as output events
+type outputWriter struct {
+	s *Server
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.s.event("output", map[string]any{"category": "stdout", "output": string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,194 @@
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/evaluator"
+	"toy_lang/lexer"
+	"toy_lang/parser"
+)
+
+// Run runs a program's source through the lexer, parser and evaluator. A program that doesn't parse fails
+// with the parser's error
+func Run(p Program) (res Result) {
+	var out bytes.Buffer
+	in := evaluator.NewInterpreter()
+	in.Out = &out
+	in.In = strings.NewReader("")
+	defer func() {
+		if r := recover(); r != nil {
+			res.Err = strings.TrimSpace(fmt.Sprint(r))
+		}
+		res.Out = out.String()
+		res.Vars = make(map[string]string, len(in.MainScope.Vars))
+		for name, val := range in.MainScope.Vars {
+			res.Vars[name] = describe(val)
+		}
+	}()
+	program := parser.NewParser().Parse(lexer.NewLexer().Lex(p.Source()))
+	in.Execute(program, false)
+	return res
+}
+
+// Like Value.Describe for the evaluator's values
+func describe(val ast.Node) string {
+	switch v := val.(type) {
+	case *ast.IntLiteralNode:
+		return "int " + strconv.Itoa(v.Value)
+	case *ast.FloatLiteralNode:
+		return "float " + strconv.FormatFloat(v.Value, 'f', -1, 64)
+	case *ast.StringLiteralNode:
+		return "string " + strconv.Quote(v.Value)
+	case *ast.BoolLiteralNode:
+		return "bool " + strconv.FormatBool(v.Value)
+	case *ast.NullLiteralNode:
+		return "null"
+	}
+	return fmt.Sprintf("%T %v", val, val)
+}
+
+// Mismatch is a program the evaluator and the reference disagree on
+type Mismatch struct {
+	Program Program
+	Want    Result
+	Got     Result
+}
+
+// Check runs a program both ways, they agree when they print the same, end with the same variables and both
+// fail or both succeed. Error messages aren't compared, only the reference's are written to match the language
+func Check(p Program) *Mismatch {
+	want, got := Reference(p), Run(p)
+	if want.Out == got.Out && (want.Err == "") == (got.Err == "") && sameVars(want.Vars, got.Vars) {
+		return nil
+	}
+	return &Mismatch{Program: p, Want: want, Got: got}
+}
+
+func sameVars(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, val := range a {
+		if other, ok := b[name]; !ok || other != val {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Mismatch) Error() string {
+	var b strings.Builder
+	b.WriteString("program:\n")
+	for _, line := range strings.Split(strings.TrimSuffix(m.Program.Source(), "\n"), "\n") {
+		b.WriteString("    " + line + "\n")
+	}
+	writeResult(&b, "reference", m.Want)
+	writeResult(&b, "evaluator", m.Got)
+	return b.String()
+}
+
+func writeResult(b *strings.Builder, name string, res Result) {
+	fmt.Fprintf(b, "%v:\n    output: %q\n", name, res.Out)
+	names := make([]string, 0, len(res.Vars))
+	for name := range res.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(b, "    %v = %v\n", name, res.Vars[name])
+	}
+	if res.Err != "" {
+		fmt.Fprintf(b, "    error: %v\n", res.Err)
+	}
+}
+
+// Minimize shrinks a program for as long as fails is true for it. It drops statements and replaces
+// expressions with their operands or simple literals, trying the smallest change first, until no change
+// keeps fails true
+func Minimize(p Program, fails func(Program) bool) Program {
+	for changed := true; changed; {
+		changed = false
+		for j := len(p.Stmts) - 1; j >= 0; j-- {
+			smaller := Program{Stmts: append(append([]Stmt{}, p.Stmts[:j]...), p.Stmts[j+1:]...)}
+			if fails(smaller) {
+				p, changed = smaller, true
+			}
+		}
+		for j := 0; j < len(p.Stmts); j++ {
+			for _, stmt := range shrinkStmt(p.Stmts[j]) {
+				smaller := Program{Stmts: append([]Stmt{}, p.Stmts...)}
+				smaller.Stmts[j] = stmt
+				if fails(smaller) {
+					p, changed = smaller, true
+					break
+				}
+			}
+		}
+	}
+	return p
+}
+
+// The statement with its expression shrunk a step in every way it can be
+func shrinkStmt(stmt Stmt) []Stmt {
+	var stmts []Stmt
+	switch s := stmt.(type) {
+	case *Let:
+		for _, x := range shrinkExpr(s.X) {
+			stmts = append(stmts, &Let{Name: s.Name, X: x})
+		}
+	case *Assign:
+		if s.Step {
+			return nil
+		}
+		for _, x := range shrinkExpr(s.X) {
+			stmts = append(stmts, &Assign{Name: s.Name, Op: s.Op, X: x})
+		}
+	case *Print:
+		for _, x := range shrinkExpr(s.X) {
+			stmts = append(stmts, &Print{X: x, Line: s.Line})
+		}
+	}
+	return stmts
+}
+
+// Smaller versions of an expression, first the ones that replace all of it
+func shrinkExpr(e Expr) []Expr {
+	var exprs []Expr
+	switch e := e.(type) {
+	case *Lit:
+		if e.Val != IntVal(0) {
+			exprs = append(exprs, &Lit{IntVal(0)})
+		}
+		return exprs
+	case *Var:
+		return []Expr{&Lit{IntVal(0)}}
+	case *Group:
+		exprs = append(exprs, e.X)
+		for _, x := range shrinkExpr(e.X) {
+			exprs = append(exprs, &Group{X: x})
+		}
+	case *Neg:
+		exprs = append(exprs, e.X)
+		for _, x := range shrinkExpr(e.X) {
+			exprs = append(exprs, &Neg{X: x})
+		}
+	case *Not:
+		exprs = append(exprs, e.X)
+		for _, x := range shrinkExpr(e.X) {
+			exprs = append(exprs, &Not{X: x})
+		}
+	case *Binary:
+		exprs = append(exprs, e.L, e.R)
+		for _, l := range shrinkExpr(e.L) {
+			exprs = append(exprs, &Binary{Op: e.Op, L: l, R: e.R})
+		}
+		for _, r := range shrinkExpr(e.R) {
+			exprs = append(exprs, &Binary{Op: e.Op, L: e.L, R: r})
+		}
+	}
+	return append(exprs, &Lit{IntVal(0)}, &Lit{IntVal(1)})
+}
@@ -0,0 +1,112 @@
+package difftest
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var (
+	programs = flag.Int("programs", 500, "number of random programs TestDifferential checks")
+	seed     = flag.Int64("seed", 1, "seed of the first random program, program n uses seed+n")
+)
+
+func TestReference(t *testing.T) {
+	v := func(name string) Expr { return &Var{Name: name} }
+	i := func(n int) Expr { return &Lit{IntVal(n)} }
+	tests := []struct {
+		program Program
+		source  string
+		out     string
+		err     bool
+		id      int
+	}{
+		{
+			program: Program{Stmts: []Stmt{
+				&Let{Name: "a", X: &Binary{Op: "-", L: &Binary{Op: "-", L: i(10), R: i(3)}, R: i(2)}},
+				&Print{X: v("a"), Line: true},
+			}},
+			source: "let a = 10 - 3 - 2;\nprintln(a);\n",
+			out:    "5\n",
+			id:     1,
+		},
+		{
+			program: Program{Stmts: []Stmt{
+				&Let{Name: "a", X: i(3)},
+				&Print{X: &Binary{Op: "*", L: v("a"), R: &Neg{X: &Binary{Op: "+", L: i(1), R: i(1)}}}, Line: true},
+				&Print{X: &Binary{Op: "-", L: i(2), R: &Neg{X: &Neg{X: i(3)}}}, Line: true},
+			}},
+			source: "let a = 3;\nprintln(a * -(1 + 1));\nprintln(2 - - -3);\n",
+			out:    "-6\n-1\n",
+			id:     2,
+		},
+		{
+			program: Program{Stmts: []Stmt{
+				&Print{X: &Binary{Op: "+", L: &Binary{Op: "+", L: i(1), R: i(2)}, R: &Lit{StringVal("a")}}, Line: true},
+				&Print{X: &Binary{Op: "==", L: i(1), R: &Lit{FloatVal(1)}}, Line: true},
+				&Print{X: &Binary{Op: "**", L: i(2), R: &Binary{Op: "**", L: i(3), R: i(2)}}, Line: true},
+			}},
+			source: "println(1 + 2 + \"a\");\nprintln(1 == 1.0);\nprintln(2 ** 3 ** 2);\n",
+			out:    "3a\nfalse\n512\n",
+			id:     3,
+		},
+		{
+			program: Program{Stmts: []Stmt{
+				&Let{Name: "a", X: &Lit{FloatVal(1.5)}},
+				&Assign{Name: "a", Op: "+", X: i(1), Step: true},
+				&Print{X: v("a"), Line: true},
+				&Print{X: &Binary{Op: "/", L: i(1), R: i(0)}},
+				&Print{X: i(2)},
+			}},
+			source: "let a = 1.5;\na++;\nprintln(a);\nprint(1 / 0);\nprint(2);\n",
+			out:    "2.5\n",
+			err:    true,
+			id:     4,
+		},
+	}
+
+	for _, tt := range tests {
+		res := Reference(tt.program)
+		if source := tt.program.Source(); source != tt.source || res.Out != tt.out || (res.Err != "") != tt.err {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %q %q %q\nWant: %q %q error=%v\n", tt.id, source, res.Out, res.Err, tt.source, tt.out, tt.err)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	// Fails while it prints a 7, whatever else it does
+	fails := func(p Program) bool {
+		return Reference(p).Out != "" && Reference(p).Out[len(Reference(p).Out)-1] == '7'
+	}
+	p := Program{Stmts: []Stmt{
+		&Let{Name: "a", X: &Lit{IntVal(3)}},
+		&Print{X: &Lit{StringVal("x")}},
+		&Print{X: &Binary{Op: "+", L: &Binary{Op: "*", L: &Var{Name: "a"}, R: &Lit{IntVal(2)}}, R: &Lit{IntVal(7)}}},
+	}}
+	got := Minimize(p, fails).Source()
+	if want := "print(7);\n"; got != want {
+		t.Errorf("[FAILURE] Test number 1 has failed\nGot: %q\nWant: %q\n", got, want)
+	} else {
+		fmt.Printf("\033[32m[PASS] Test number 1 has passed\033[0m\n")
+	}
+}
+
+// Runs random programs through the evaluator and the reference, a mismatch is shrunk before it is reported.
+// Use -programs and -seed to run more of them
+func TestDifferential(t *testing.T) {
+	failures := 0
+	for n := int64(0); n < int64(*programs) && failures < 5; n++ {
+		p := Generate(rand.New(rand.NewSource(*seed+n)), 12)
+		if m := Check(p); m != nil {
+			failures++
+			small := Minimize(p, func(p Program) bool { return Check(p) != nil })
+			t.Errorf("[FAILURE] Program with seed %d disagrees with the reference, shrunk to\n%v", *seed+n, Check(small))
+		}
+	}
+	if failures == 0 {
+		fmt.Printf("\033[32m[PASS] %d random programs agree with the reference\033[0m\n", *programs)
+	}
+}
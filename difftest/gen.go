@@ -0,0 +1,383 @@
+package difftest
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Expr is an expression of the core language
+type Expr interface{ expr() }
+
+type Lit struct{ Val Value }
+type Var struct{ Name string }
+
+// Group is an expression in parentheses that aren't needed, the parser keeps them in the tree
+type Group struct{ X Expr }
+type Neg struct{ X Expr }
+type Not struct{ X Expr }
+type Binary struct {
+	Op   string
+	L, R Expr
+}
+
+func (*Lit) expr()    {}
+func (*Var) expr()    {}
+func (*Group) expr()  {}
+func (*Neg) expr()    {}
+func (*Not) expr()    {}
+func (*Binary) expr() {}
+
+// Stmt is a statement of the core language
+type Stmt interface{ stmt() }
+
+type Let struct {
+	Name string
+	X    Expr
+}
+
+// Assign sets a variable, Op is "" for = and the operator of a compound assignment like += otherwise. Step
+// writes x += 1 as x++ and x -= 1 as x--
+type Assign struct {
+	Name string
+	Op   string
+	X    Expr
+	Step bool
+}
+
+// Print is print or, with Line, println
+type Print struct {
+	X    Expr
+	Line bool
+}
+
+func (*Let) stmt()    {}
+func (*Assign) stmt() {}
+func (*Print) stmt()  {}
+
+type Program struct {
+	Stmts []Stmt
+}
+
+// Binding power of the operators, the same order as the parser's: || < && < comparisons < + - < * / % <
+// unary - < ** < !
+var precedence = map[string]int{
+	"||": 1, "&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+	"**": 7,
+}
+
+const (
+	negPrec  = 6
+	notPrec  = 8
+	atomPrec = 9
+)
+
+// Source writes the program as toy code, one statement per line
+func (p Program) Source() string {
+	var b strings.Builder
+	for _, stmt := range p.Stmts {
+		switch s := stmt.(type) {
+		case *Let:
+			fmt.Fprintf(&b, "let %v = %v;\n", s.Name, Source(s.X))
+		case *Assign:
+			switch {
+			case s.Step:
+				fmt.Fprintf(&b, "%v%v%v;\n", s.Name, s.Op, s.Op)
+			default:
+				fmt.Fprintf(&b, "%v %v= %v;\n", s.Name, s.Op, Source(s.X))
+			}
+		case *Print:
+			name := "print"
+			if s.Line {
+				name = "println"
+			}
+			fmt.Fprintf(&b, "%v(%v);\n", name, Source(s.X))
+		}
+	}
+	return b.String()
+}
+
+// Source writes an expression with only the parentheses its precedence needs, and the ones of Groups
+func Source(e Expr) string {
+	text, _, _ := source(e)
+	return text
+}
+
+// Returns the text of an expression, the precedence of the operator the parser splits it on and the loosest
+// binary operator outside parentheses. The parser only splits on a prefix operator at the start of what it
+// parses, so after another operator only the binary ones count
+func source(e Expr) (text string, first, inner int) {
+	switch e := e.(type) {
+	case *Lit:
+		return literal(e.Val), atomPrec, atomPrec
+	case *Var:
+		return e.Name, atomPrec, atomPrec
+	case *Group:
+		return "(" + Source(e.X) + ")", atomPrec, atomPrec
+	case *Neg:
+		x, inner := prefixOperand(e.X, negPrec)
+		if strings.HasPrefix(x, "-") {
+			// --x would be a decrement
+			return "- " + x, negPrec, inner
+		}
+		return "-" + x, negPrec, inner
+	case *Not:
+		x, inner := prefixOperand(e.X, notPrec)
+		return "!" + x, notPrec, inner
+	case *Binary:
+		p := precedence[e.Op]
+		// Operators group to the left except **, so the side they don't group on also needs parentheses at
+		// the same precedence
+		right := e.Op == "**"
+		l, first, _ := source(e.L)
+		if first < p || (right && first == p) {
+			l = "(" + l + ")"
+		}
+		r, _, inner := source(e.R)
+		if inner < p || (!right && inner == p) {
+			r = "(" + r + ")"
+		}
+		return l + " " + e.Op + " " + r, p, p
+	}
+	panic(fmt.Sprintf("unknown expression %T", e))
+}
+
+// The operand of a prefix operator, in parentheses if a binary operator in it binds looser than the prefix
+func prefixOperand(e Expr, p int) (string, int) {
+	text, _, inner := source(e)
+	if inner < p {
+		return "(" + text + ")", atomPrec
+	}
+	return text, inner
+}
+
+func literal(v Value) string {
+	switch v.Kind {
+	case Float:
+		text := strconv.FormatFloat(v.Float, 'f', -1, 64)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+		return text
+	case String:
+		return "\"" + v.Str + "\""
+	}
+	return v.Text()
+}
+
+// Generate makes a random program of n statements. Expressions mostly have the kinds their operators need so
+// programs get past their first statements, a few are wrong on purpose to check errors
+func Generate(r *rand.Rand, n int) Program {
+	g := &generator{r: r, kinds: make(map[string]Kind)}
+	var p Program
+	for len(p.Stmts) < n {
+		p.Stmts = append(p.Stmts, g.stmt())
+	}
+	return p
+}
+
+type generator struct {
+	r *rand.Rand
+	// The kind each variable has if the program gets to where the generator is
+	kinds map[string]Kind
+	names []string
+}
+
+const maxDepth = 3
+
+var (
+	arithOps   = []string{"+", "-", "*", "/", "%"}
+	compareOps = []string{"<", "<=", ">", ">="}
+	allOps     = []string{"+", "-", "*", "/", "%", "**", "==", "!=", "<", "<=", ">", ">=", "&&", "||"}
+	words      = []string{"", "a", "b", "ab", "toy", "Z"}
+)
+
+func (g *generator) stmt() Stmt {
+	switch n := g.r.Intn(20); {
+	case n < 7 || len(g.names) == 0:
+		name := fmt.Sprintf("v%d", len(g.names))
+		kind := g.kind()
+		x := g.expr(kind, maxDepth)
+		g.names = append(g.names, name)
+		g.kinds[name] = kind
+		return &Let{Name: name, X: x}
+	case n < 9:
+		name := g.pick()
+		kind := g.kind()
+		g.kinds[name] = kind
+		return &Assign{Name: name, X: g.expr(kind, maxDepth)}
+	case n < 12:
+		return g.compound(g.pick())
+	case n < 19:
+		return &Print{X: g.expr(g.kind(), maxDepth), Line: true}
+	default:
+		return &Print{X: g.expr(g.kind(), maxDepth)}
+	}
+}
+
+func (g *generator) compound(name string) Stmt {
+	kind := g.kinds[name]
+	switch kind {
+	case String:
+		return &Assign{Name: name, Op: "+", X: g.expr(g.kind(), maxDepth-1)}
+	case Int, Float:
+		if g.r.Intn(4) == 0 {
+			op := []string{"+", "-"}[g.r.Intn(2)]
+			return &Assign{Name: name, Op: op, X: &Lit{IntVal(1)}, Step: true}
+		}
+		op := arithOps[g.r.Intn(len(arithOps))]
+		x, xKind := g.number(maxDepth - 1)
+		if op == "/" || op == "%" {
+			x, xKind = g.divisor()
+		}
+		if xKind == Float {
+			g.kinds[name] = Float
+		}
+		return &Assign{Name: name, Op: op, X: x}
+	}
+	// Bools can't be added to, the assignment fails
+	return &Assign{Name: name, Op: "+", X: &Lit{IntVal(1)}}
+}
+
+func (g *generator) pick() string {
+	return g.names[g.r.Intn(len(g.names))]
+}
+
+func (g *generator) kind() Kind {
+	if g.r.Intn(30) == 0 {
+		return Null
+	}
+	return []Kind{Int, Int, Float, String, Bool}[g.r.Intn(5)]
+}
+
+// An expression of the given kind
+func (g *generator) expr(kind Kind, depth int) Expr {
+	if depth <= 0 || g.r.Intn(4) == 0 {
+		return g.leaf(kind)
+	}
+	if g.r.Intn(30) == 0 {
+		// Anything goes, most of these fail
+		op := allOps[g.r.Intn(len(allOps))]
+		if op == "**" {
+			return &Binary{Op: op, L: g.expr(g.kind(), depth-1), R: g.exponent()}
+		}
+		return &Binary{Op: op, L: g.expr(g.kind(), depth-1), R: g.expr(g.kind(), depth-1)}
+	}
+	if g.r.Intn(12) == 0 {
+		return &Group{X: g.expr(kind, depth-1)}
+	}
+
+	switch kind {
+	case Int:
+		switch g.r.Intn(6) {
+		case 0:
+			return &Neg{X: g.expr(Int, depth-1)}
+		case 1:
+			return &Binary{Op: "**", L: g.expr(Int, depth-1), R: g.exponent()}
+		case 2:
+			op := []string{"/", "%"}[g.r.Intn(2)]
+			if x, xKind := g.divisor(); xKind == Int {
+				return &Binary{Op: op, L: g.expr(Int, depth-1), R: x}
+			}
+		}
+		op := []string{"+", "-", "*"}[g.r.Intn(3)]
+		return &Binary{Op: op, L: g.expr(Int, depth-1), R: g.expr(Int, depth-1)}
+	case Float:
+		switch g.r.Intn(6) {
+		case 0:
+			return &Neg{X: g.expr(Float, depth-1)}
+		case 1:
+			return &Binary{Op: "**", L: g.expr(Float, depth-1), R: g.exponent()}
+		}
+		op := arithOps[g.r.Intn(len(arithOps))]
+		other, _ := g.number(depth - 1)
+		if g.r.Intn(2) == 0 {
+			return &Binary{Op: op, L: g.expr(Float, depth-1), R: other}
+		}
+		return &Binary{Op: op, L: other, R: g.expr(Float, depth-1)}
+	case String:
+		other := g.expr(g.kind(), depth-1)
+		if g.r.Intn(2) == 0 {
+			return &Binary{Op: "+", L: g.expr(String, depth-1), R: other}
+		}
+		return &Binary{Op: "+", L: other, R: g.expr(String, depth-1)}
+	case Bool:
+		switch g.r.Intn(5) {
+		case 0:
+			l, _ := g.number(depth - 1)
+			r, _ := g.number(depth - 1)
+			return &Binary{Op: compareOps[g.r.Intn(len(compareOps))], L: l, R: r}
+		case 1:
+			return &Binary{Op: compareOps[g.r.Intn(len(compareOps))], L: g.expr(String, depth-1), R: g.expr(String, depth-1)}
+		case 2:
+			// Of the same kind half the time so they can be equal
+			lKind, rKind := g.kind(), g.kind()
+			if g.r.Intn(2) == 0 {
+				rKind = lKind
+			}
+			op := []string{"==", "!="}[g.r.Intn(2)]
+			return &Binary{Op: op, L: g.expr(lKind, depth-1), R: g.expr(rKind, depth-1)}
+		case 3:
+			op := []string{"&&", "||"}[g.r.Intn(2)]
+			return &Binary{Op: op, L: g.expr(g.kind(), depth-1), R: g.expr(g.kind(), depth-1)}
+		}
+		return &Not{X: g.expr(g.kind(), depth-1)}
+	}
+	return g.leaf(kind)
+}
+
+// An int or a float expression
+func (g *generator) number(depth int) (Expr, Kind) {
+	kind := []Kind{Int, Float}[g.r.Intn(2)]
+	return g.expr(kind, depth), kind
+}
+
+// Something to divide by, mostly a literal that isn't 0 so the program goes on
+func (g *generator) divisor() (Expr, Kind) {
+	if g.r.Intn(8) == 0 {
+		return g.number(1)
+	}
+	if g.r.Intn(3) == 0 {
+		return &Lit{FloatVal(float64(g.r.Intn(8)+1) / 2)}, Float
+	}
+	return &Lit{IntVal(g.r.Intn(9) + 1)}, Int
+}
+
+// A small exponent, ints loop once per power
+func (g *generator) exponent() Expr {
+	return &Lit{IntVal(g.r.Intn(4))}
+}
+
+// A literal or a variable of the kind
+func (g *generator) leaf(kind Kind) Expr {
+	if g.r.Intn(2) == 0 {
+		var names []string
+		for _, name := range g.names {
+			if g.kinds[name] == kind {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			return &Var{Name: names[g.r.Intn(len(names))]}
+		}
+	}
+	switch kind {
+	case Int:
+		if g.r.Intn(20) == 0 {
+			// Big enough for * to overflow
+			return &Lit{IntVal(g.r.Intn(1 << 40))}
+		}
+		return &Lit{IntVal(g.r.Intn(21))}
+	case Float:
+		return &Lit{FloatVal(float64(g.r.Intn(41)) / 4)}
+	case String:
+		return &Lit{StringVal(words[g.r.Intn(len(words))])}
+	case Bool:
+		return &Lit{BoolVal(g.r.Intn(2) == 0)}
+	}
+	return &Lit{NullVal()}
+}
@@ -0,0 +1,297 @@
+// Package difftest checks the evaluator against a small reference evaluator. Programs in the core of the
+// language (literals, arithmetic, comparisons, strings and variables) are generated as trees, written out as
+// toy source for the real lexer, parser and evaluator, and evaluated straight from the tree by Reference,
+// which shares no code with them
+package difftest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+type Kind int
+
+const (
+	Int Kind = iota
+	Float
+	String
+	Bool
+	Null
+)
+
+func (k Kind) String() string {
+	return [...]string{"int", "float", "string", "bool", "null"}[k]
+}
+
+// Value is a value of the core language
+type Value struct {
+	Kind  Kind
+	Int   int
+	Float float64
+	Str   string
+	Bool  bool
+}
+
+func IntVal(n int) Value       { return Value{Kind: Int, Int: n} }
+func FloatVal(f float64) Value { return Value{Kind: Float, Float: f} }
+func StringVal(s string) Value { return Value{Kind: String, Str: s} }
+func BoolVal(b bool) Value     { return Value{Kind: Bool, Bool: b} }
+func NullVal() Value           { return Value{Kind: Null} }
+func (v Value) isNumber() bool { return v.Kind == Int || v.Kind == Float }
+func (v Value) number() float64 {
+	if v.Kind == Int {
+		return float64(v.Int)
+	}
+	return v.Float
+}
+
+// Text is the value the way print shows it
+func (v Value) Text() string {
+	switch v.Kind {
+	case Int:
+		return strconv.Itoa(v.Int)
+	case Float:
+		return strconv.FormatFloat(v.Float, 'f', -1, 64)
+	case String:
+		return v.Str
+	case Bool:
+		return strconv.FormatBool(v.Bool)
+	}
+	return "null"
+}
+
+// Describe is the kind and the value, print shows 3.0 as 3 so the kind is needed to tell it from an int
+func (v Value) Describe() string {
+	switch v.Kind {
+	case String:
+		return "string " + strconv.Quote(v.Str)
+	case Null:
+		return "null"
+	}
+	return v.Kind.String() + " " + v.Text()
+}
+
+func (v Value) truthy() bool {
+	switch v.Kind {
+	case Int:
+		return v.Int != 0
+	case Float:
+		return v.Float != 0
+	case String:
+		return v.Str != ""
+	case Bool:
+		return v.Bool
+	}
+	return false
+}
+
+// Result is what running a program did. When it failed, Out and Vars are what it had done until then
+type Result struct {
+	Out string
+	// Every variable at the top level, written with Value.Describe
+	Vars map[string]string
+	// The error that stopped the program, "" if it ran to the end
+	Err string
+}
+
+// A runtime error of the reference evaluator
+type refError string
+
+// Reference runs a program the way the language is meant to work
+func Reference(p Program) (res Result) {
+	vars := make(map[string]Value)
+	var out []byte
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(refError)
+			if !ok {
+				panic(r)
+			}
+			res.Err = string(err)
+		}
+		res.Out = string(out)
+		res.Vars = make(map[string]string, len(vars))
+		for name, val := range vars {
+			res.Vars[name] = val.Describe()
+		}
+	}()
+
+	for _, stmt := range p.Stmts {
+		switch s := stmt.(type) {
+		case *Let:
+			vars[s.Name] = eval(s.X, vars)
+		case *Assign:
+			old, ok := vars[s.Name]
+			if !ok {
+				panic(refError("undefined variable " + s.Name))
+			}
+			if s.Op == "" {
+				vars[s.Name] = eval(s.X, vars)
+			} else {
+				vars[s.Name] = binary(s.Op, old, eval(s.X, vars))
+			}
+		case *Print:
+			out = append(out, eval(s.X, vars).Text()...)
+			if s.Line {
+				out = append(out, '\n')
+			}
+		}
+	}
+	return res
+}
+
+func eval(e Expr, vars map[string]Value) Value {
+	switch e := e.(type) {
+	case *Lit:
+		return e.Val
+	case *Var:
+		val, ok := vars[e.Name]
+		if !ok {
+			panic(refError("undefined variable " + e.Name))
+		}
+		return val
+	case *Group:
+		return eval(e.X, vars)
+	case *Neg:
+		return binary("-", IntVal(0), eval(e.X, vars))
+	case *Not:
+		return BoolVal(!eval(e.X, vars).truthy())
+	case *Binary:
+		left := eval(e.L, vars)
+		// && and || only look at the right side when the left one doesn't decide
+		switch e.Op {
+		case "&&":
+			return BoolVal(left.truthy() && eval(e.R, vars).truthy())
+		case "||":
+			return BoolVal(left.truthy() || eval(e.R, vars).truthy())
+		}
+		return binary(e.Op, left, eval(e.R, vars))
+	}
+	panic(fmt.Sprintf("unknown expression %T", e))
+}
+
+func binary(op string, l, r Value) Value {
+	switch op {
+	case "==":
+		return BoolVal(equal(l, r))
+	case "!=":
+		return BoolVal(!equal(l, r))
+	case "<", "<=", ">", ">=":
+		c := compare(op, l, r)
+		switch op {
+		case "<":
+			return BoolVal(c < 0)
+		case "<=":
+			return BoolVal(c <= 0)
+		case ">":
+			return BoolVal(c > 0)
+		}
+		return BoolVal(c >= 0)
+	}
+
+	if l.Kind == String || r.Kind == String {
+		if op != "+" {
+			panic(refError("only + works on strings"))
+		}
+		return StringVal(l.Text() + r.Text())
+	}
+	if !l.isNumber() || !r.isNumber() {
+		panic(refError(fmt.Sprintf("can't use %v on %v and %v", op, l.Kind, r.Kind)))
+	}
+	if l.Kind == Int && r.Kind == Int {
+		a, b := l.Int, r.Int
+		switch op {
+		case "+":
+			return IntVal(a + b)
+		case "-":
+			return IntVal(a - b)
+		case "*":
+			return IntVal(a * b)
+		case "/", "%":
+			if b == 0 {
+				panic(refError("integer divide by zero"))
+			}
+			if op == "/" {
+				return IntVal(a / b)
+			}
+			return IntVal(a % b)
+		case "**":
+			if b < 0 {
+				panic(refError("negative exponent"))
+			}
+			n := 1
+			for ; b > 0; b-- {
+				n *= a
+			}
+			return IntVal(n)
+		}
+	}
+	a, b := l.number(), r.number()
+	switch op {
+	case "+":
+		return FloatVal(a + b)
+	case "-":
+		return FloatVal(a - b)
+	case "*":
+		return FloatVal(a * b)
+	case "/":
+		return FloatVal(a / b)
+	case "%":
+		return FloatVal(math.Mod(a, b))
+	case "**":
+		return FloatVal(math.Pow(a, b))
+	}
+	panic(fmt.Sprintf("unknown operator %v", op))
+}
+
+// Values of different kinds are never equal, not even 1 and 1.0
+func equal(l, r Value) bool {
+	if l.Kind != r.Kind {
+		return false
+	}
+	switch l.Kind {
+	case Int:
+		return l.Int == r.Int
+	case Float:
+		return l.Float == r.Float
+	case String:
+		return l.Str == r.Str
+	case Bool:
+		return l.Bool == r.Bool
+	}
+	return true
+}
+
+// Numbers compare with numbers, ints and floats mixed, and strings with strings
+func compare(op string, l, r Value) int {
+	if l.Kind == String && r.Kind == String {
+		switch {
+		case l.Str < r.Str:
+			return -1
+		case l.Str > r.Str:
+			return 1
+		}
+		return 0
+	}
+	if !l.isNumber() || !r.isNumber() {
+		panic(refError(fmt.Sprintf("can't compare %v and %v with %v", l.Kind, r.Kind, op)))
+	}
+	if l.Kind == Int && r.Kind == Int {
+		switch {
+		case l.Int < r.Int:
+			return -1
+		case l.Int > r.Int:
+			return 1
+		}
+		return 0
+	}
+	a, b := l.number(), r.number()
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+	"toy_lang/ast"
+)
+
+// Runs the assert and assertEq builtins, a failed assertion panics with a message that shows what differs
+func (i *Interpreter) callAssert(inode *ast.CallBuiltinNode, local_scope *Scope) ast.Node {
+	if inode.Name == "assert" {
+		val := i.execExpr(inode.Params[0], local_scope)
+		cond, ok := val.(*ast.BoolLiteralNode)
+		if !ok {
+			panic(fmt.Sprintf("[ERROR] assert needs a bool, got %v", FormatValue(val)))
+		}
+		if !cond.Value {
+			// The message says what was being checked, assert(n > 0, "n is positive")
+			switch msg := i.execExpr(inode.Params[1], local_scope).(type) {
+			case *ast.NullLiteralNode:
+				panic("[ERROR] assert failed")
+			case *ast.StringLiteralNode:
+				panic("[ERROR] assert failed: " + msg.Value)
+			default:
+				panic(fmt.Sprintf("[ERROR] assert needs a string message, got %v", FormatValue(msg)))
+			}
+		}
+		return &ast.NullLiteralNode{}
+	}
+
+	got := i.execExpr(inode.Params[0], local_scope)
+	want := i.execExpr(inode.Params[1], local_scope)
+	if !valuesEqual(got, want) {
+		panic("[ERROR] assertEq failed\n" + strings.Join(diffValues(got, want), "\n"))
+	}
+	return &ast.NullLiteralNode{}
+}
+
+// The lines of an assertEq failure, both values and then the elements, fields or lines that differ
+func diffValues(got, want ast.Node) []string {
+	g, gStr := got.(*ast.StringLiteralNode)
+	w, wStr := want.(*ast.StringLiteralNode)
+	if gStr && wStr && (strings.Contains(g.Value, "\n") || strings.Contains(w.Value, "\n")) {
+		return append([]string{"    diff (- got, + want):"}, diffLines(strings.Split(g.Value, "\n"), strings.Split(w.Value, "\n"))...)
+	}
+
+	lines := []string{"    got:  " + FormatValue(got), "    want: " + FormatValue(want)}
+	if got.NodeType() == want.NodeType() && (got.NodeType() == ast.ArrLiteral || got.NodeType() == ast.StructLiteral) {
+		var diffs []string
+		diffElems("", got, want, &diffs)
+		lines = append(lines, "    differences:")
+		for _, d := range diffs {
+			lines = append(lines, "        "+d)
+		}
+	}
+	return lines
+}
+
+// Adds a line for every element or field under path where got and want differ, arrays and structs of the
+// same kind are compared inside
+func diffElems(path string, got, want ast.Node, diffs *[]string) {
+	if valuesEqual(got, want) {
+		return
+	}
+	switch g := got.(type) {
+	case *ast.ArrLiteralNode:
+		if w, ok := want.(*ast.ArrLiteralNode); ok {
+			for _, key := range ast.ElemKeys(g) {
+				if other, ok := w.Elems[key]; ok {
+					diffElems(path+"["+keyName(key)+"]", g.Elems[key], other, diffs)
+				} else {
+					*diffs = append(*diffs, fmt.Sprintf("%v[%v]: got %v, want nothing", path, keyName(key), FormatValue(g.Elems[key])))
+				}
+			}
+			for _, key := range ast.ElemKeys(w) {
+				if _, ok := g.Elems[key]; !ok {
+					*diffs = append(*diffs, fmt.Sprintf("%v[%v]: got nothing, want %v", path, keyName(key), FormatValue(w.Elems[key])))
+				}
+			}
+			return
+		}
+	case *ast.StructLiteralNode:
+		if w, ok := want.(*ast.StructLiteralNode); ok && g.Name == w.Name && len(g.Fields) == len(w.Fields) {
+			for j, field := range g.Fields {
+				diffElems(path+"."+field.Name, field.Value, w.Fields[j].Value, diffs)
+			}
+			return
+		}
+	}
+	*diffs = append(*diffs, fmt.Sprintf("%v: got %v, want %v", path, FormatValue(got), FormatValue(want)))
+}
+
+// Shows an array key the way it is written in an index, keys are stored as the String() of the key value
+func keyName(key string) string {
+	if strings.HasPrefix(key, "INT(") && strings.HasSuffix(key, ")") {
+		return key[len("INT(") : len(key)-1]
+	}
+	if strings.HasPrefix(key, "STRING(") && strings.HasSuffix(key, ")") {
+		return fmt.Sprintf("%q", key[len("STRING("):len(key)-1])
+	}
+	return key
+}
+
+// A line diff from the longest common subsequence, lines only in got start with -, only in want with +
+func diffLines(got, want []string) []string {
+	// common[a][b] is the longest common subsequence of got[a:] and want[b:]
+	common := make([][]int, len(got)+1)
+	for a := range common {
+		common[a] = make([]int, len(want)+1)
+	}
+	for a := len(got) - 1; a >= 0; a-- {
+		for b := len(want) - 1; b >= 0; b-- {
+			if got[a] == want[b] {
+				common[a][b] = common[a+1][b+1] + 1
+			} else {
+				common[a][b] = max(common[a+1][b], common[a][b+1])
+			}
+		}
+	}
+
+	var lines []string
+	a, b := 0, 0
+	for a < len(got) || b < len(want) {
+		switch {
+		case a < len(got) && b < len(want) && got[a] == want[b]:
+			lines = append(lines, "          "+got[a])
+			a++
+			b++
+		case b == len(want) || (a < len(got) && common[a+1][b] >= common[a][b+1]):
+			lines = append(lines, "        - "+got[a])
+			a++
+		default:
+			lines = append(lines, "        + "+want[b])
+			b++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,294 @@
+package evaluator
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/token"
+)
+
+// Coverage is a BranchHook that counts how often each statement ran and each side of every if statement was
+// taken. It is also a ProgramHook, the program of every file that runs gives its statements so the ones that
+// never ran are known. A Coverage can be the hook of several interpreters to add their runs up
+type Coverage struct {
+	files map[string]*FileCoverage
+}
+
+// FileCoverage is the coverage of one file, statements and if statements are in source order
+type FileCoverage struct {
+	Path     string
+	Source   string
+	Stmts    []*StmtCoverage
+	Branches []*BranchCoverage
+
+	stmts    map[token.Position]*StmtCoverage
+	branches map[token.Position]*BranchCoverage
+	// Set once the statements of the file's program have been added
+	collected bool
+}
+
+type StmtCoverage struct {
+	ast.Span
+	Hits int
+}
+
+// BranchCoverage counts the times an if statement ran its body and its else part, a missing else counts as
+// an empty one
+type BranchCoverage struct {
+	ast.Span
+	Then int
+	Else int
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{files: make(map[string]*FileCoverage)}
+}
+
+func (c *Coverage) Statement(stack []*Frame) {
+	top := stack[len(stack)-1]
+	if top.File == "" {
+		return
+	}
+	c.file(top.File).stmt(ast.SpanOf(top.Stmt)).Hits++
+}
+
+func (c *Coverage) Branch(stack []*Frame, stmt *ast.IfStmtNode, taken bool) {
+	file := stack[len(stack)-1].File
+	if file == "" || stmt.Start.Line == 0 {
+		return
+	}
+	b := c.file(file).branch(stmt.Span)
+	if taken {
+		b.Then++
+	} else {
+		b.Else++
+	}
+}
+
+// Files returns the coverage of every file that ran, by path
+func (c *Coverage) Files() []*FileCoverage {
+	files := make([]*FileCoverage, 0, len(c.files))
+	for _, f := range c.files {
+		sort.Slice(f.Stmts, func(a, b int) bool { return f.Stmts[a].Start.Before(f.Stmts[b].Start) })
+		sort.Slice(f.Branches, func(a, b int) bool { return f.Branches[a].Start.Before(f.Branches[b].Start) })
+		files = append(files, f)
+	}
+	sort.Slice(files, func(a, b int) bool { return files[a].Path < files[b].Path })
+	return files
+}
+
+func (c *Coverage) Program(file string, program *ast.ProgramNode) {
+	if file == "" {
+		return
+	}
+	if f := c.file(file); !f.collected {
+		f.collected = true
+		f.collect(program.Statements)
+	}
+}
+
+// The coverage of a file, its source is read the first time it is seen for the HTML report
+func (c *Coverage) file(path string) *FileCoverage {
+	if f, ok := c.files[path]; ok {
+		return f
+	}
+	f := &FileCoverage{
+		Path:     path,
+		stmts:    make(map[token.Position]*StmtCoverage),
+		branches: make(map[token.Position]*BranchCoverage),
+	}
+	c.files[path] = f
+	if source, err := os.ReadFile(path); err == nil {
+		f.Source = string(source)
+	}
+	return f
+}
+
+// Adds the statements of a block and the blocks inside them
+func (f *FileCoverage) collect(stmts []ast.Node) {
+	for _, stmt := range stmts {
+		if span := ast.SpanOf(stmt); span.Start.Line > 0 {
+			f.stmt(span)
+		}
+		f.collectInner(stmt)
+	}
+}
+
+func (f *FileCoverage) collectInner(stmt ast.Node) {
+	switch n := stmt.(type) {
+	case *ast.FuncDecNode:
+		f.collect(n.Body)
+	case *ast.StructDecNode:
+		for _, method := range n.Methods {
+			f.collect(method.Body)
+		}
+	case *ast.IfStmtNode:
+		if n.Start.Line > 0 {
+			f.branch(n.Span)
+		}
+		f.collect(n.Body)
+		f.collect(n.Alt)
+	case *ast.WhileStmtNode:
+		f.collect(n.Body)
+	case *ast.ExportStmtNode:
+		// The export is the statement that runs, what it exports only adds blocks
+		f.collectInner(n.Stmt)
+	}
+}
+
+func (f *FileCoverage) stmt(span ast.Span) *StmtCoverage {
+	s, ok := f.stmts[span.Start]
+	if !ok {
+		s = &StmtCoverage{Span: span}
+		f.stmts[span.Start] = s
+		f.Stmts = append(f.Stmts, s)
+	}
+	return s
+}
+
+func (f *FileCoverage) branch(span ast.Span) *BranchCoverage {
+	b, ok := f.branches[span.Start]
+	if !ok {
+		b = &BranchCoverage{Span: span}
+		f.branches[span.Start] = b
+		f.Branches = append(f.Branches, b)
+	}
+	return b
+}
+
+// Summary counts the statements that ran and the sides of if statements that were taken, every if statement
+// has two sides
+func (f *FileCoverage) Summary() (stmtsRun, stmts, branchesTaken, branches int) {
+	for _, s := range f.Stmts {
+		if s.Hits > 0 {
+			stmtsRun++
+		}
+	}
+	for _, b := range f.Branches {
+		if b.Then > 0 {
+			branchesTaken++
+		}
+		if b.Else > 0 {
+			branchesTaken++
+		}
+	}
+	return stmtsRun, len(f.Stmts), branchesTaken, 2 * len(f.Branches)
+}
+
+// Percent formats part of total, a file without anything to cover shows "-"
+func Percent(part, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(total))
+}
+
+// The times each line ran, the most any statement starting on it ran, and whether something on it was missed
+func (f *FileCoverage) lines() (hits map[int]int, missed map[int]bool) {
+	hits, missed = make(map[int]int), make(map[int]bool)
+	for _, s := range f.Stmts {
+		hits[s.Start.Line] = max(hits[s.Start.Line], s.Hits)
+		if s.Hits == 0 {
+			missed[s.Start.Line] = true
+		}
+	}
+	for _, b := range f.Branches {
+		if b.Then == 0 || b.Else == 0 {
+			missed[b.Start.Line] = true
+		}
+	}
+	return hits, missed
+}
+
+// WriteLcov writes the coverage as an lcov tracefile, the format genhtml and most coverage tools read
+func (c *Coverage) WriteLcov(w io.Writer) {
+	for _, f := range c.Files() {
+		fmt.Fprintf(w, "TN:\nSF:%v\n", f.Path)
+		for j, b := range f.Branches {
+			then, els := "-", "-"
+			if b.Then+b.Else > 0 {
+				then, els = fmt.Sprint(b.Then), fmt.Sprint(b.Else)
+			}
+			fmt.Fprintf(w, "BRDA:%d,%d,0,%v\nBRDA:%d,%d,1,%v\n", b.Start.Line, j, then, b.Start.Line, j, els)
+		}
+		_, _, taken, branches := f.Summary()
+		fmt.Fprintf(w, "BRF:%d\nBRH:%d\n", branches, taken)
+
+		hits, _ := f.lines()
+		lines := make([]int, 0, len(hits))
+		linesHit := 0
+		for line, n := range hits {
+			lines = append(lines, line)
+			if n > 0 {
+				linesHit++
+			}
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			fmt.Fprintf(w, "DA:%d,%d\n", line, hits[line])
+		}
+		fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), linesHit)
+	}
+}
+
+const coverageStyle = `body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 1em; text-align: left; }
+pre { font-family: monospace; line-height: 1.3; }
+.line { display: block; }
+.run { background: #dfd; }
+.partial { background: #ffd; }
+.missed { background: #fdd; }
+.num, .hits { color: #888; display: inline-block; text-align: right; width: 4em; margin-right: 1em; }
+`
+
+// WriteHTML writes a page with a summary table and every file's source, lines that ran are green, lines
+// where nothing ran are red and lines where a statement or a side of an if statement was missed are yellow.
+// Hovering an if statement shows how often each side was taken
+func (c *Coverage) WriteHTML(w io.Writer) {
+	files := c.Files()
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>toy_lang coverage</title>\n<style>\n%v</style>\n</head>\n<body>\n", coverageStyle)
+	fmt.Fprint(w, "<h1>Coverage</h1>\n<table>\n<tr><th>File</th><th>Statements</th><th>Branches</th></tr>\n")
+	for j, f := range files {
+		run, stmts, taken, branches := f.Summary()
+		fmt.Fprintf(w, "<tr><td><a href=\"#file%d\">%v</a></td><td>%v (%d/%d)</td><td>%v (%d/%d)</td></tr>\n",
+			j, html.EscapeString(f.Path), Percent(run, stmts), run, stmts, Percent(taken, branches), taken, branches)
+	}
+	fmt.Fprint(w, "</table>\n")
+
+	for j, f := range files {
+		fmt.Fprintf(w, "<h2 id=\"file%d\">%v</h2>\n<pre>", j, html.EscapeString(f.Path))
+		hits, missed := f.lines()
+		branches := make(map[int][]string)
+		for _, b := range f.Branches {
+			branches[b.Start.Line] = append(branches[b.Start.Line], fmt.Sprintf("if taken %d times, else %d times", b.Then, b.Else))
+		}
+		for n, text := range strings.Split(strings.TrimSuffix(f.Source, "\n"), "\n") {
+			line := n + 1
+			class, count := "line", ""
+			if n, ok := hits[line]; ok {
+				count = fmt.Sprint(n)
+				switch {
+				case n == 0:
+					class += " missed"
+				case missed[line]:
+					class += " partial"
+				default:
+					class += " run"
+				}
+			}
+			title := ""
+			if notes, ok := branches[line]; ok {
+				title = fmt.Sprintf(" title=\"%v\"", strings.Join(notes, "; "))
+			}
+			fmt.Fprintf(w, "<span class=\"%v\"%v><span class=\"num\">%d</span><span class=\"hits\">%v</span>%v</span>",
+				class, title, line, count, html.EscapeString(text))
+		}
+		fmt.Fprint(w, "</pre>\n")
+	}
+	fmt.Fprint(w, "</body>\n</html>\n")
+}
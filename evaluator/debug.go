@@ -0,0 +1,267 @@
+package evaluator
+
+import (
+	"path/filepath"
+	"sort"
+	"toy_lang/ast"
+	"toy_lang/token"
+)
+
+// Frame is one call on the toy call stack, the program's top level and every module being loaded get a
+// frame too
+type Frame struct {
+	// Function name, methods are Struct.method, the top level is <main> and a module is <module file.toy>
+	Name string
+	// Absolute path of the file the code is in, "" for code that isn't in a file
+	File string
+	// The statement about to run, where it starts and the innermost scope it runs in
+	Stmt  ast.Node
+	Pos   token.Position
+	Scope *Scope
+	// The scope the call started with, block scopes inside the call are children of it
+	Base *Scope
+}
+
+// Hook is told about every statement with a source position before it runs. stack is the call stack with the
+// innermost frame last, it is only valid during the call. Hooks run on the interpreter's goroutine so a hook
+// that blocks pauses the program
+type Hook interface {
+	Statement(stack []*Frame)
+}
+
+// DoneHook is a Hook that is also told when a statement has finished, the innermost frame is back on the
+// statement. Statements that end in a runtime error are never done
+type DoneHook interface {
+	Hook
+	StatementDone(stack []*Frame)
+}
+
+// Locals returns the variables of the frame's call, inner blocks hide outer ones
+func (f *Frame) Locals() map[string]ast.Node {
+	vars := make(map[string]ast.Node)
+	for s := f.Scope; s != nil; s = s.Parent {
+		addVars(vars, s)
+		if s == f.Base {
+			break
+		}
+	}
+	return vars
+}
+
+// Globals returns the variables the frame can see from outside its call, without builtins
+func (f *Frame) Globals() map[string]ast.Node {
+	vars := make(map[string]ast.Node)
+	if f.Base == nil {
+		return vars
+	}
+	// The scope without a parent holds the builtins
+	for s := f.Base.Parent; s != nil && s.Parent != nil; s = s.Parent {
+		addVars(vars, s)
+	}
+	return vars
+}
+
+// Lookup finds a variable the way the program would from the frame's current statement
+func (f *Frame) Lookup(name string) (ast.Node, bool) {
+	if f.Scope == nil {
+		return nil, false
+	}
+	return f.Scope.getVar(name)
+}
+
+func addVars(vars map[string]ast.Node, s *Scope) {
+	for name, val := range s.Vars {
+		if _, ok := vars[name]; !ok {
+			vars[name] = val
+		}
+	}
+}
+
+// CallHook is a Hook that is also told when a frame is pushed and popped, the frame is the last one in the stack
+// both times. Frames are popped when a runtime error unwinds them too
+type CallHook interface {
+	Hook
+	Call(stack []*Frame)
+	Return(stack []*Frame)
+}
+
+// BranchHook is a Hook that is also told which way every if statement went, taken is true for the body and
+// false for the else part, which may be empty
+type BranchHook interface {
+	Hook
+	Branch(stack []*Frame, stmt *ast.IfStmtNode, taken bool)
+}
+
+// ProgramHook is a Hook that is also given the parsed program of the main file and of each module before it
+// runs, file is "" for code that isn't in a file
+type ProgramHook interface {
+	Hook
+	Program(file string, program *ast.ProgramNode)
+}
+
+func (i *Interpreter) pushFrame(name string, base *Scope) {
+	i.stack = append(i.stack, &Frame{Name: name, File: i.file, Scope: base, Base: base})
+	if h, ok := i.Hook.(CallHook); ok {
+		h.Call(i.stack)
+	}
+}
+
+func (i *Interpreter) popFrame() {
+	if h, ok := i.Hook.(CallHook); ok {
+		h.Return(i.stack)
+	}
+	i.stack = i.stack[:len(i.stack)-1]
+}
+
+// Records where the innermost frame is and tells the hook, statements made by the interpreter have no
+// position and are skipped. It returns whether the hook was told
+func (i *Interpreter) hookStmt(node ast.Node, local_scope *Scope) bool {
+	pos := ast.SpanOf(node).Start
+	if pos.Line == 0 || len(i.stack) == 0 {
+		return false
+	}
+	top := i.stack[len(i.stack)-1]
+	top.Stmt, top.Pos, top.Scope = node, pos, local_scope
+	i.Hook.Statement(i.stack)
+	return true
+}
+
+// Tells a DoneHook that a statement hookStmt reported has finished, statements inside it moved the frame on
+// so it is put back first
+func (i *Interpreter) stmtDone(node ast.Node, local_scope *Scope) {
+	done, ok := i.Hook.(DoneHook)
+	if !ok {
+		return
+	}
+	top := i.stack[len(i.stack)-1]
+	top.Stmt, top.Pos, top.Scope = node, ast.SpanOf(node).Start, local_scope
+	done.StatementDone(i.stack)
+}
+
+func frameName(f ast.FuncDecNode, self ast.Node) string {
+	if s, ok := self.(*ast.StructLiteralNode); ok {
+		return s.Name + "." + f.Name
+	}
+	return f.Name
+}
+
+func moduleFrameName(path string) string {
+	return "<module " + filepath.Base(path) + ">"
+}
+
+// StepMode says how a paused program carries on
+type StepMode int
+
+const (
+	// Run until the next breakpoint
+	Continue StepMode = iota
+	// Stop at the next statement, inside a call if there is one
+	StepInto
+	// Stop at the next statement of this frame or a caller
+	StepOver
+	// Stop at the next statement of a caller
+	StepOut
+	// End the program, Statement panics with StoppedByDebugger
+	Stop
+)
+
+const StoppedByDebugger = "[ERROR] Program stopped by the debugger"
+
+// Debugger is a Hook that pauses the program at breakpoints and after steps, Pause decides what happens next.
+// A fresh Debugger runs to the first breakpoint, call Step(StepInto) first to stop on the first statement
+type Debugger struct {
+	// Pause is called with the stack when the program stops, reason is "breakpoint" or "step"
+	Pause func(stack []*Frame, reason string) StepMode
+
+	// Lines with breakpoints by absolute file path
+	breakpoints map[string]map[int]bool
+	mode        StepMode
+	// Stack depth when the current step started
+	depth int
+	// The last statement seen, a line with several statements only stops at the first
+	last      token.Position
+	lastFile  string
+	lastDepth int
+}
+
+func NewDebugger(pause func(stack []*Frame, reason string) StepMode) *Debugger {
+	return &Debugger{
+		Pause:       pause,
+		breakpoints: make(map[string]map[int]bool),
+	}
+}
+
+// SetBreakpoint stops the program whenever it reaches line of file, file is made absolute like SetFile does
+func (d *Debugger) SetBreakpoint(file string, line int) {
+	file = absPath(file)
+	if d.breakpoints[file] == nil {
+		d.breakpoints[file] = make(map[int]bool)
+	}
+	d.breakpoints[file][line] = true
+}
+
+func (d *Debugger) ClearBreakpoint(file string, line int) {
+	delete(d.breakpoints[absPath(file)], line)
+}
+
+// ClearBreakpoints removes every breakpoint in file
+func (d *Debugger) ClearBreakpoints(file string) {
+	delete(d.breakpoints, absPath(file))
+}
+
+// Breakpoints returns the lines with breakpoints in file
+func (d *Debugger) Breakpoints(file string) []int {
+	var lines []int
+	for line := range d.breakpoints[absPath(file)] {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Step sets how the program carries on until it next pauses, Pause's result replaces it
+func (d *Debugger) Step(mode StepMode) {
+	d.mode = mode
+}
+
+func (d *Debugger) Statement(stack []*Frame) {
+	top := stack[len(stack)-1]
+	depth := len(stack)
+	// Later statements on a line that was just reached don't count as reaching it again
+	sameLine := d.lastFile == top.File && d.last.Line == top.Pos.Line && d.last.Col < top.Pos.Col && d.lastDepth == depth
+	d.last, d.lastFile, d.lastDepth = top.Pos, top.File, depth
+	if sameLine {
+		return
+	}
+
+	reason := ""
+	switch {
+	case d.mode == StepInto,
+		d.mode == StepOver && depth <= d.depth,
+		d.mode == StepOut && depth < d.depth:
+		reason = "step"
+	case d.breakpoints[top.File][top.Pos.Line]:
+		reason = "breakpoint"
+	default:
+		return
+	}
+
+	mode := Continue
+	if d.Pause != nil {
+		mode = d.Pause(stack, reason)
+	}
+	if mode == Stop {
+		panic(StoppedByDebugger)
+	}
+	d.mode, d.depth = mode, depth
+}
+
+func absPath(path string) string {
+	if path == "" {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
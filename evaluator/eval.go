@@ -3,6 +3,8 @@ package evaluator
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"io/fs"
 	"math/rand"
 	"os"
 
@@ -30,13 +32,39 @@ type ReturnValue struct {
 
 type Interpreter struct {
 	MainScope Scope
-	reader    *bufio.Reader
+	// Where print writes and input reads, nil means os.Stdout and os.Stdin at the time of the call
+	Out io.Writer
+	In  io.Reader
+	// Program arguments returned by args()
+	Args   []string
+	reader *bufio.Reader
+	// Directory imports are resolved against, it changes while a module is loading
+	dir string
+	// Loaded modules by absolute path and the chain of modules currently loading, used to find cycles
+	modules     map[string]*Module
+	importStack []string
+	// Hook is told about each statement before it runs, nil runs the program without tracking the call stack
+	Hook Hook
+	// The toy call stack, only kept while there is a Hook, and the file the running code is in
+	stack []*Frame
+	file  string
+	// Source of randInt, randf, choice and shuffle, nil gets a randomly seeded one the first time it is needed.
+	// Each interpreter has its own so interpreters running at the same time don't affect each other
+	Rand *rand.Rand
+	// Files the file builtins can use, nil allows none. Reading needs an fs.FS and writing a WriteFS like
+	// DirFS(root) or NewMemFS(nil)
+	FS fs.FS
+	// MaxSteps stops a run with an error after this many statements and loop iterations, 0 means no limit
+	MaxSteps int
+	steps    int
 }
 
 func NewInterpreter() Interpreter {
 	builtinScope := Scope{
-		Vars:  make(v_map),
-		Funcs: make(f_map),
+		Vars:    make(v_map),
+		Funcs:   make(f_map),
+		Consts:  make(map[string]bool),
+		Structs: make(map[string]*ast.StructDecNode),
 	}
 	ms := builtinScope.newChild()
 
@@ -109,6 +137,18 @@ func NewInterpreter() Interpreter {
 			},
 		},
 	}
+	builtinScope.Funcs["float"] = ast.FuncDecNode{
+		Name:   "float",
+		Params: []ast.ReferenceExprNode{{Name: "convertToFloat"}},
+		Body: []ast.Node{
+			&ast.ReturnExprNode{
+				Val: &ast.CallBuiltinNode{
+					Name:   "float",
+					Params: []ast.Node{&ast.ReferenceExprNode{Name: "convertToFloat"}},
+				},
+			},
+		},
+	}
 	builtinScope.Funcs["randInt"] = ast.FuncDecNode{
 		Name:   "randInt",
 		Params: []ast.ReferenceExprNode{{Name: "min"}, {Name: "max"}},
@@ -133,6 +173,83 @@ func NewInterpreter() Interpreter {
 			},
 		},
 	}
+	builtinScope.Funcs["seed"] = ast.FuncDecNode{
+		Name:   "seed",
+		Params: []ast.ReferenceExprNode{{Name: "n"}},
+		Body: []ast.Node{
+			&ast.CallBuiltinNode{
+				Name:   "seed",
+				Params: []ast.Node{&ast.ReferenceExprNode{Name: "n"}},
+			},
+		},
+	}
+	builtinScope.Funcs["choice"] = ast.FuncDecNode{
+		Name:   "choice",
+		Params: []ast.ReferenceExprNode{{Name: "arr"}},
+		Body: []ast.Node{
+			&ast.ReturnExprNode{
+				Val: &ast.CallBuiltinNode{
+					Name:   "choice",
+					Params: []ast.Node{&ast.ReferenceExprNode{Name: "arr"}},
+				},
+			},
+		},
+	}
+	builtinScope.Funcs["shuffle"] = ast.FuncDecNode{
+		Name:   "shuffle",
+		Params: []ast.ReferenceExprNode{{Name: "arr"}},
+		Body: []ast.Node{
+			&ast.ReturnExprNode{
+				Val: &ast.CallBuiltinNode{
+					Name:   "shuffle",
+					Params: []ast.Node{&ast.ReferenceExprNode{Name: "arr"}},
+				},
+			},
+		},
+	}
+	// File builtins, they go through Interpreter.FS
+	for name, params := range map[string][]string{
+		"readFile": {"path"}, "writeFile": {"path", "data"}, "appendFile": {"path", "data"},
+		"listDir": {"path"}, "exists": {"path"}, "removeFile": {"path"},
+	} {
+		var paramNodes []ast.ReferenceExprNode
+		var args []ast.Node
+		for _, param := range params {
+			paramNodes = append(paramNodes, ast.ReferenceExprNode{Name: param})
+			args = append(args, &ast.ReferenceExprNode{Name: param})
+		}
+		builtinScope.Funcs[name] = ast.FuncDecNode{
+			Name:   name,
+			Params: paramNodes,
+			Body: []ast.Node{
+				&ast.ReturnExprNode{Val: &ast.CallBuiltinNode{Name: name, Params: args}},
+			},
+		}
+	}
+	builtinScope.Funcs["jsonParse"] = ast.FuncDecNode{
+		Name:   "jsonParse",
+		Params: []ast.ReferenceExprNode{{Name: "text"}},
+		Body: []ast.Node{
+			&ast.ReturnExprNode{
+				Val: &ast.CallBuiltinNode{
+					Name:   "jsonParse",
+					Params: []ast.Node{&ast.ReferenceExprNode{Name: "text"}},
+				},
+			},
+		},
+	}
+	builtinScope.Funcs["jsonStringify"] = ast.FuncDecNode{
+		Name:   "jsonStringify",
+		Params: []ast.ReferenceExprNode{{Name: "value"}, {Name: "indent"}},
+		Body: []ast.Node{
+			&ast.ReturnExprNode{
+				Val: &ast.CallBuiltinNode{
+					Name:   "jsonStringify",
+					Params: []ast.Node{&ast.ReferenceExprNode{Name: "value"}, &ast.ReferenceExprNode{Name: "indent"}},
+				},
+			},
+		},
+	}
 	builtinScope.Funcs["len"] = ast.FuncDecNode{
 		Name: "len",
 		Params: []ast.ReferenceExprNode{{Name: "input"}},
@@ -145,33 +262,103 @@ func NewInterpreter() Interpreter {
 			},
 		},
 	}
+	builtinScope.Funcs["assert"] = ast.FuncDecNode{
+		Name:   "assert",
+		Params: []ast.ReferenceExprNode{{Name: "cond"}, {Name: "msg"}},
+		Body: []ast.Node{
+			&ast.CallBuiltinNode{
+				Name:   "assert",
+				Params: []ast.Node{&ast.ReferenceExprNode{Name: "cond"}, &ast.ReferenceExprNode{Name: "msg"}},
+			},
+		},
+		Optional: 1,
+	}
+	builtinScope.Funcs["assertEq"] = ast.FuncDecNode{
+		Name:   "assertEq",
+		Params: []ast.ReferenceExprNode{{Name: "got"}, {Name: "want"}},
+		Body: []ast.Node{
+			&ast.CallBuiltinNode{
+				Name:   "assertEq",
+				Params: []ast.Node{&ast.ReferenceExprNode{Name: "got"}, &ast.ReferenceExprNode{Name: "want"}},
+			},
+		},
+	}
+	builtinScope.Funcs["args"] = ast.FuncDecNode{
+		Name:   "args",
+		Params: []ast.ReferenceExprNode{},
+		Body: []ast.Node{
+			&ast.ReturnExprNode{
+				Val: &ast.CallBuiltinNode{
+					Name:   "args",
+					Params: []ast.Node{},
+				},
+			},
+		},
+	}
 	return Interpreter{
 		MainScope: *ms,
-		reader:    bufio.NewReader(os.Stdin),
+		modules:   make(map[string]*Module),
 	}
 }
 
 func (i *Interpreter) executeStmt(node ast.Node, local_scope *Scope) any {
+	i.step()
+	if i.Hook != nil && i.hookStmt(node, local_scope) {
+		ret := i.execStmt(node, local_scope)
+		i.stmtDone(node, local_scope)
+		return ret
+	}
+	return i.execStmt(node, local_scope)
+}
+
+// Counts a step of the run against MaxSteps
+func (i *Interpreter) step() {
+	if i.MaxSteps == 0 {
+		return
+	}
+	i.steps++
+	if i.steps > i.MaxSteps {
+		panic(fmt.Sprintf("[ERROR] Program took more than %d steps", i.MaxSteps))
+	}
+}
+
+// Runs a statement without telling the hook, for statements wrapped in another one
+func (i *Interpreter) execStmt(node ast.Node, local_scope *Scope) any {
 	switch node.NodeType() {
 	case ast.LetStmt, ast.VarReassign:
 		i.changeVarVal(node, local_scope)
+	case ast.CompoundAssign:
+		i.execCompoundAssign(node.(*ast.CompoundAssignNode), local_scope)
 	case ast.IfStmt:
 		return i.execIfStmt(node, local_scope)
 	case ast.WhileStmt:
 		return i.execWhileStmt(node, local_scope)
 	case ast.FuncDec:
 		local_scope.declareFunc(*node.(*ast.FuncDecNode))
+	case ast.StructDec:
+		local_scope.declareStruct(node.(*ast.StructDecNode))
+	case ast.FieldReassign:
+		i.execFieldReassign(node.(*ast.FieldReassignNode), local_scope)
+	case ast.MethodCall:
+		return i.execMethodCall(node.(*ast.MethodCallNode), local_scope)
+	case ast.ImportStmt:
+		i.execImport(node.(*ast.ImportStmtNode), local_scope)
+	case ast.ExportStmt:
+		return i.execStmt(node.(*ast.ExportStmtNode).Stmt, local_scope)
 	case ast.FuncCall:
 		return i.execFuncCall(node, local_scope)
 	case ast.CallBuiltin:
 		return i.callBuiltin(node, local_scope)
 	case ast.ReturnExpr:
 		returnNode := node.(*ast.ReturnExprNode)
+		if returnNode.Val == nil {
+			return ReturnValue{Val: &ast.NullLiteralNode{}}
+		}
 		returnVal := i.execExpr(returnNode.Val, local_scope)
 		return ReturnValue{Val: returnVal}
 	case ast.EmptyExpr:
 		child := node.(*ast.EmptyExprNode).Child
-		return i.executeStmt(child, local_scope)
+		return i.execStmt(child, local_scope)
 	default:
 		// For expressions used as statements
 		switch node.(type) {
@@ -190,6 +377,9 @@ func (i *Interpreter) execIfStmt(node ast.Node, local_scope *Scope) interface{}
 	ifStmt := node.(*ast.IfStmtNode)
 	cond := i.execBoolExpr(ifStmt.Cond, local_scope)
 	newScope := local_scope.newChild()
+	if h, ok := i.Hook.(BranchHook); ok && len(i.stack) > 0 {
+		h.Branch(i.stack, ifStmt, cond)
+	}
 
 	if cond {
 		for _, stmt := range ifStmt.Body {
@@ -215,15 +405,29 @@ func (i *Interpreter) execWhileStmt(node ast.Node, local_scope *Scope) interface
 	whileStmt := node.(*ast.WhileStmtNode)
 
 	for i.execBoolExpr(whileStmt.Cond, local_scope) {
+		i.step()
 		bodyScope := local_scope.newChild()
 		for _, stmt := range whileStmt.Body {
+			i.step()
+			// break and continue never reach executeStmt, so the hook is told here
+			hooked := i.Hook != nil && i.hookStmt(stmt, bodyScope)
 			if stmt.NodeType() == ast.BreakSmt {
+				if hooked {
+					i.stmtDone(stmt, bodyScope)
+				}
 				goto EndOfOuter
 			}
 			if stmt.NodeType() == ast.ContinueStmt {
+				if hooked {
+					i.stmtDone(stmt, bodyScope)
+				}
 				goto EndOfInner
 			}
-			if ret := i.executeStmt(stmt, bodyScope); ret != nil {
+			ret := i.execStmt(stmt, bodyScope)
+			if hooked {
+				i.stmtDone(stmt, bodyScope)
+			}
+			if ret != nil {
 				if r, ok := ret.(ReturnValue); ok {
 					return r
 				}
@@ -232,6 +436,9 @@ func (i *Interpreter) execWhileStmt(node ast.Node, local_scope *Scope) interface
 		// Apply body scope changes back
 		for k, v := range bodyScope.Vars {
 			local_scope.Vars[k] = v
+			if bodyScope.Consts[k] {
+				local_scope.Consts[k] = true
+			}
 		}
 	EndOfInner:
 	}
@@ -245,17 +452,40 @@ func (i *Interpreter) execFuncCall(node ast.Node, local_scope *Scope) ast.Node {
 	if !found {
 		panic(fmt.Sprintf("[ERROR] Could not find function %s\n", fCall.Name.Name))
 	}
+	return i.callFunc(f, fCall.Params, local_scope, local_scope, nil, false)
+}
 
-	callScope := local_scope.newChild()
-	if len(f.Params) != len(fCall.Params) {
+// Runs f with args evaluated in local_scope and its body in a child of bodyParent, self is bound to the
+// receiver when f is a method and is constant when the receiver is stored in a constant
+func (i *Interpreter) callFunc(f ast.FuncDecNode, args []ast.Node, local_scope *Scope, bodyParent *Scope, self ast.Node, constSelf bool) ast.Node {
+	callScope := bodyParent.newChild()
+	if f.Optional > 0 && (len(args) < len(f.Params)-f.Optional || len(args) > len(f.Params)) {
+		panic(fmt.Sprintf("[ERROR] Function %s must be called with %d to %d params, got %d\n",
+			f.Name, len(f.Params)-f.Optional, len(f.Params), len(args)))
+	}
+	if f.Optional == 0 && len(f.Params) != len(args) {
 		panic(fmt.Sprintf("[ERROR] Function %s must be called with exactly %d params, got %d\n",
-			f.Name, len(f.Params), len(fCall.Params)))
+			f.Name, len(f.Params), len(args)))
 	}
 
-	// Assign parameters
+	// Assign parameters, each argument gets its own scope so it can't see the parameters bound before it
 	for j, param := range f.Params {
-		letStmt := &ast.LetStmtNode{Name: param.Name, Value: fCall.Params[j]}
-		i.changeVarVal(letStmt, callScope)
+		if j >= len(args) {
+			callScope.declareVar(param.Name, &ast.NullLiteralNode{})
+			continue
+		}
+		argScope := local_scope.newChild()
+		i.assignValue(param.Name, args[j], argScope, true)
+		callScope.declareVar(param.Name, argScope.Vars[param.Name])
+	}
+	if self != nil {
+		callScope.declareVar("self", self)
+		callScope.Consts["self"] = constSelf
+	}
+	// The call starts once its arguments are evaluated, calls made by them are not inside it
+	if i.Hook != nil {
+		i.pushFrame(frameName(f, self), callScope)
+		defer i.popFrame()
 	}
 
 	// Execute function body
@@ -266,7 +496,7 @@ func (i *Interpreter) execFuncCall(node ast.Node, local_scope *Scope) ast.Node {
 			}
 		}
 	}
-	return nil
+	return &ast.NullLiteralNode{}
 }
 
 func (i *Interpreter) callBuiltin(node ast.Node, local_scope *Scope) ast.Node {
@@ -278,31 +508,20 @@ func (i *Interpreter) callBuiltin(node ast.Node, local_scope *Scope) ast.Node {
 			panic(fmt.Sprintf("[ERROR] Builtin %s must be called with 1 argument, got %v", inode.Name, inode))
 		}
 		val := i.execExpr(inode.Params[0], local_scope)
-		var output string
-		switch v := val.(type) {
-		case *ast.StringLiteralNode:
-			output = v.Value
-		case *ast.IntLiteralNode:
-			output = strconv.Itoa(v.Value)
-		case *ast.BoolLiteralNode:
-			output = strconv.FormatBool(v.Value)
-		case *ast.FloatLiteralNode:
-			output = strconv.FormatFloat(v.Value, 'f', -1, 64)
-		case *ast.ArrLiteralNode:
-		default:
-			output = val.String();
+		output := FormatValue(val)
+		if str, ok := val.(*ast.StringLiteralNode); ok {
+			output = str.Value
 		}
 		if inode.Name == "print" {
-			fmt.Print(output)
+			fmt.Fprint(i.stdout(), output)
 		} else {
-			fmt.Println(output)
+			fmt.Fprintln(i.stdout(), output)
 		}
 		return &ast.StringLiteralNode{Value: ""}
 	case "input":
 		promptNode := &ast.CallBuiltinNode{Name: "print", Params: []ast.Node{inode.Params[0]}}
 		i.callBuiltin(promptNode, local_scope)
-		reader := bufio.NewReader(os.Stdin)
-		text, err := reader.ReadString('\n')
+		text, err := i.stdin().ReadString('\n')
 		if err != nil {
 			panic(fmt.Sprintf("[ERROR] Could not read input: %v", err))
 		}
@@ -318,6 +537,12 @@ func (i *Interpreter) callBuiltin(node ast.Node, local_scope *Scope) ast.Node {
 			return &ast.StringLiteralNode{Value: strconv.FormatBool(t.Value)}
 		case *ast.IntLiteralNode:
 			return &ast.StringLiteralNode{Value: strconv.Itoa(t.Value)}
+		case *ast.FloatLiteralNode:
+			return &ast.StringLiteralNode{Value: FormatValue(t)}
+		case *ast.NullLiteralNode:
+			return &ast.StringLiteralNode{Value: "null"}
+		case *ast.StructLiteralNode:
+			return &ast.StringLiteralNode{Value: FormatValue(t)}
 		default:
 			panic(fmt.Sprintf("[ERROR] Cannot convert type %v to string", toConv.NodeType()))
 		}
@@ -332,6 +557,9 @@ func (i *Interpreter) callBuiltin(node ast.Node, local_scope *Scope) ast.Node {
 				v = 1
 			}
 			return &ast.IntLiteralNode{Value: v}
+		case *ast.FloatLiteralNode:
+			// Drops the fraction, int(-2.5) is -2
+			return floatToInt(t.Value)
 		case *ast.StringLiteralNode:
 			val, err := strconv.Atoi(t.Value)
 			if err != nil {
@@ -341,11 +569,35 @@ func (i *Interpreter) callBuiltin(node ast.Node, local_scope *Scope) ast.Node {
 		default:
 			panic(fmt.Sprintf("[ERROR] Cannot convert type %v to int", toConv.NodeType()))
 		}
+	case "float":
+		toConv := i.execExpr(inode.Params[0], local_scope)
+		switch t := toConv.(type) {
+		case *ast.FloatLiteralNode:
+			return t
+		case *ast.IntLiteralNode:
+			return &ast.FloatLiteralNode{Value: float64(t.Value)}
+		case *ast.BoolLiteralNode:
+			v := 0.0
+			if t.Value {
+				v = 1
+			}
+			return &ast.FloatLiteralNode{Value: v}
+		case *ast.StringLiteralNode:
+			val, err := strconv.ParseFloat(t.Value, 64)
+			if err != nil {
+				panic(fmt.Sprintf("[ERROR] Cannot convert string to float: %v", err))
+			}
+			return &ast.FloatLiteralNode{Value: val}
+		default:
+			panic(fmt.Sprintf("[ERROR] Cannot convert type %v to float", toConv.NodeType()))
+		}
 	case "bool":
 		toConv := i.execExpr(inode.Params[0], local_scope)
 		switch t := toConv.(type) {
 		case *ast.BoolLiteralNode:
 			return t
+		case *ast.NullLiteralNode:
+			return &ast.BoolLiteralNode{Value: false}
 		case *ast.IntLiteralNode:
 			return &ast.BoolLiteralNode{Value: t.Value > 0}
 		case *ast.StringLiteralNode:
@@ -356,12 +608,30 @@ func (i *Interpreter) callBuiltin(node ast.Node, local_scope *Scope) ast.Node {
 		default:
 			panic(fmt.Sprintf("[ERROR] Cannot convert type %v to bool", toConv.NodeType()))
 		}
+	case "assert", "assertEq":
+		return i.callAssert(inode, local_scope)
 	case "randInt":
 		min := i.execIntExpr(inode.Params[0], local_scope)
 		max := i.execIntExpr(inode.Params[1], local_scope)
-		//rand.Seed(time.Now().UnixNano())
-		n := rand.Intn(max-min+1) + min
-		return &ast.IntLiteralNode{Value: n}
+		if max < min {
+			panic(fmt.Sprintf("[ERROR] randInt needs min <= max, got %d and %d", min, max))
+		}
+		if span := max - min + 1; span > 0 {
+			return &ast.IntLiteralNode{Value: i.rng().Intn(span) + min}
+		}
+		// The range is wider than the biggest int, so draw from all ints until one is in it
+		for {
+			if n := int(i.rng().Uint64()); n >= min && n <= max {
+				return &ast.IntLiteralNode{Value: n}
+			}
+		}
+	case "seed":
+		i.Seed(int64(i.execIntExpr(inode.Params[0], local_scope)))
+		return &ast.NullLiteralNode{}
+	case "choice":
+		return i.callChoice(inode, local_scope)
+	case "shuffle":
+		return i.callShuffle(inode, local_scope)
 
 	case "randf":
 		min := i.execExpr(inode.Params[0], local_scope)
@@ -385,49 +655,68 @@ func (i *Interpreter) callBuiltin(node ast.Node, local_scope *Scope) ast.Node {
 			maxI := max.(*ast.IntLiteralNode)
 			maxVal = float64(maxI.Value)
 		}
-		return &ast.FloatLiteralNode{Value: minVal + rand.Float64()*(maxVal-minVal)}
+		return &ast.FloatLiteralNode{Value: minVal + i.rng().Float64()*(maxVal-minVal)}
 	case "len":
-		obj := inode.Params[1];
-		if obj.NodeType() == ast.ArrLiteral{
-			arrLitObj := obj.(*ast.ArrLiteralNode);
-			return &ast.IntLiteralNode{Value: len(arrLitObj.Elems)};
-		}
-		if obj.NodeType() == ast.ArrRef{
-			arrRefObj := obj.(*ast.ArrRefNode);
-			arrObj, found := local_scope.getVar(arrRefObj.Arr.Name);
-			if !found{
-				panic(fmt.Sprintf("[ERROR] Variable %v is undefined\n", arrRefObj.Arr.Name));
-			}
-			arrLitObj, ok := arrObj.(*ast.ArrLiteralNode);
-			if !ok{
-				panic(fmt.Sprintf("[ERROR] Variable %v s not an array, it is a %v\n", arrRefObj.Arr.Name, arrObj.NodeType()));
-			}
-			return &ast.IntLiteralNode{Value: len(arrLitObj.Elems)};
-		}
-		if obj.NodeType() == ast.StringLiteral{
-			strLitObj := obj.(*ast.StringLiteralNode);
-			return &ast.IntLiteralNode{Value: len(strLitObj.Value)};
+		switch obj := i.execExpr(inode.Params[0], local_scope).(type) {
+		case *ast.ArrLiteralNode:
+			return &ast.IntLiteralNode{Value: len(obj.Elems)}
+		case *ast.StringLiteralNode:
+			return &ast.IntLiteralNode{Value: len(obj.Value)}
+		default:
+			panic(fmt.Sprintf("[ERROR] len needs an array or a string, got %v", FormatValue(obj)))
 		}
-		if obj.NodeType() == ast.ReferenceExpr{
-			refObj := obj.(*ast.ReferenceExprNode);
-			varLit, found := local_scope.getVar(refObj.Name);
-			if !found{
-				panic(fmt.Sprintf("[ERROR] Var %v is undefined", refObj.Name));
-			}
-			return i.callBuiltin(varLit, local_scope);
+	case "jsonParse", "jsonStringify":
+		return i.callJSON(inode, local_scope)
+	case "readFile", "writeFile", "appendFile", "listDir", "exists", "removeFile":
+		return i.callFileBuiltin(inode, local_scope)
+	case "args":
+		elems := make(map[string]ast.Node)
+		for j, arg := range i.Args {
+			key := ast.IntLiteralNode{Value: j}
+			elems[key.String()] = &ast.StringLiteralNode{Value: arg}
 		}
-		//Assume it is an infix expression
-		return i.callBuiltin(i.execExpr(node, local_scope), local_scope);
+		return &ast.ArrLiteralNode{Elems: elems}
+	}
+	if strings.HasPrefix(inode.Name, "math.") {
+		return i.callMath(inode, local_scope)
 	}
 	panic(fmt.Sprintf("[ERROR] Unknown builtin function %v", inode.Name))
 }
 
+func (i *Interpreter) stdout() io.Writer {
+	if i.Out != nil {
+		return i.Out
+	}
+	return os.Stdout
+}
+
+func (i *Interpreter) stdin() *bufio.Reader {
+	if i.In == nil {
+		// os.Stdin can be swapped between calls, so don't hold on to a reader for it
+		return bufio.NewReader(os.Stdin)
+	}
+	if i.reader == nil {
+		i.reader = bufio.NewReader(i.In)
+	}
+	return i.reader
+}
+
 func (i *Interpreter) Execute(program ast.ProgramNode, should_print bool) Scope {
+	i.steps = 0
+	if i.Hook != nil {
+		// A run that panicked can leave frames behind
+		i.stack = i.stack[:0]
+		i.pushFrame("<main>", &i.MainScope)
+		defer i.popFrame()
+	}
+	if hook, ok := i.Hook.(ProgramHook); ok {
+		hook.Program(i.file, &program)
+	}
 	for _, stmt := range program.Statements {
 		i.executeStmt(stmt, &i.MainScope)
 	}
 	if should_print {
-		fmt.Printf("Main scope: %v\n", i.MainScope)
+		fmt.Fprintf(i.stdout(), "Main scope: %v\n", i.MainScope)
 	}
 	return i.MainScope
 }
@@ -2,9 +2,17 @@ package evaluator
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 	"toy_lang/ast"
 	"toy_lang/lexer"
 	"toy_lang/parser"
@@ -87,8 +95,9 @@ type tEvalRes struct {
 	id        int
 }
 
-func TestEvaluator(t *testing.T) {
-	tests := []tEvalRes{
+// The TestEvaluator cases, FuzzExecute starts from their inputs
+func evaluatorTests() []tEvalRes {
+	return []tEvalRes{
 		{
 			input: "let x = 0",
 			output: map[string]ast.Node{
@@ -487,9 +496,196 @@ if arr[0] == 0{
 			want_str: "pass\n",
 			id: 43,
 		},
+
+		{
+			input: "let arr = [1, 2, 3]; let i = 1; arr[i] += 10; arr[i + 1] *= 2; arr[0]--;",
+			output: map[string]ast.Node{
+				"arr": &ast.ArrLiteralNode{
+					Elems: map[string]ast.Node{
+						(&ast.IntLiteralNode{Value: 0}).String(): &ast.IntLiteralNode{Value: 0},
+						(&ast.IntLiteralNode{Value: 1}).String(): &ast.IntLiteralNode{Value: 12},
+						(&ast.IntLiteralNode{Value: 2}).String(): &ast.IntLiteralNode{Value: 6},
+					},
+				},
+				"i": &ast.IntLiteralNode{Value: 1},
+			},
+			id: 44,
+		},
+
+		{
+			input: `let x = 17; x %= 5; let y = 3; y **= 3; let f = 1.5; f *= 2; let s = "a"; s += "b";`,
+			output: map[string]ast.Node{
+				"x": &ast.IntLiteralNode{Value: 2},
+				"y": &ast.IntLiteralNode{Value: 27},
+				"f": &ast.FloatLiteralNode{Value: 3.0},
+				"s": &ast.StringLiteralNode{Value: "ab"},
+			},
+			id: 45,
+		},
+
+		{
+			input: `fn noReturn(){let a = 1;} let x = noReturn(); let y = x == null; let z = null != 1; println(x); println(noReturn());`,
+			output: map[string]ast.Node{
+				"x": &ast.NullLiteralNode{},
+				"y": &ast.BoolLiteralNode{Value: true},
+				"z": &ast.BoolLiteralNode{Value: true},
+			},
+			want_str: "null\nnull\n",
+			id:       46,
+		},
+
+		{
+			input: `let x = null; let s = "none"; if x{s = "truthy";} else {s = "falsy";} let t = str(x) + "!";`,
+			output: map[string]ast.Node{
+				"x": &ast.NullLiteralNode{},
+				"s": &ast.StringLiteralNode{Value: "falsy"},
+				"t": &ast.StringLiteralNode{Value: "null!"},
+			},
+			id: 47,
+		},
+
+		{
+			input: `let x = 0; let safe = x != 0 && 10 / x > 1; let other = x == 0 || 10 / x > 1; let m = 7 % 3 == 1; let f = 2.5 > 1 && "a" < "b";`,
+			output: map[string]ast.Node{
+				"x":     &ast.IntLiteralNode{Value: 0},
+				"safe":  &ast.BoolLiteralNode{Value: false},
+				"other": &ast.BoolLiteralNode{Value: true},
+				"m":     &ast.BoolLiteralNode{Value: true},
+				"f":     &ast.BoolLiteralNode{Value: true},
+			},
+			id: 48,
+		},
+
+		{
+			input: `
+let hits = 0;
+if 1 {hits++;}
+if 0 {hits = 100;}
+if 0.5 {hits++;}
+if "" {hits = 100;}
+if "a" {hits++;}
+if [] {hits = 100;}
+if [0] {hits++;}
+if !null {hits++;}
+let n = 3;
+let loops = 0;
+while n {n--; loops++;}
+let b = !0 && "x" || false;
+`,
+			output: map[string]ast.Node{
+				"hits":  &ast.IntLiteralNode{Value: 5},
+				"n":     &ast.IntLiteralNode{Value: 0},
+				"loops": &ast.IntLiteralNode{Value: 3},
+				"b":     &ast.BoolLiteralNode{Value: true},
+			},
+			id: 49,
+		},
+
+		{
+			input: "const limit = 3; let n = 0; while n < limit{n++;}",
+			output: map[string]ast.Node{
+				"limit": &ast.IntLiteralNode{Value: 3},
+				"n":     &ast.IntLiteralNode{Value: 3},
+			},
+			id: 50,
+		},
+		{
+			input: `struct Point {
+	x, y
+	fn sum() {
+		return self.x + self.y;
+	}
+	fn move(dx, dy) {
+		self.x += dx;
+		self.y = self.y + dy;
+	}
+}
+let p = Point{x: 1, y: 2};
+p.x = 10;
+p.move(1, 1);
+let s = p.sum();
+let q = p;
+q.x = 0;
+let px = p.x;
+let e = Point{y: 5};
+`,
+			output: map[string]ast.Node{
+				"p":  &ast.StructLiteralNode{Name: "Point", Fields: []ast.StructField{{Name: "x", Value: &ast.IntLiteralNode{Value: 11}}, {Name: "y", Value: &ast.IntLiteralNode{Value: 3}}}},
+				"q":  &ast.StructLiteralNode{Name: "Point", Fields: []ast.StructField{{Name: "x", Value: &ast.IntLiteralNode{Value: 0}}, {Name: "y", Value: &ast.IntLiteralNode{Value: 3}}}},
+				"s":  &ast.IntLiteralNode{Value: 14},
+				"px": &ast.IntLiteralNode{Value: 11},
+				"e":  &ast.StructLiteralNode{Name: "Point", Fields: []ast.StructField{{Name: "x", Value: &ast.NullLiteralNode{}}, {Name: "y", Value: &ast.IntLiteralNode{Value: 5}}}},
+			},
+			id: 51,
+		},
+		{
+			input: `struct Point { x, y }
+struct Line { a, b, name }
+let l = Line{name: "diag", a: Point{x: 1, y: 2}, b: Point{x: 3.5, y: 4}};
+println(l);
+l.b.y = 9;
+println(l.b.y + l.a.x);
+println(l.b.x * 2);
+println("name is " + l.name);
+let pts = [Point{x: 1, y: 1}, Point{x: 2, y: 2}];
+pts[1].x = 5;
+println(pts[1]);
+if pts[1].x > 4 && l.a == Point{x: 1, y: 2} { println(str(l.a)); }
+`,
+			want_str: "Line{a: Point{x: 1, y: 2}, b: Point{x: 3.5, y: 4}, name: \"diag\"}\n10\n7\nname is diag\nPoint{x: 5, y: 2}\nPoint{x: 1, y: 2}\n",
+			id:       52,
+		},
+		{
+			input: `let a = [1]; println(len(a)); let n = len("ab") + len([a, a]);`,
+			output: map[string]ast.Node{
+				"a": &ast.ArrLiteralNode{Elems: map[string]ast.Node{"INT(0)": &ast.IntLiteralNode{Value: 1}}},
+				"n": &ast.IntLiteralNode{Value: 4},
+			},
+			id: 53,
+		},
+		{
+			input: `struct Bag { name, items }
+let b = Bag{name: "b", items: [1, "two", [3]]};
+println(b);
+let d = [];
+d["k"] = 1;
+d[2] = true;
+b.items = d;
+println(str(b));
+`,
+			want_str: "Bag{name: \"b\", items: [1, \"two\", [3]]}\nBag{name: \"b\", items: [2: true, \"k\": 1]}\n",
+			id:       54,
+		},
+		{
+			input:    `let a = [1, 2.5, "x", null]; println(a); print([]); println(""); let d = []; d["k"] = a; println(d);`,
+			want_str: "[1, 2.5, \"x\", null]\n[]\n[\"k\": [1, 2.5, \"x\", null]]\n",
+			id:       55,
+		},
+		{
+			input: "fn f(){ return; } fn g(x){ if x > 0 { return; } return x; } let a = f(); let b = g(1); let c = g(-2);",
+			output: map[string]ast.Node{
+				"a": &ast.NullLiteralNode{},
+				"b": &ast.NullLiteralNode{},
+				"c": &ast.IntLiteralNode{Value: -2},
+			},
+			id: 56,
+		},
+		{
+			input: "struct P { x fn set(v){ self.x = v; } } const c = P{x: 1}; let p = c; p.set(2); let a = P{x: [1, [2]]} == P{x: [1, [2]]}; let b = P{x: [1, 2]} == P{x: [1, 3]}; let d = P{x: [1, 2]} != P{x: [1]};",
+			output: map[string]ast.Node{
+				"c": &ast.StructLiteralNode{Name: "P", Fields: []ast.StructField{{Name: "x", Value: &ast.IntLiteralNode{Value: 1}}}},
+				"p": &ast.StructLiteralNode{Name: "P", Fields: []ast.StructField{{Name: "x", Value: &ast.IntLiteralNode{Value: 2}}}},
+				"a": &ast.BoolLiteralNode{Value: true},
+				"b": &ast.BoolLiteralNode{Value: false},
+				"d": &ast.BoolLiteralNode{Value: true},
+			},
+			id: 57,
+		},
 	}
+}
 
-	for _, tt := range tests {
+func TestEvaluator(t *testing.T) {
+	for _, tt := range evaluatorTests() {
 		// Create a separate function to handle each test case properly
 		func() {
 			lex := lexer.NewLexer()
@@ -525,3 +721,1075 @@ if arr[0] == 0{
 		}() // Execute the anonymous function immediately
 	}
 }
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+		id    int
+	}{
+		{
+			input: "const x = 1; fn f(){x = 2;} f();",
+			err:   "[ERROR] Cannot reassign constant x\n",
+			id:    1,
+		},
+		{
+			input: "const x = 1; fn f(){x += 2;} f();",
+			err:   "[ERROR] Cannot reassign constant x\n",
+			id:    2,
+		},
+		{
+			input: "const arr = [1]; fn f(){arr[0] = 2;} f();",
+			err:   "[ERROR] Cannot modify elements of constant arr\n",
+			id:    3,
+		},
+		{
+			input: "const arr = [1]; fn f(){arr[0]++;} f();",
+			err:   "[ERROR] Cannot modify elements of constant arr\n",
+			id:    4,
+		},
+		{
+			input: "const x = 1; let x = 2;",
+			err:   "[ERROR] Cannot redeclare constant x\n",
+			id:    5,
+		},
+		{
+			input: "struct P { x } const p = P{x: 1}; fn f(){p.x = 2;} f();",
+			err:   "[ERROR] Cannot modify fields of constant p\n",
+			id:    6,
+		},
+		{
+			input: "struct P { x } let p = P{z: 1};",
+			err:   "[ERROR] Struct P has no field z\n",
+			id:    7,
+		},
+		{
+			input: "struct P { x } let p = P{x: 1}; p.go();",
+			err:   "[ERROR] Struct P has no method go\n",
+			id:    8,
+		},
+		{
+			input: "struct P { x fn set(v){ self.x = v; } } const p = P{x: 1}; p.set(2);",
+			err:   "[ERROR] Cannot modify fields of constant self\n",
+			id:    9,
+		},
+		{
+			input: "struct P { x fn set(v){ self.x = v; } } struct O { p fn go(){ self.p.set(2); } } const o = O{p: P{x: 1}}; o.go();",
+			err:   "[ERROR] Cannot modify fields of constant self\n",
+			id:    10,
+		},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				r := recover()
+				if r != tt.err {
+					t.Errorf("[FAILURE] Test number %d has failed\nGot: %q\nWant: %q\n", tt.id, r, tt.err)
+				} else {
+					fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+				}
+			}()
+			lex := lexer.NewLexer()
+			parse := parser.NewParser()
+			exec := NewInterpreter()
+			exec.Execute(parse.Parse(lex.Lex(tt.input)), false)
+		}()
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		input string
+		out   string
+		id    int
+	}{
+		{
+			input: "println(10 - 3 - 2); println(100 / 10 / 5); println(2 ** 3 ** 2); println(7 - 2 * 3 - 1);",
+			out:   "5\n2\n512\n0\n",
+			id:    1,
+		},
+		{
+			input: "let a = 4; let b = 3; println(a * -b); println(2 - -3); println(-2 ** 2); println(-a + 1);",
+			out:   "-12\n5\n-4\n-3\n",
+			id:    2,
+		},
+		{
+			input: "let f = 1.5; println(1.5 - 0.5); println(f - 0.25 - 0.25); println(-f * 2); println(3 - 0.5);",
+			out:   "1\n1\n-3\n2.5\n",
+			id:    3,
+		},
+		{
+			input: "let s = \"a\"; println(1 + 2 + s); println(s + 1 + 2); println(((2)) * 3);",
+			out:   "3a\na12\n6\n",
+			id:    4,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		exec := NewInterpreter()
+		exec.Out = &out
+		exec.Execute(parser.NewParser().Parse(lexer.NewLexer().Lex(tt.input)), false)
+		if out.String() != tt.out {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %q\nWant: %q\n", tt.id, out.String(), tt.out)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/math.toy": `import "util.toy" as u;
+println("loading math");
+export const PI = 3;
+let hidden = 2;
+fn helper(x){ return x * hidden; }
+export fn double(x){ return helper(x); }
+export fn area(r){ return PI * r * r; }
+export fn twice(x){ return u.inc(u.inc(x)); }
+`,
+		"lib/util.toy": "export fn inc(x){ return x + 1; }",
+		"main.toy": `import "lib/math.toy" as m;
+import "lib/math.toy" as again;
+let hidden = 100;
+println(m.double(4));
+println(m.area(2) + again.PI);
+println(m.twice(1));
+`,
+		"a.toy":       `import "b.toy" as b;`,
+		"b.toy":       `import "a.toy" as a;`,
+		"private.toy": `import "lib/math.toy" as m; println(m.hidden);`,
+		"missing.toy": `import "lib/util.toy" as u; u.dec(1);`,
+		"sandbox.toy": `import "lib/util.toy" as u; import "lib/a.toy" as a; println(u.inc(1)); println(a.f());`,
+		"escape.toy":  `import "../main.toy" as m;`,
+		"abs.toy":     `import "/etc/passwd" as p;`,
+	}
+	// With files given, imports come from them and not from the disk
+	sandbox := NewMemFS(map[string]string{
+		"lib/util.toy": "export fn inc(x){ return x + 10; }",
+		"lib/a.toy":    `import "b.toy" as b; export fn f(){ return b.g(); }`,
+		"lib/b.toy":    "export fn g(){ return 7; }",
+	})
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file     string
+		fsys     fs.FS
+		want_str string
+		err      string
+		id       int
+	}{
+		{
+			// math.toy is imported twice but only runs once
+			file:     "main.toy",
+			want_str: "loading math\n8\n15\n3\n",
+			id:       1,
+		},
+		{
+			file: "a.toy",
+			err:  "[ERROR] Import cycle: a.toy -> b.toy -> a.toy\n",
+			id:   2,
+		},
+		{
+			file: "private.toy",
+			err:  "[ERROR] Module math.toy does not export hidden\n",
+			id:   3,
+		},
+		{
+			file: "missing.toy",
+			err:  "[ERROR] Module util.toy does not export function dec\n",
+			id:   4,
+		},
+		{
+			file:     "sandbox.toy",
+			fsys:     sandbox,
+			want_str: "11\n7\n",
+			id:       5,
+		},
+		{
+			file: "escape.toy",
+			fsys: sandbox,
+			err:  `[ERROR] import: invalid path "../main.toy", paths are relative to the root of the file system and can't go above it`,
+			id:   6,
+		},
+		{
+			file: "abs.toy",
+			fsys: sandbox,
+			err:  `[ERROR] import: invalid path "/etc/passwd", paths are relative to the root of the file system and can't go above it`,
+			id:   7,
+		},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		src, _ := os.ReadFile(path)
+		program := parser.NewParser().Parse(lexer.NewLexer().Lex(string(src)))
+		exec := NewInterpreter()
+		exec.SetFile(path)
+		exec.FS = tt.fsys
+
+		var r any
+		out := captureOutput(func() {
+			defer func() { r = recover() }()
+			exec.Execute(program, false)
+		})
+		if tt.err != "" && r != tt.err {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %q\nWant: %q\n", tt.id, r, tt.err)
+		} else if tt.err == "" && (r != nil || out != tt.want_str) {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %q (%v)\nWant: %q\n", tt.id, out, r, tt.want_str)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	src := `fn add(a, b) {
+    let sum = a + b;
+    return sum;
+}
+let x = 1;
+let y = add(x, 2);
+let i = 0;
+while i < 2 {
+    i += 1;
+}
+println(y);
+`
+	program := parser.NewParser().Parse(lexer.NewLexer().Lex(src))
+
+	tests := []struct {
+		breakpoints []int
+		start       StepMode
+		// What each pause returns, the rest continue
+		modes []StepMode
+		want  string
+		err   string
+		id    int
+	}{
+		{
+			start: StepInto,
+			modes: []StepMode{StepInto, StepInto, StepInto, StepInto, StepInto, StepInto, StepInto, StepInto, StepInto, StepInto},
+			want:  "[step <main>:1 step <main>:5 step <main>:6 step add:2 step add:3 step <main>:7 step <main>:8 step <main>:9 step <main>:9 step <main>:11]",
+			id:    1,
+		},
+		{
+			breakpoints: []int{3, 9},
+			want:        "[breakpoint add:3 breakpoint <main>:9 breakpoint <main>:9]",
+			id:          2,
+		},
+		{
+			breakpoints: []int{6},
+			modes:       []StepMode{StepOver, StepOver},
+			want:        "[breakpoint <main>:6 step <main>:7 step <main>:8]",
+			id:          3,
+		},
+		{
+			breakpoints: []int{2},
+			modes:       []StepMode{StepOut},
+			want:        "[breakpoint add:2 step <main>:7]",
+			id:          4,
+		},
+		{
+			breakpoints: []int{6},
+			modes:       []StepMode{StepInto},
+			want:        "[breakpoint <main>:6 step add:2]",
+			id:          5,
+		},
+		{
+			breakpoints: []int{5},
+			modes:       []StepMode{Stop},
+			want:        "[breakpoint <main>:5]",
+			err:         "[ERROR] Program stopped by the debugger",
+			id:          6,
+		},
+	}
+
+	for _, tt := range tests {
+		var stops []string
+		dbg := NewDebugger(func(stack []*Frame, reason string) StepMode {
+			top := stack[len(stack)-1]
+			stops = append(stops, fmt.Sprintf("%s %s:%d", reason, top.Name, top.Pos.Line))
+			if len(stops) <= len(tt.modes) {
+				return tt.modes[len(stops)-1]
+			}
+			return Continue
+		})
+		for _, line := range tt.breakpoints {
+			dbg.SetBreakpoint("", line)
+		}
+		dbg.Step(tt.start)
+		exec := NewInterpreter()
+		exec.Out = &bytes.Buffer{}
+		exec.Hook = dbg
+
+		var r any
+		func() {
+			defer func() { r = recover() }()
+			exec.Execute(program, false)
+		}()
+		if fmt.Sprint(stops) != tt.want || (tt.err == "" && r != nil) || (tt.err != "" && r != tt.err) {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot:  %v (%v)\nWant: %v\n", tt.id, stops, r, tt.want)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+
+	// Frames show the call stack and the variables of each call
+	var got string
+	dbg := NewDebugger(func(stack []*Frame, reason string) StepMode {
+		var names []string
+		for _, f := range stack {
+			names = append(names, f.Name)
+		}
+		sum, _ := stack[1].Lookup("sum")
+		got = fmt.Sprint(names, " ", stack[1].Locals(), " ", stack[1].Globals()["x"], " ", FormatValue(sum), " ", stack[0].Pos.Line)
+		return Continue
+	})
+	dbg.SetBreakpoint("", 3)
+	exec := NewInterpreter()
+	exec.Out = &bytes.Buffer{}
+	exec.Hook = dbg
+	exec.Execute(program, false)
+	want := "[<main> add] map[a:INT(1) b:INT(2) sum:INT(3)] INT(1) 3 6"
+	if got != want {
+		t.Errorf("[FAILURE] Test number 7 has failed\nGot:  %v\nWant: %v\n", got, want)
+	} else {
+		fmt.Printf("\033[32m[PASS] Test number 7 has passed\033[0m\n")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	tests := []struct {
+		src    string
+		format TraceFormat
+		want   string
+		id     int
+	}{
+		{
+			src: "fn add(a, b) {\n    let sum = a + b;\n    return sum;\n}\nlet x = 0;\nif true {\n    x = add(1, 2);\n}\n",
+			want: "1 <eval>:1:1 <main> depth=1 scope=1: fn add(a, b) { ... }\n" +
+				"2 <eval>:5:1 <main> depth=1 scope=1: let x = 0 => x = 0\n" +
+				"5 <eval>:2:5 add depth=2 scope=3: let sum = a + b => sum = 3\n" +
+				"6 <eval>:3:5 add depth=2 scope=3: return sum\n" +
+				"4 <eval>:7:5 <main> depth=1 scope=2: x = add(1, 2) => x = 3\n" +
+				"3 <eval>:6:1 <main> depth=1 scope=1: if true { ... } => x = 3\n",
+			id: 1,
+		},
+		{
+			src: "let i = 0;\nwhile i < 2 { i += 1; }\n",
+			want: "1 <eval>:1:1 <main> depth=1 scope=1: let i = 0 => i = 0\n" +
+				"3 <eval>:2:15 <main> depth=1 scope=2: i += 1 => i = 1\n" +
+				"4 <eval>:2:15 <main> depth=1 scope=2: i += 1 => i = 2\n" +
+				"2 <eval>:2:1 <main> depth=1 scope=1: while i < 2 { ... } => i = 2\n",
+			id: 2,
+		},
+		{
+			src:    "let s = \"a\";\nlet arr = [1, 2];\nprintln(1 / 0);\n",
+			format: TraceJSON,
+			want: `{"seq":1,"line":1,"col":1,"func":"<main>","depth":1,"scope":1,"stmt":"let s = \"a\"","changes":{"s":"\"a\""}}` + "\n" +
+				`{"seq":2,"line":2,"col":1,"func":"<main>","depth":1,"scope":1,"stmt":"let arr = [1, 2]","changes":{"arr":"[1, 2]"}}` + "\n" +
+				`{"seq":3,"line":3,"col":1,"func":"<main>","depth":1,"scope":1,"stmt":"println(1 / 0)","unfinished":true}` + "\n",
+			id: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parser.NewParser().Parse(lexer.NewLexer().Lex(tt.src))
+		var out bytes.Buffer
+		tracer := NewTracer(&out, tt.format)
+		exec := NewInterpreter()
+		exec.Out = &bytes.Buffer{}
+		exec.Hook = tracer
+		func() {
+			defer func() { recover() }()
+			exec.Execute(program, false)
+		}()
+		tracer.Flush()
+		if out.String() != tt.want {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot:\n%v\nWant:\n%v\n", tt.id, out.String(), tt.want)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	src := `fn fib(n) {
+    if n < 2 {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+}
+let x = fib(3);
+`
+	program := parser.NewParser().Parse(lexer.NewLexer().Lex(src))
+	profiler := NewProfiler()
+	// Every event takes a millisecond
+	clock := time.Unix(0, 0)
+	profiler.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	exec := NewInterpreter()
+	exec.Hook = profiler
+	exec.Execute(program, false)
+
+	var report, pprof bytes.Buffer
+	profiler.WriteReport(&report)
+	pprofErr := profiler.WritePprof(&pprof)
+	var data []byte
+	if zr, err := gzip.NewReader(&pprof); err == nil {
+		data, _ = io.ReadAll(zr)
+	}
+
+	tests := []struct {
+		got  string
+		want string
+		id   int
+	}{
+		{fmt.Sprint(profiler.Functions()), "[{fib  5 19ms 19ms} {<main>  1 23ms 4ms}]", 1},
+		{fmt.Sprint(profiler.Lines()), "[{ 2 fib 5} { 3 fib 3} { 5 fib 2} { 1 <main> 1} { 7 <main> 1}]", 2},
+		{fmt.Sprint(profiler.Total()), "23ms", 3},
+		{report.String(), "Total time: 23ms\n\nFunctions by exclusive time:\n" +
+			"       calls    exclusive    inclusive  function\n" +
+			"           5         19ms         19ms  fib (<eval>)\n" +
+			"           1          4ms         23ms  <main> (<eval>)\n\n" +
+			"Lines by hits:\n        hits  line\n" +
+			"           5  <eval>:2 (fib)\n           3  <eval>:3 (fib)\n           2  <eval>:5 (fib)\n" +
+			"           1  <eval>:1 (<main>)\n           1  <eval>:7 (<main>)\n", 4},
+		// The string table holds the function names and sample types
+		{fmt.Sprint(pprofErr, bytes.Contains(data, []byte("\x32\x03fib")), bytes.Contains(data, []byte("\x32\x04main")), bytes.Contains(data, []byte("nanoseconds"))), "<nil> true true true", 5},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot:  %v\nWant: %v\n", tt.id, tt.got, tt.want)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	dir := t.TempDir()
+	lib := `export fn sign(n) {
+    if n < 0 {
+        return 0 - 1;
+    }
+    if n == 0 {
+        return 0;
+    }
+    return 1;
+}
+export fn unused() {
+    return 2;
+}
+`
+	main := `import "lib.toy" as lib;
+let a = lib.sign(5);
+if a == 1 {
+    println("ok");
+} else {
+    println("bad");
+}
+`
+	for name, src := range map[string]string{"lib.toy": lib, "main.toy": main} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	coverage := NewCoverage()
+	// Two runs add up
+	for run := 0; run < 2; run++ {
+		exec := NewInterpreter()
+		exec.Out = &bytes.Buffer{}
+		exec.SetFile(filepath.Join(dir, "main.toy"))
+		exec.Hook = coverage
+		exec.Execute(parser.NewParser().Parse(lexer.NewLexer().Lex(main)), false)
+	}
+
+	files := coverage.Files()
+	summary := func(f *FileCoverage) string {
+		run, stmts, taken, branches := f.Summary()
+		return fmt.Sprint(filepath.Base(f.Path), " ", run, "/", stmts, " ", taken, "/", branches)
+	}
+	// The statements come from the program that ran, not from the file on disk
+	missing := NewCoverage()
+	exec := NewInterpreter()
+	exec.SetFile(filepath.Join(dir, "missing.toy"))
+	exec.Hook = missing
+	exec.Execute(parser.NewParser().Parse(lexer.NewLexer().Lex("let x = 1;\nif x > 5 {\n    println(x);\n}\n")), false)
+
+	var lcov, page bytes.Buffer
+	coverage.WriteLcov(&lcov)
+	coverage.WriteHTML(&page)
+	libLcov := strings.ReplaceAll(lcov.String(), dir, "DIR")
+
+	tests := []struct {
+		got  string
+		want string
+		id   int
+	}{
+		{fmt.Sprint(len(files)), "2", 1},
+		{summary(files[0]), "lib.toy 5/8 2/4", 2},
+		{summary(files[1]), "main.toy 4/5 1/2", 3},
+		{fmt.Sprint(*files[0].Stmts[1], *files[0].Branches[0]), "{{{2 5} {4 5}} 2} {{{2 5} {4 5}} 0 2}", 4},
+		{libLcov, "TN:\nSF:DIR/lib.toy\nBRDA:2,0,0,0\nBRDA:2,0,1,2\nBRDA:5,1,0,0\nBRDA:5,1,1,2\nBRF:4\nBRH:2\n" +
+			"DA:1,2\nDA:2,2\nDA:3,0\nDA:5,2\nDA:6,0\nDA:8,2\nDA:10,2\nDA:11,0\nLF:8\nLH:5\nend_of_record\n", 5},
+		{fmt.Sprint(strings.Contains(page.String(), `<span class="line missed"><span class="num">3</span><span class="hits">0</span>        return 0 - 1;</span>`),
+			strings.Contains(page.String(), `<span class="line partial" title="if taken 0 times, else 2 times"><span class="num">2</span>`),
+			strings.Contains(page.String(), `<td>62.5% (5/8)</td>`)), "true true true", 6},
+		{summary(missing.Files()[0]), "missing.toy 2/3 1/2", 7},
+	}
+	for _, tt := range tests {
+		// The lcov of main.toy follows lib.toy's
+		if tt.id == 5 {
+			tt.got = tt.got[:strings.Index(tt.got, "end_of_record")+len("end_of_record\n")]
+		}
+		if tt.got != tt.want {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot:  %v\nWant: %v\n", tt.id, tt.got, tt.want)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestAssert(t *testing.T) {
+	tests := []struct {
+		input string
+		// "" if the assertions pass
+		err string
+		id  int
+	}{
+		{
+			input: "assert(1 < 2); assertEq([1, [2, 3]], [1, [2, 3]]); assertEq(\"a\", \"a\");",
+			err:   "",
+			id:    1,
+		},
+		{
+			input: "assert(1 > 2);",
+			err:   "[ERROR] assert failed",
+			id:    2,
+		},
+		{
+			input: "assert(1);",
+			err:   "[ERROR] assert needs a bool, got 1",
+			id:    3,
+		},
+		{
+			input: "assertEq(1 + 1, 3);",
+			err:   "[ERROR] assertEq failed\n    got:  2\n    want: 3",
+			id:    4,
+		},
+		{
+			input: "assertEq([1, 2, 3], [1, 2, 4, 5]);",
+			err:   "[ERROR] assertEq failed\n    got:  [1, 2, 3]\n    want: [1, 2, 4, 5]\n    differences:\n        [2]: got 3, want 4\n        [3]: got nothing, want 5",
+			id:    5,
+		},
+		{
+			input: "struct P { x, y } assertEq(P{x: 1, y: [2]}, P{x: 1, y: [3]});",
+			err:   "[ERROR] assertEq failed\n    got:  P{x: 1, y: [2]}\n    want: P{x: 1, y: [3]}\n    differences:\n        .y[0]: got 2, want 3",
+			id:    6,
+		},
+		{
+			input: "assertEq(\"a\nb\nc\", \"a\nc\nd\");",
+			err:   "[ERROR] assertEq failed\n    diff (- got, + want):\n          a\n        - b\n          c\n        + d",
+			id:    7,
+		},
+		{
+			input: "let n = 0; assert(n == 0, \"n starts at 0\"); n--; assert(n >= 0, \"n is never negative\");",
+			err:   "[ERROR] assert failed: n is never negative",
+			id:    8,
+		},
+		{
+			input: "assert(false, 3);",
+			err:   "[ERROR] assert needs a string message, got 3",
+			id:    9,
+		},
+		{
+			input: "assert(true, \"a\", \"b\");",
+			err:   "[ERROR] Function assert must be called with 1 to 2 params, got 3\n",
+			id:    10,
+		},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil {
+					r = ""
+				}
+				if r != tt.err {
+					t.Errorf("[FAILURE] Test number %d has failed\nGot: %q\nWant: %q\n", tt.id, r, tt.err)
+				} else {
+					fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+				}
+			}()
+			exec := NewInterpreter()
+			exec.Execute(parser.NewParser().Parse(lexer.NewLexer().Lex(tt.input)), false)
+		}()
+	}
+}
+
+func TestMath(t *testing.T) {
+	tests := []struct {
+		input string
+		out   string
+		err   string
+		id    int
+	}{
+		{
+			input: "import \"math\" as m; println(m.sqrt(16)); println(m.pow(2, 10)); println(m.abs(-3)); println(m.abs(-3.5));",
+			out:   "4\n1024\n3\n3.5\n",
+			id:    1,
+		},
+		{
+			input: "import \"math\" as m; let x = m.floor(2.7) + m.ceil(2.1) + m.round(-2.5); println(x); println(m.min(3, 2.5)); println(m.max(3, 2));",
+			out:   "2\n2.5\n3\n",
+			id:    2,
+		},
+		{
+			input: "import \"math\" as m; println(m.pi); println(m.atan2(1, 1) * 4 == m.pi); println(m.log(m.e)); println(m.log10(1000) + m.log2(8) + m.exp(0));",
+			out:   "3.141592653589793\ntrue\n1\n7\n",
+			id:    3,
+		},
+		{
+			input: "println(float(3) + float(\"1.5\") + float(true)); println(str(2.5) + \"!\"); println(int(-2.7)); println(int(2.0) == 2);",
+			out:   "5.5\n2.5!\n-2\ntrue\n",
+			id:    4,
+		},
+		{
+			input: "import \"math\" as m; println(m.sqrt(-1));",
+			err:   "[ERROR] math.sqrt is not defined for -1",
+			id:    5,
+		},
+		{
+			input: "import \"math\" as m; m.max(\"a\", 1);",
+			err:   "[ERROR] math.max needs numbers, got \"a\"",
+			id:    6,
+		},
+		{
+			input: "println(int(float(\"1e19\")));",
+			err:   "[ERROR] Cannot convert 10000000000000000000 to int",
+			id:    7,
+		},
+		{
+			input: "float(\"x\");",
+			err:   "[ERROR] Cannot convert string to float: strconv.ParseFloat: parsing \"x\": invalid syntax",
+			id:    8,
+		},
+		{
+			input: "import \"math\" as m; println(m.log(-1));",
+			err:   "[ERROR] math.log is not defined for -1",
+			id:    9,
+		},
+		{
+			input: "import \"math\" as m; println(m.log(0));",
+			err:   "[ERROR] math.log is not defined for 0",
+			id:    10,
+		},
+		{
+			input: "import \"math\" as m; println(m.log10(0.0));",
+			err:   "[ERROR] math.log10 is not defined for 0",
+			id:    11,
+		},
+		{
+			input: "import \"math\" as m; println(m.pow(0, -1));",
+			err:   "[ERROR] math.pow is not defined for 0, -1",
+			id:    12,
+		},
+		{
+			input: "import \"math\" as m; println(m.exp(1000)); println(m.abs(-9223372036854775807));",
+			out:   "+Inf\n9223372036854775807\n",
+			id:    13,
+		},
+		{
+			input: "import \"math\" as m; println(m.abs(-9223372036854775807 - 1));",
+			err:   "[ERROR] math.abs(-9223372036854775808) is too big for an int",
+			id:    14,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil {
+					r = ""
+				}
+				if r != tt.err || out.String() != tt.out {
+					t.Errorf("[FAILURE] Test number %d has failed\nGot: %q %q\nWant: %q %q\n", tt.id, out.String(), r, tt.out, tt.err)
+				} else {
+					fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+				}
+			}()
+			exec := NewInterpreter()
+			exec.Out = &out
+			exec.Execute(parser.NewParser().Parse(lexer.NewLexer().Lex(tt.input)), false)
+		}()
+	}
+}
+
+func TestRandom(t *testing.T) {
+	run := func(input string, setup func(exec *Interpreter)) (out string, err any) {
+		var buf bytes.Buffer
+		defer func() { out, err = buf.String(), recover() }()
+		exec := NewInterpreter()
+		exec.Out = &buf
+		setup(&exec)
+		exec.Execute(parser.NewParser().Parse(lexer.NewLexer().Lex(input)), false)
+		return
+	}
+	program := `let a = [1, 2, 3, 4, 5]; let b = shuffle(a);
+println(str(b[0]) + str(b[1]) + str(b[2]) + str(b[3]) + str(b[4]));
+println(str(a[0]) + str(a[1]) + str(a[2]) + str(a[3]) + str(a[4]));
+println(randInt(1, 100)); println(randf(0, 1) < 1); println(choice(["x", "y", "z"]));`
+	seeded, _ := run("seed(42);"+program, func(exec *Interpreter) {})
+	fromGo, _ := run(program, func(exec *Interpreter) { exec.Seed(42) })
+	other, _ := run(program, func(exec *Interpreter) { exec.Seed(42) })
+	lines := strings.Split(seeded, "\n")
+	shuffled := []byte(lines[0])
+	sort.Slice(shuffled, func(a, b int) bool { return shuffled[a] < shuffled[b] })
+
+	toyError := func(input string) (bool, string) {
+		_, err := run(input, func(exec *Interpreter) {})
+		msg, ok := err.(string)
+		return ok && strings.HasPrefix(msg, "[ERROR]"), fmt.Sprintf("%v gave %v", input, err)
+	}
+	emptyOk, emptyMsg := toyError("choice([]);")
+	notArrOk, notArrMsg := toyError("shuffle(1);")
+	rangeOk, rangeMsg := toyError("randInt(2, 1);")
+
+	tests := []struct {
+		ok  bool
+		msg string
+		id  int
+	}{
+		{ok: seeded == fromGo && seeded == other, msg: fmt.Sprintf("seeded runs differ: %q %q %q", seeded, fromGo, other), id: 1},
+		{ok: string(shuffled) == "12345" && lines[1] == "12345", msg: fmt.Sprintf("shuffle gave %q and left %q", lines[0], lines[1]), id: 2},
+		{ok: emptyOk, msg: emptyMsg, id: 3},
+		{ok: notArrOk, msg: notArrMsg, id: 4},
+		{ok: rangeOk, msg: rangeMsg, id: 5},
+	}
+
+	for _, tt := range tests {
+		if !tt.ok {
+			t.Errorf("[FAILURE] Test number %d has failed\n%v\n", tt.id, tt.msg)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "out")); err != nil {
+		t.Fatal(err)
+	}
+	withDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(withDir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mem := func() fs.FS { return NewMemFS(map[string]string{"data/a.txt": "a", "b.txt": "b"}) }
+	tests := []struct {
+		input string
+		fs    func() fs.FS
+		out   string
+		err   string
+		id    int
+	}{
+		{
+			input: `println(readFile("data/a.txt") + readFile("./b.txt")); let names = listDir("."); println(len(names)); println(names[0] + names[1]);`,
+			fs:    mem,
+			out:   "ab\n2\nb.txtdata\n",
+			id:    1,
+		},
+		{
+			input: `writeFile("data/c.txt", "1"); appendFile("data/c.txt", "2"); println(readFile("data/c.txt")); removeFile("data/c.txt"); println(exists("data/c.txt")); println(exists("data"));`,
+			fs:    mem,
+			out:   "12\nfalse\ntrue\n",
+			id:    2,
+		},
+		{
+			input: `readFile("../b.txt");`,
+			fs:    mem,
+			err:   `[ERROR] readFile: invalid path "../b.txt", paths are relative to the root of the file system and can't go above it`,
+			id:    3,
+		},
+		{
+			input: `readFile("nope.txt");`,
+			fs:    mem,
+			err:   "[ERROR] readFile: open nope.txt: file does not exist",
+			id:    4,
+		},
+		{
+			input: `readFile("b.txt");`,
+			err:   "[ERROR] readFile is not allowed, the program was not given any files",
+			id:    5,
+		},
+		{
+			input: `println(readFile("b.txt")); writeFile("b.txt", "c");`,
+			fs:    func() fs.FS { return fstest.MapFS{"b.txt": {Data: []byte("b")}} },
+			out:   "b\n",
+			err:   "[ERROR] writeFile is not allowed, the program's files are read only",
+			id:    6,
+		},
+		{
+			input: `writeFile("x.txt", "x"); appendFile("x.txt", "y"); println(readFile("x.txt")); let names = listDir("."); println(names[1]);`,
+			fs:    func() fs.FS { return DirFS(dir) },
+			out:   "xy\nx.txt\n",
+			id:    7,
+		},
+		{
+			input: `readFile("out/secret.txt");`,
+			fs:    func() fs.FS { return DirFS(dir) },
+			err:   "[ERROR] readFile: open out/secret.txt: path escapes from parent",
+			id:    8,
+		},
+		{
+			input: `writeFile("out/new.txt", "x");`,
+			fs:    func() fs.FS { return DirFS(dir) },
+			err:   "[ERROR] writeFile: open out/new.txt: path escapes from parent",
+			id:    9,
+		},
+		{
+			input: `writeFile("b.txt", 1);`,
+			fs:    mem,
+			err:   "[ERROR] writeFile needs a string to write, use str() to convert other values",
+			id:    10,
+		},
+		{
+			input: `removeFile("sub");`,
+			fs:    func() fs.FS { return DirFS(withDir) },
+			err:   "[ERROR] removeFile: remove sub: is a directory",
+			id:    11,
+		},
+		{
+			input: `removeFile("data");`,
+			fs:    mem,
+			err:   "[ERROR] removeFile: remove data: is a directory",
+			id:    12,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil {
+					r = ""
+				}
+				if r != tt.err || out.String() != tt.out {
+					t.Errorf("[FAILURE] Test number %d has failed\nGot: %q %q\nWant: %q %q\n", tt.id, out.String(), r, tt.out, tt.err)
+				} else {
+					fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+				}
+			}()
+			exec := NewInterpreter()
+			exec.Out = &out
+			if tt.fs != nil {
+				exec.FS = tt.fs()
+			}
+			exec.Execute(parser.NewParser().Parse(lexer.NewLexer().Lex(tt.input)), false)
+		}()
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); err == nil {
+		t.Errorf("[FAILURE] writeFile wrote outside of the DirFS root")
+	}
+	if _, err := os.Stat(filepath.Join(withDir, "sub")); err != nil {
+		t.Errorf("[FAILURE] removeFile removed a directory")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	files := map[string]string{
+		"d.json":   `{"name": "toy", "tags": ["a", "b"], "n": 3, "f": 2.5, "big": 1e3, "none": null, "s": "<a&b>\n"}`,
+		"bad.json": `{"a": 1`,
+	}
+	tests := []struct {
+		input string
+		out   string
+		err   string
+		id    int
+	}{
+		{
+			input: `let d = jsonParse(readFile("d.json")); let tags = d["tags"]; println(d["name"] + tags[1]); println(d["n"] + 1); println(d["f"]); println(d["big"] + 0.5);`,
+			out:   "toyb\n4\n2.5\n1000.5\n",
+			id:    1,
+		},
+		{
+			input: `println(jsonStringify(jsonParse(readFile("d.json")), 0));`,
+			out:   `{"big":1000,"f":2.5,"n":3,"name":"toy","none":null,"s":"<a&b>\n","tags":["a","b"]}` + "\n",
+			id:    2,
+		},
+		{
+			input: `let e = []; e["k"] = [1, true]; e[3] = null; println(jsonStringify(e, 2));`,
+			out:   "{\n  \"3\": null,\n  \"k\": [\n    1,\n    true\n  ]\n}\n",
+			id:    3,
+		},
+		{
+			input: `struct P { x, y } let p = P{x: 1, y: "q"}; let l = [p, []]; println(jsonStringify(l, 0));`,
+			out:   `[{"x":1,"y":"q"},[]]` + "\n",
+			id:    4,
+		},
+		{
+			input: `jsonParse(readFile("bad.json"));`,
+			err:   "[ERROR] jsonParse: unexpected EOF",
+			id:    5,
+		},
+		{
+			input: `jsonParse("1 2");`,
+			err:   "[ERROR] jsonParse: unexpected data after the JSON value",
+			id:    6,
+		},
+		{
+			input: `jsonStringify(0.0 / 0.0, 0);`,
+			err:   "[ERROR] jsonStringify: NaN can't be written as JSON",
+			id:    7,
+		},
+		{
+			input: `jsonStringify(1, 11);`,
+			err:   "[ERROR] jsonStringify needs an indent from 0 to 10 spaces, got 11",
+			id:    8,
+		},
+		{
+			input: `let a = [1]; a[0] = a; a[0] = a; println(jsonStringify(a, 0));`,
+			out:   "[[[1]]]\n",
+			id:    9,
+		},
+		{
+			input: `jsonParse("[1, 1e400]");`,
+			err:   "[ERROR] jsonParse: number out of range: 1e400",
+			id:    10,
+		},
+		{
+			input: `let big = jsonParse("[123456789012345678901234567890, 1e-400]"); println(big[0] > 1.0); println(big[1]);`,
+			out:   "true\n0\n",
+			id:    11,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil {
+					r = ""
+				}
+				if r != tt.err || out.String() != tt.out {
+					t.Errorf("[FAILURE] Test number %d has failed\nGot: %q %q\nWant: %q %q\n", tt.id, out.String(), r, tt.out, tt.err)
+				} else {
+					fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+				}
+			}()
+			exec := NewInterpreter()
+			exec.Out = &out
+			exec.FS = NewMemFS(files)
+			exec.Execute(parser.NewParser().Parse(lexer.NewLexer().Lex(tt.input)), false)
+		}()
+	}
+
+	// Values made in Go can still contain themselves
+	cyclic := &ast.ArrLiteralNode{Elems: make(map[string]ast.Node)}
+	cyclic.Elems["INT(0)"] = cyclic
+	if _, err := ToJSON(cyclic, ""); err == nil || err.Error() != "the value contains itself, a cycle can't be written as JSON" {
+		t.Errorf("[FAILURE] ToJSON of a cyclic array gave %v", err)
+	}
+	shared := &ast.ArrLiteralNode{Elems: map[string]ast.Node{"INT(0)": &ast.IntLiteralNode{Value: 1}}}
+	if text, err := ToJSON(&ast.ArrLiteralNode{Elems: map[string]ast.Node{"INT(0)": shared, "INT(1)": shared}}, ""); err != nil || text != "[[1],[1]]" {
+		t.Errorf("[FAILURE] ToJSON of a shared array gave %q %v", text, err)
+	}
+}
+
+// Stops a fuzzed program before its strings and arrays grow big enough to run out of memory
+type sizeGuard struct{}
+
+// What sizeGuard panics with, the program was fine up to there
+type tooBig struct{}
+
+func (sizeGuard) Statement(stack []*Frame) {
+	budget := 1 << 16
+	for _, frame := range stack {
+		for _, val := range frame.Locals() {
+			if budget -= nodeSize(val, budget); budget < 0 {
+				panic(tooBig{})
+			}
+		}
+	}
+}
+
+// Roughly how many bytes a value takes, it stops counting after limit
+func nodeSize(val ast.Node, limit int) int {
+	size := 1
+	switch v := val.(type) {
+	case *ast.StringLiteralNode:
+		size += len(v.Value)
+	case *ast.ArrLiteralNode:
+		for _, elem := range v.Elems {
+			if size += nodeSize(elem, limit-size); size > limit {
+				break
+			}
+		}
+	case *ast.StructLiteralNode:
+		for _, field := range v.Fields {
+			if size += nodeSize(field.Value, limit-size); size > limit {
+				break
+			}
+		}
+	}
+	return size
+}
+
+// Seeds are the TestEvaluator inputs and the programs in test_programs, run with go test ./evaluator -fuzz FuzzExecute.
+// MaxSteps and sizeGuard keep programs that loop forever or grow without end short
+func FuzzExecute(f *testing.F) {
+	for _, tt := range evaluatorTests() {
+		f.Add(tt.input)
+	}
+	programs, _ := filepath.Glob("../test_programs/*.toy")
+	for _, path := range programs {
+		if source, err := os.ReadFile(path); err == nil {
+			f.Add(string(source))
+		}
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		// A toy error is an [ERROR] panic, a Go runtime error or any other panic is a bug
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(tooBig); ok {
+					return
+				}
+				if msg, ok := r.(string); !ok || !strings.HasPrefix(msg, "[ERROR]") {
+					t.Fatalf("Running %q panicked with %v", input, r)
+				}
+			}
+		}()
+		program := parser.NewParser().Parse(lexer.NewLexer().Lex(input))
+		exec := NewInterpreter()
+		exec.Out = io.Discard
+		exec.In = strings.NewReader("")
+		exec.Hook = sizeGuard{}
+		exec.MaxSteps = 1000
+		exec.Execute(program, false)
+	})
+}
@@ -3,26 +3,39 @@ package evaluator
 import (
 	"fmt"
 	"math"
+	"strings"
 	"toy_lang/ast"
 	"toy_lang/token"
 )
 
 func intPow(x, y int) int {
 	if y < 0 {
-		panic("negative exponent not supported for integers")
+		panic("[ERROR] Negative exponent not supported for integers")
 	}
+	// Squaring keeps huge exponents fast, the result wraps around the same way repeated multiplying does
 	result := 1
-	for i := 0; i < y; i++ {
-		result *= x
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			result *= x
+		}
+		x *= x
 	}
 	return result
 }
-func (i *Interpreter) execIntExpr(inode ast.Node, local_scope *Scope) int {
-	var node ast.Node = inode
 
-	if emptyNode, ok := inode.(*ast.EmptyExprNode); ok {
+// Every pair of parentheses around an expression is an EmptyExprNode, this returns what is inside all of them
+func unwrapEmpty(node ast.Node) ast.Node {
+	for {
+		emptyNode, ok := node.(*ast.EmptyExprNode)
+		if !ok {
+			return node
+		}
 		node = emptyNode.Child
 	}
+}
+
+func (i *Interpreter) execIntExpr(inode ast.Node, local_scope *Scope) int {
+	node := unwrapEmpty(inode)
 
 	switch node := node.(type) {
 	case *ast.IntLiteralNode:
@@ -39,7 +52,7 @@ func (i *Interpreter) execIntExpr(inode ast.Node, local_scope *Scope) int {
 		return intNode.Value
 	case *ast.FuncCallNode:
 		result := i.execFuncCall(node, local_scope)
-		if result == nil {
+		if result.NodeType() == ast.NullLiteral {
 			panic(fmt.Sprintf("[ERROR] Function %s did not return a value", node.Name.Name))
 		}
 		intNode, ok := result.(*ast.IntLiteralNode)
@@ -47,6 +60,8 @@ func (i *Interpreter) execIntExpr(inode ast.Node, local_scope *Scope) int {
 			panic(fmt.Sprintf("[ERROR] Expected int return from function, got %v", result))
 		}
 		return intNode.Value
+	case *ast.FieldAccessNode, *ast.MethodCallNode, *ast.ArrRefNode:
+		return i.execIntExpr(i.execExpr(node, local_scope), local_scope)
 	case *ast.InfixExprNode:
 		switch node.Operator {
 		case token.PLUS:
@@ -55,10 +70,15 @@ func (i *Interpreter) execIntExpr(inode ast.Node, local_scope *Scope) int {
 			return i.execIntExpr(node.Left, local_scope) - i.execIntExpr(node.Right, local_scope)
 		case token.MULTIPLY:
 			return i.execIntExpr(node.Left, local_scope) * i.execIntExpr(node.Right, local_scope)
-		case token.DIVIDE:
-			return i.execIntExpr(node.Left, local_scope) / i.execIntExpr(node.Right, local_scope)
-		case token.MODULO:
-			return i.execIntExpr(node.Left, local_scope) % i.execIntExpr(node.Right, local_scope)
+		case token.DIVIDE, token.MODULO:
+			left, right := i.execIntExpr(node.Left, local_scope), i.execIntExpr(node.Right, local_scope)
+			if right == 0 {
+				panic("[ERROR] Integer divide by zero")
+			}
+			if node.Operator == token.DIVIDE {
+				return left / right
+			}
+			return left % right
 		case token.EXPONENT:
 			return intPow(i.execIntExpr(node.Left, local_scope), i.execIntExpr(node.Right, local_scope))
 		}
@@ -67,11 +87,7 @@ func (i *Interpreter) execIntExpr(inode ast.Node, local_scope *Scope) int {
 }
 
 func (i *Interpreter) execBoolExpr(inode ast.Node, local_scope *Scope) bool {
-	var node ast.Node = inode
-
-	if emptyNode, ok := inode.(*ast.EmptyExprNode); ok {
-		node = emptyNode.Child
-	}
+	node := unwrapEmpty(inode)
 
 	switch node := node.(type) {
 	case *ast.BoolLiteralNode:
@@ -83,83 +99,122 @@ func (i *Interpreter) execBoolExpr(inode ast.Node, local_scope *Scope) bool {
 		if !ok {
 			panic(fmt.Sprintf("[ERROR] Undefined variable %s", node.Name))
 		}
-		boolNode, ok := val.(*ast.BoolLiteralNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Expected bool, got %v", val))
-		}
-		return boolNode.Value
+		return isTruthy(val)
 	case *ast.FuncCallNode:
-		result := i.execFuncCall(node, local_scope)
-		if result == nil {
-			panic(fmt.Sprintf("[ERROR] Function %s did not return a value", node.Name.Name))
-		}
-		boolNode, ok := result.(*ast.BoolLiteralNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Expected bool return from function, got %v", result))
-		}
-		return boolNode.Value
+		return isTruthy(i.execFuncCall(node, local_scope))
 	case *ast.BoolInfixNode:
 		switch node.Operator {
+		// Go's && and || already short circuit, so the right side is only evaluated when needed
 		case token.AND:
 			return i.execBoolExpr(node.Left, local_scope) && i.execBoolExpr(node.Right, local_scope)
 		case token.OR:
 			return i.execBoolExpr(node.Left, local_scope) || i.execBoolExpr(node.Right, local_scope)
 		case token.LESS_THAN:
-			return i.execIntExpr(node.Left, local_scope) < i.execIntExpr(node.Right, local_scope)
+			return i.compareValues(node, local_scope) < 0
 		case token.LESS_THAN_EQT:
-			return i.execIntExpr(node.Left, local_scope) <= i.execIntExpr(node.Right, local_scope)
+			return i.compareValues(node, local_scope) <= 0
 		case token.GREATER_THAN:
-			return i.execIntExpr(node.Left, local_scope) > i.execIntExpr(node.Right, local_scope)
+			return i.compareValues(node, local_scope) > 0
 		case token.GREATER_THAN_EQT:
-			return i.execIntExpr(node.Left, local_scope) >= i.execIntExpr(node.Right, local_scope)
+			return i.compareValues(node, local_scope) >= 0
 		case token.EQUALS:
-			leftVal := i.execExpr(node.Left, local_scope)
-			rightVal := i.execExpr(node.Right, local_scope)
+			return valuesEqual(i.execExpr(node.Left, local_scope), i.execExpr(node.Right, local_scope))
+		case token.NOT_EQUAL:
+			return !valuesEqual(i.execExpr(node.Left, local_scope), i.execExpr(node.Right, local_scope))
+		}
+	case *ast.InfixExprNode, *ast.IntLiteralNode, *ast.FloatLiteralNode, *ast.StringLiteralNode,
+		*ast.NullLiteralNode, *ast.ArrLiteralNode, *ast.ArrRefNode, *ast.CallBuiltinNode,
+		*ast.StructLiteralNode, *ast.FieldAccessNode, *ast.MethodCallNode:
+		return isTruthy(i.execExpr(node, local_scope))
+	}
+	panic(fmt.Sprintf("[ERROR] Unknown bool expression: %v", node))
+}
 
-			switch l := leftVal.(type) {
-			case *ast.IntLiteralNode:
-				r, ok := rightVal.(*ast.IntLiteralNode)
-				if !ok {
-					return false
-				}
-				return l.Value == r.Value
-			case *ast.BoolLiteralNode:
-				r, ok := rightVal.(*ast.BoolLiteralNode)
-				if !ok {
-					return false
-				}
-				return l.Value == r.Value
-			case *ast.StringLiteralNode:
-				r, ok := rightVal.(*ast.StringLiteralNode)
-				if !ok {
-					return false
-				}
-				return l.Value == r.Value
-			default:
-				return false
-			}
+// Truthiness used by conditions, !, && and ||
+//
+//	bool   -> its value
+//	int    -> not 0
+//	float  -> not 0.0
+//	string -> not ""
+//	array  -> has at least one element
+//	null   -> false
+func isTruthy(val ast.Node) bool {
+	switch v := val.(type) {
+	case *ast.BoolLiteralNode:
+		return v.Value
+	case *ast.IntLiteralNode:
+		return v.Value != 0
+	case *ast.FloatLiteralNode:
+		return v.Value != 0
+	case *ast.StringLiteralNode:
+		return v.Value != ""
+	case *ast.ArrLiteralNode:
+		return len(v.Elems) > 0
+	case *ast.NullLiteralNode:
+		return false
+	case nil:
+		return false
+	}
+	return true
+}
+
+// Returns a negative number, zero or a positive number like strings.Compare. Ints and floats can be mixed,
+// strings are compared by their bytes
+func (i *Interpreter) compareValues(node *ast.BoolInfixNode, local_scope *Scope) int {
+	leftVal := i.execExpr(node.Left, local_scope)
+	rightVal := i.execExpr(node.Right, local_scope)
 
+	if l, ok := leftVal.(*ast.StringLiteralNode); ok {
+		r, ok := rightVal.(*ast.StringLiteralNode)
+		if !ok {
+			panic(fmt.Sprintf("[ERROR] Cannot compare string with %v\n", rightVal))
 		}
+		return strings.Compare(l.Value, r.Value)
 	}
-	panic(fmt.Sprintf("[ERROR] Unknown bool expression: %v", node))
+
+	var lf, rf float64
+	switch l := leftVal.(type) {
+	case *ast.IntLiteralNode:
+		if r, ok := rightVal.(*ast.IntLiteralNode); ok {
+			switch {
+			case l.Value < r.Value:
+				return -1
+			case l.Value > r.Value:
+				return 1
+			}
+			return 0
+		}
+		lf = float64(l.Value)
+	case *ast.FloatLiteralNode:
+		lf = l.Value
+	default:
+		panic(fmt.Sprintf("[ERROR] Cannot compare %v using %v\n", leftVal, node.Operator))
+	}
+	switch r := rightVal.(type) {
+	case *ast.IntLiteralNode:
+		rf = float64(r.Value)
+	case *ast.FloatLiteralNode:
+		rf = r.Value
+	default:
+		panic(fmt.Sprintf("[ERROR] Cannot compare %v using %v\n", rightVal, node.Operator))
+	}
+	switch {
+	case lf < rf:
+		return -1
+	case lf > rf:
+		return 1
+	}
+	return 0
 }
 
 func (i *Interpreter) execFloatExpr(inode ast.Node, local_scope *Scope) float64 {
-	var node ast.Node = inode
-
-	if emptyNode, ok := inode.(*ast.EmptyExprNode); ok {
-		node = emptyNode.Child
-	}
+	node := unwrapEmpty(inode)
 
 	switch node := node.(type) {
 	case *ast.FloatLiteralNode:
 		return node.Value
 	case *ast.IntLiteralNode:
-		intNode, ok := inode.(*ast.IntLiteralNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not convert to int, got %v\n", inode))
-		}
-		return float64(intNode.Value)
+		return float64(node.Value)
 	case *ast.ReferenceExprNode:
 		val, ok := local_scope.getVar(node.Name)
 		if !ok {
@@ -172,7 +227,7 @@ func (i *Interpreter) execFloatExpr(inode ast.Node, local_scope *Scope) float64
 		return intNode.Value
 	case *ast.FuncCallNode:
 		result := i.execFuncCall(node, local_scope)
-		if result == nil {
+		if result.NodeType() == ast.NullLiteral {
 			panic(fmt.Sprintf("[ERROR] Function %s did not return a value", node.Name.Name))
 		}
 		intNode, ok := result.(*ast.FloatLiteralNode)
@@ -180,6 +235,8 @@ func (i *Interpreter) execFloatExpr(inode ast.Node, local_scope *Scope) float64
 			panic(fmt.Sprintf("[ERROR] Expected int return from function, got %v", result))
 		}
 		return intNode.Value
+	case *ast.FieldAccessNode, *ast.MethodCallNode, *ast.ArrRefNode:
+		return i.execFloatExpr(i.execExpr(node, local_scope), local_scope)
 	case *ast.InfixExprNode:
 		switch node.Operator {
 		case token.PLUS:
@@ -199,52 +256,29 @@ func (i *Interpreter) execFloatExpr(inode ast.Node, local_scope *Scope) float64
 	panic(fmt.Sprintf("[ERROR] Unknown float expression: %v", node))
 }
 
-func (i *Interpreter) isFloatExpr(node ast.InfixExprNode, local_scope *Scope) bool {
-	leftIsFloat := false
-	rightIsFloat := false
-
-	// direct float literals
-	if node.Left.NodeType() == ast.FloatLiteral {
-		leftIsFloat = true
-	}
-	if node.Right.NodeType() == ast.FloatLiteral {
-		rightIsFloat = true
+// Evaluates both sides once and picks the operation from their values. + joins strings when either side is a
+// string, two ints give an int and an int with a float gives a float
+func (i *Interpreter) execInfix(node *ast.InfixExprNode, local_scope *Scope) ast.Node {
+	left := i.execExpr(node.Left, local_scope)
+	right := i.execExpr(node.Right, local_scope)
+	_, leftStr := left.(*ast.StringLiteralNode)
+	_, rightStr := right.(*ast.StringLiteralNode)
+	if leftStr || rightStr {
+		if node.Operator != token.PLUS {
+			panic(fmt.Sprintf("[ERROR] Only supported operator on strings is plus, got %v", node.Operator))
+		}
+		return &ast.StringLiteralNode{Value: i.execStringExpr(left, local_scope) + i.execStringExpr(right, local_scope)}
 	}
 
-	// variable references
-	if node.Left.NodeType() == ast.ReferenceExpr {
-		if refExpr, ok := node.Left.(*ast.ReferenceExprNode); ok {
-			if lVar, found := local_scope.getVar(refExpr.Name); found {
-				if lVar.NodeType() == ast.FloatLiteral {
-					leftIsFloat = true
-				}
-			}
-		}
+	values := &ast.InfixExprNode{Left: left, Operator: node.Operator, Right: right}
+	leftType, rightType := left.NodeType(), right.NodeType()
+	switch {
+	case leftType == ast.IntLiteral && rightType == ast.IntLiteral:
+		return &ast.IntLiteralNode{Value: i.execIntExpr(values, local_scope)}
+	case (leftType == ast.IntLiteral || leftType == ast.FloatLiteral) && (rightType == ast.IntLiteral || rightType == ast.FloatLiteral):
+		return &ast.FloatLiteralNode{Value: i.execFloatExpr(values, local_scope)}
 	}
-	if node.Right.NodeType() == ast.ReferenceExpr {
-		if refExpr, ok := node.Right.(*ast.ReferenceExprNode); ok {
-			if rVar, found := local_scope.getVar(refExpr.Name); found {
-				if rVar.NodeType() == ast.FloatLiteral {
-					rightIsFloat = true
-				}
-			}
-		}
-	}
-
-	// recurse only when the child is another infix expression
-	if !rightIsFloat {
-		if rightNode, ok := node.Right.(*ast.InfixExprNode); ok {
-			rightIsFloat = i.isFloatExpr(*rightNode, local_scope)
-		}
-	}
-	if !leftIsFloat {
-		if leftNode, ok := node.Left.(*ast.InfixExprNode); ok {
-			leftIsFloat = i.isFloatExpr(*leftNode, local_scope)
-		}
-	}
-
-	// expression is float if either side is float
-	return leftIsFloat || rightIsFloat
+	panic(fmt.Sprintf("[ERROR] Cannot use %v on %v and %v", node.Operator, FormatValue(left), FormatValue(right)))
 }
 
 func (i *Interpreter) execExpr(node ast.Node, local_scope *Scope) ast.Node {
@@ -255,14 +289,7 @@ func (i *Interpreter) execExpr(node ast.Node, local_scope *Scope) ast.Node {
 		return &ast.FloatLiteralNode{Value: i.execFloatExpr(node, local_scope)}
 	}
 	if node.NodeType() == ast.InfixExpr {
-		infixNode, ok := node.(*ast.InfixExprNode)
-		if i.isStringExpression(infixNode.Left, local_scope) || i.isStringExpression(infixNode.Right, local_scope) && (ok && infixNode.Operator == token.PLUS) {
-			return &ast.StringLiteralNode{Value: i.execStringExpr(node, local_scope)}
-		}
-		if i.isFloatExpr(*infixNode, local_scope) {
-			return &ast.FloatLiteralNode{Value: i.execFloatExpr(infixNode, local_scope)}
-		}
-		return &ast.IntLiteralNode{Value: i.execIntExpr(node, local_scope)}
+		return i.execInfix(node.(*ast.InfixExprNode), local_scope)
 	}
 	if node.NodeType() == ast.CallBuiltin {
 		res := i.callBuiltin(node, local_scope)
@@ -288,6 +315,7 @@ func (i *Interpreter) execExpr(node ast.Node, local_scope *Scope) ast.Node {
 			}
 			return sRes
 		}
+		return res
 	}
 
 	if node.NodeType() == ast.BoolLiteral || node.NodeType() == ast.BoolInfix || node.NodeType() == ast.PrefixExpr {
@@ -299,6 +327,26 @@ func (i *Interpreter) execExpr(node ast.Node, local_scope *Scope) ast.Node {
 	if node.NodeType() == ast.StringLiteral {
 		return &ast.StringLiteralNode{Value: i.execStringExpr(node, local_scope)}
 	}
+	if node.NodeType() == ast.NullLiteral {
+		return node
+	}
+	if node.NodeType() == ast.ArrLiteral {
+		arrNode := node.(*ast.ArrLiteralNode)
+		elems := make(map[string]ast.Node)
+		for key, val := range arrNode.Elems {
+			elems[key] = copyValue(i.execExpr(val, local_scope))
+		}
+		return &ast.ArrLiteralNode{Elems: elems}
+	}
+	if node.NodeType() == ast.StructLiteral {
+		return i.instantiateStruct(node.(*ast.StructLiteralNode), local_scope)
+	}
+	if node.NodeType() == ast.FieldAccess {
+		return i.execFieldAccess(node.(*ast.FieldAccessNode), local_scope)
+	}
+	if node.NodeType() == ast.MethodCall {
+		return i.execMethodCall(node.(*ast.MethodCallNode), local_scope)
+	}
 	if node.NodeType() == ast.EmptyExpr {
 		emptExpr, ok := node.(*ast.EmptyExprNode)
 		if !ok {
@@ -317,11 +365,6 @@ func (i *Interpreter) execExpr(node ast.Node, local_scope *Scope) ast.Node {
 		}
 		return local_var
 	}
-	if node.NodeType() == ast.CallBuiltin {
-		res := i.callBuiltin(node, local_scope)
-
-		return res
-	}
 	if node.NodeType() == ast.ArrReassign {
 		reassignNode := node.(*ast.ArrReassignNode)
 
@@ -329,6 +372,9 @@ func (i *Interpreter) execExpr(node ast.Node, local_scope *Scope) ast.Node {
 		if !found {
 			panic(fmt.Sprintf("[ERROR] Could not find array %v\n", reassignNode.Arr.Name))
 		}
+		if local_scope.isConst(reassignNode.Arr.Name) {
+			panic(fmt.Sprintf("[ERROR] Cannot modify elements of constant %v\n", reassignNode.Arr.Name))
+		}
 		arrLit, ok := arr.(*ast.ArrLiteralNode)
 		if !ok {
 			panic(fmt.Sprintf("[ERROR] Variable %v is not an array\n", reassignNode.Arr.Name))
@@ -337,8 +383,10 @@ func (i *Interpreter) execExpr(node ast.Node, local_scope *Scope) ast.Node {
 		idxVal := i.execExpr(reassignNode.Idx, local_scope)
 		key := idxVal.String() 
 
-		arrLit.Elems[key] = i.execExpr(reassignNode.NewVal, local_scope);
-		return i.execExpr(reassignNode.NewVal, local_scope);
+		// Copied like any other assignment, so arr[0] = arr can't make the array contain itself
+		newVal := copyValue(i.execExpr(reassignNode.NewVal, local_scope))
+		arrLit.Elems[key] = newVal
+		return newVal
 }
 
 	if node.NodeType() == ast.ArrRef {
@@ -355,9 +403,72 @@ func (i *Interpreter) execExpr(node ast.Node, local_scope *Scope) ast.Node {
 		idxVal := i.execExpr(refNode.Idx, local_scope)
 		key := idxVal.String()
 
-		return arrLit.Elems[key]
+		val, ok := arrLit.Elems[key]
+		if !ok {
+			panic(fmt.Sprintf("[ERROR] Index %v is out of range for array %v\n", FormatValue(idxVal), refNode.Arr.Name))
+		}
+		return val
 	}
 
 
 	panic(fmt.Sprintf("[ERROR] Could not figure out what to evaluate, got %v of type %v\n", node, node.NodeType()))
 }
+
+// Values of different types are never equal, null is only equal to null, arrays and structs are compared element by element
+func valuesEqual(leftVal ast.Node, rightVal ast.Node) bool {
+	switch l := leftVal.(type) {
+	case *ast.IntLiteralNode:
+		r, ok := rightVal.(*ast.IntLiteralNode)
+		if !ok {
+			return false
+		}
+		return l.Value == r.Value
+	case *ast.BoolLiteralNode:
+		r, ok := rightVal.(*ast.BoolLiteralNode)
+		if !ok {
+			return false
+		}
+		return l.Value == r.Value
+	case *ast.StringLiteralNode:
+		r, ok := rightVal.(*ast.StringLiteralNode)
+		if !ok {
+			return false
+		}
+		return l.Value == r.Value
+	case *ast.FloatLiteralNode:
+		r, ok := rightVal.(*ast.FloatLiteralNode)
+		if !ok {
+			return false
+		}
+		return l.Value == r.Value
+	case *ast.NullLiteralNode:
+		return rightVal.NodeType() == ast.NullLiteral
+	case *ast.StructLiteralNode:
+		// Structs are equal when they are the same type and every field is equal
+		r, ok := rightVal.(*ast.StructLiteralNode)
+		if !ok || l.Name != r.Name || len(l.Fields) != len(r.Fields) {
+			return false
+		}
+		for j, field := range l.Fields {
+			if !valuesEqual(field.Value, r.Fields[j].Value) {
+				return false
+			}
+		}
+		return true
+	case *ast.ArrLiteralNode:
+		// Arrays are equal when they have the same keys and every element is equal
+		r, ok := rightVal.(*ast.ArrLiteralNode)
+		if !ok || len(l.Elems) != len(r.Elems) {
+			return false
+		}
+		for key, val := range l.Elems {
+			other, ok := r.Elems[key]
+			if !ok || !valuesEqual(val, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,245 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"testing/fstest"
+	"toy_lang/ast"
+)
+
+// WriteFS is a file system the file builtins can also change, names are slash separated and relative to its
+// root like the names of an fs.FS
+type WriteFS interface {
+	fs.FS
+	WriteFile(name string, data []byte) error
+	AppendFile(name string, data []byte) error
+	Remove(name string) error
+}
+
+// DirFS gives toy code the files under root and nothing else, names with .. and symlinks that lead out of
+// root can't reach past it
+func DirFS(root string) WriteFS {
+	return dirFS{root: root}
+}
+
+// Every operation goes through an os.Root, which checks each step of the path as it opens it so a symlink
+// swapped in after a check can't lead out of the root either
+type dirFS struct {
+	root string
+}
+
+func (d dirFS) openRoot(op, name string) (*os.Root, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	root, err := os.OpenRoot(d.root)
+	if err != nil {
+		return nil, hideRoot(op, name, err)
+	}
+	return root, nil
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	root, err := d.openRoot("open", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, hideRoot("open", name, err)
+	}
+	return f, nil
+}
+
+func (d dirFS) WriteFile(name string, data []byte) error {
+	return d.write(name, data, os.O_TRUNC)
+}
+
+func (d dirFS) AppendFile(name string, data []byte) error {
+	return d.write(name, data, os.O_APPEND)
+}
+
+func (d dirFS) write(name string, data []byte, flag int) error {
+	root, err := d.openRoot("open", name)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	f, err := root.OpenFile(name, flag|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return hideRoot("open", name, err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return hideRoot("open", name, err)
+}
+
+// Only files can be removed, like in a MemFS, even though os.Remove would also remove an empty directory
+func (d dirFS) Remove(name string) error {
+	root, err := d.openRoot("remove", name)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	info, err := root.Lstat(name)
+	if err != nil {
+		return hideRoot("remove", name, err)
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("is a directory")}
+	}
+	return hideRoot("remove", name, root.Remove(name))
+}
+
+// Errors from the os package have the full path and the system call in them, toy code only gets to see the
+// name it used and what it was doing
+func hideRoot(op, name string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return &fs.PathError{Op: op, Path: name, Err: pathErr.Err}
+	}
+	return err
+}
+
+// MemFS is a WriteFS held in memory, directories exist as long as there are files in them. Start it with
+// NewMemFS or NewMemFS(map[string]string{"data.txt": "..."})
+type MemFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+}
+
+func NewMemFS(files map[string]string) *MemFS {
+	m := &MemFS{files: make(fstest.MapFS)}
+	for name, data := range files {
+		m.files[name] = &fstest.MapFile{Data: []byte(data), Mode: 0o644}
+	}
+	return m
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Open(name)
+}
+
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	return m.write("write", name, data, false)
+}
+
+func (m *MemFS) AppendFile(name string, data []byte) error {
+	return m.write("append", name, data, true)
+}
+
+func (m *MemFS) write(op, name string, data []byte, appending bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if info, err := fs.Stat(m.files, name); err == nil && info.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errors.New("is a directory")}
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+		}
+	}
+	old := m.files[name]
+	if appending && old != nil {
+		data = append(append([]byte{}, old.Data...), data...)
+	}
+	m.files[name] = &fstest.MapFile{Data: append([]byte{}, data...), Mode: 0o644}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		if info, err := fs.Stat(m.files, name); err == nil && info.IsDir() {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("is a directory")}
+		}
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// The name a toy path has in the file system, ./a/../b.txt is b.txt. Absolute paths and paths that leave
+// the root are an error
+func fsName(builtin, p string) string {
+	name := path.Clean(p)
+	if !fs.ValidPath(name) {
+		panic(fmt.Sprintf("[ERROR] %v: invalid path %q, paths are relative to the root of the file system and can't go above it", builtin, p))
+	}
+	return name
+}
+
+// The interpreter's file system for a builtin, panics when it has none or the builtin writes and it is read only
+func (i *Interpreter) fileSystem(builtin string, writing bool) fs.FS {
+	if i.FS == nil {
+		panic(fmt.Sprintf("[ERROR] %v is not allowed, the program was not given any files", builtin))
+	}
+	if _, ok := i.FS.(WriteFS); writing && !ok {
+		panic(fmt.Sprintf("[ERROR] %v is not allowed, the program's files are read only", builtin))
+	}
+	return i.FS
+}
+
+// readFile, listDir and exists only need an fs.FS, writeFile, appendFile and removeFile need a WriteFS
+func (i *Interpreter) callFileBuiltin(inode *ast.CallBuiltinNode, local_scope *Scope) ast.Node {
+	writing := inode.Name == "writeFile" || inode.Name == "appendFile" || inode.Name == "removeFile"
+	fsys := i.fileSystem(inode.Name, writing)
+	p, ok := i.execExpr(inode.Params[0], local_scope).(*ast.StringLiteralNode)
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] %v needs a path string", inode.Name))
+	}
+	name := fsName(inode.Name, p.Value)
+	fileErr := func(err error) {
+		if err != nil {
+			panic(fmt.Sprintf("[ERROR] %v: %v", inode.Name, err))
+		}
+	}
+	switch inode.Name {
+	case "readFile":
+		data, err := fs.ReadFile(fsys, name)
+		fileErr(err)
+		return &ast.StringLiteralNode{Value: string(data)}
+	case "listDir":
+		entries, err := fs.ReadDir(fsys, name)
+		fileErr(err)
+		elems := make(map[string]ast.Node, len(entries))
+		for j, entry := range entries {
+			key := ast.IntLiteralNode{Value: j}
+			elems[key.String()] = &ast.StringLiteralNode{Value: entry.Name()}
+		}
+		return &ast.ArrLiteralNode{Elems: elems}
+	case "exists":
+		_, err := fs.Stat(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return &ast.BoolLiteralNode{Value: false}
+		}
+		fileErr(err)
+		return &ast.BoolLiteralNode{Value: true}
+	case "writeFile", "appendFile":
+		data, ok := i.execExpr(inode.Params[1], local_scope).(*ast.StringLiteralNode)
+		if !ok {
+			panic(fmt.Sprintf("[ERROR] %v needs a string to write, use str() to convert other values", inode.Name))
+		}
+		if inode.Name == "writeFile" {
+			fileErr(fsys.(WriteFS).WriteFile(name, []byte(data.Value)))
+		} else {
+			fileErr(fsys.(WriteFS).AppendFile(name, []byte(data.Value)))
+		}
+	case "removeFile":
+		fileErr(fsys.(WriteFS).Remove(name))
+	}
+	return &ast.NullLiteralNode{}
+}
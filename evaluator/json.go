@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"toy_lang/ast"
+)
+
+// FromJSON turns JSON into toy values. Arrays become arrays indexed from 0 and objects become arrays indexed by
+// their keys, like d["name"]. Numbers without a fraction or exponent that fit in an int are ints, other
+// numbers are floats and numbers too big for a float are an error
+func FromJSON(data string) (ast.Node, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	var val any
+	if err := dec.Decode(&val); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("no JSON value")
+		}
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return fromJSONValue(val)
+}
+
+func fromJSONValue(val any) (ast.Node, error) {
+	switch v := val.(type) {
+	case map[string]any:
+		elems := make(map[string]ast.Node, len(v))
+		for key, elem := range v {
+			k := ast.StringLiteralNode{Value: key}
+			node, err := fromJSONValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[k.String()] = node
+		}
+		return &ast.ArrLiteralNode{Elems: elems}, nil
+	case []any:
+		elems := make(map[string]ast.Node, len(v))
+		for j, elem := range v {
+			k := ast.IntLiteralNode{Value: j}
+			node, err := fromJSONValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[k.String()] = node
+		}
+		return &ast.ArrLiteralNode{Elems: elems}, nil
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			if n, err := strconv.Atoi(string(v)); err == nil {
+				return &ast.IntLiteralNode{Value: n}, nil
+			}
+		}
+		// Too big for a float too, like 1e400, which would otherwise become +Inf
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("number out of range: %v", v)
+		}
+		return &ast.FloatLiteralNode{Value: f}, nil
+	case string:
+		return &ast.StringLiteralNode{Value: v}, nil
+	case bool:
+		return &ast.BoolLiteralNode{Value: v}, nil
+	}
+	return &ast.NullLiteralNode{}, nil
+}
+
+// ToJSON writes a toy value as JSON, arrays indexed from 0 become JSON arrays and other arrays and structs
+// become objects. A non empty indent puts every element on its own line, indented by indent once per level.
+// Values that contain themselves and values JSON has nothing for, like modules and NaN, are an error
+func ToJSON(val ast.Node, indent string) (string, error) {
+	enc := jsonEncoder{indent: indent, active: make(map[ast.Node]bool)}
+	if err := enc.write(val, 0); err != nil {
+		return "", err
+	}
+	return enc.out.String(), nil
+}
+
+type jsonEncoder struct {
+	out    strings.Builder
+	indent string
+	// Arrays and structs being written, meeting one of them again means there is a cycle
+	active map[ast.Node]bool
+}
+
+func (e *jsonEncoder) write(val ast.Node, depth int) error {
+	switch v := val.(type) {
+	case nil, *ast.NullLiteralNode:
+		e.out.WriteString("null")
+	case *ast.BoolLiteralNode:
+		e.out.WriteString(strconv.FormatBool(v.Value))
+	case *ast.IntLiteralNode:
+		e.out.WriteString(strconv.Itoa(v.Value))
+	case *ast.FloatLiteralNode:
+		if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+			return fmt.Errorf("%v can't be written as JSON", FormatValue(v))
+		}
+		num, _ := json.Marshal(v.Value)
+		e.out.Write(num)
+	case *ast.StringLiteralNode:
+		e.writeString(v.Value)
+	case *ast.ArrLiteralNode:
+		if e.active[v] {
+			return errors.New("the value contains itself, a cycle can't be written as JSON")
+		}
+		e.active[v] = true
+		defer delete(e.active, v)
+		keys := ast.ElemKeys(v)
+		if isList(keys) {
+			return e.writeElems('[', ']', len(keys), depth, func(j int) (string, ast.Node) { return "", v.Elems[keys[j]] })
+		}
+		return e.writeElems('{', '}', len(keys), depth, func(j int) (string, ast.Node) {
+			return jsonKey(keys[j]), v.Elems[keys[j]]
+		})
+	case *ast.StructLiteralNode:
+		if e.active[v] {
+			return errors.New("the value contains itself, a cycle can't be written as JSON")
+		}
+		e.active[v] = true
+		defer delete(e.active, v)
+		return e.writeElems('{', '}', len(v.Fields), depth, func(j int) (string, ast.Node) {
+			return v.Fields[j].Name, v.Fields[j].Value
+		})
+	case *Module:
+		return fmt.Errorf("%v can't be written as JSON", v)
+	default:
+		return fmt.Errorf("a %v can't be written as JSON, only null, bools, numbers, strings, arrays and structs can", val.NodeType())
+	}
+	return nil
+}
+
+// Writes n elements between open and close, elem gives the key of each one ("" in arrays) and its value
+func (e *jsonEncoder) writeElems(open, close byte, n, depth int, elem func(j int) (string, ast.Node)) error {
+	e.out.WriteByte(open)
+	for j := 0; j < n; j++ {
+		if j > 0 {
+			e.out.WriteByte(',')
+		}
+		e.newline(depth + 1)
+		key, val := elem(j)
+		if open == '{' {
+			e.writeString(key)
+			e.out.WriteByte(':')
+			if e.indent != "" {
+				e.out.WriteByte(' ')
+			}
+		}
+		if err := e.write(val, depth+1); err != nil {
+			return err
+		}
+	}
+	if n > 0 {
+		e.newline(depth)
+	}
+	e.out.WriteByte(close)
+	return nil
+}
+
+func (e *jsonEncoder) newline(depth int) {
+	if e.indent != "" {
+		e.out.WriteByte('\n')
+		e.out.WriteString(strings.Repeat(e.indent, depth))
+	}
+}
+
+// Quotes a string for JSON without escaping <, > and & the way json.Marshal does
+func (e *jsonEncoder) writeString(s string) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	e.out.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// The object key for an array key, keys are stored as the String() of the key value like STRING(name) or INT(3)
+func jsonKey(key string) string {
+	for _, prefix := range []string{"STRING(", "INT(", "FLOAT(", "BOOL("} {
+		if strings.HasPrefix(key, prefix) && strings.HasSuffix(key, ")") {
+			return key[len(prefix) : len(key)-1]
+		}
+	}
+	return strings.ToLower(key)
+}
+
+// jsonParse(str) and jsonStringify(value, indent), indent is a number of spaces or the string to indent with
+func (i *Interpreter) callJSON(inode *ast.CallBuiltinNode, local_scope *Scope) ast.Node {
+	if inode.Name == "jsonParse" {
+		data, ok := i.execExpr(inode.Params[0], local_scope).(*ast.StringLiteralNode)
+		if !ok {
+			panic("[ERROR] jsonParse needs a string")
+		}
+		val, err := FromJSON(data.Value)
+		if err != nil {
+			panic(fmt.Sprintf("[ERROR] jsonParse: %v", err))
+		}
+		return val
+	}
+
+	val := i.execExpr(inode.Params[0], local_scope)
+	var indent string
+	switch n := i.execExpr(inode.Params[1], local_scope).(type) {
+	case *ast.IntLiteralNode:
+		if n.Value < 0 || n.Value > 10 {
+			panic(fmt.Sprintf("[ERROR] jsonStringify needs an indent from 0 to 10 spaces, got %d", n.Value))
+		}
+		indent = strings.Repeat(" ", n.Value)
+	case *ast.StringLiteralNode:
+		indent = n.Value
+	default:
+		panic("[ERROR] jsonStringify needs an indent that is a number of spaces or a string")
+	}
+	text, err := ToJSON(val, indent)
+	if err != nil {
+		panic(fmt.Sprintf("[ERROR] jsonStringify: %v", err))
+	}
+	return &ast.StringLiteralNode{Value: text}
+}
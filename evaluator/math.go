@@ -0,0 +1,161 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"toy_lang/ast"
+)
+
+// Modules that come with the interpreter, import "math" as m; gets one without reading a file
+var stdModules = map[string]func() *Module{
+	"math": newMathModule,
+}
+
+// Parameter names of the functions in the math module
+var mathFuncs = map[string][]string{
+	"sqrt": {"x"}, "pow": {"x", "y"}, "abs": {"x"},
+	"floor": {"x"}, "ceil": {"x"}, "round": {"x"},
+	"min": {"a", "b"}, "max": {"a", "b"},
+	"sin": {"x"}, "cos": {"x"}, "tan": {"x"},
+	"asin": {"x"}, "acos": {"x"}, "atan": {"x"}, "atan2": {"y", "x"},
+	"exp": {"x"}, "log": {"x"}, "log2": {"x"}, "log10": {"x"},
+}
+
+// The functions of the math module call builtins named math.sqrt and so on, pi and e are constants
+func newMathModule() *Module {
+	mod := &Module{
+		Path: "math",
+		Scope: &Scope{
+			Vars:    make(v_map),
+			Funcs:   make(f_map),
+			Consts:  make(map[string]bool),
+			Structs: make(map[string]*ast.StructDecNode),
+		},
+		Exports: make(map[string]bool),
+	}
+	for name, paramNames := range mathFuncs {
+		var params []ast.ReferenceExprNode
+		var args []ast.Node
+		for _, param := range paramNames {
+			params = append(params, ast.ReferenceExprNode{Name: param})
+			args = append(args, &ast.ReferenceExprNode{Name: param})
+		}
+		mod.Scope.Funcs[name] = ast.FuncDecNode{
+			Name:   name,
+			Params: params,
+			Body: []ast.Node{
+				&ast.ReturnExprNode{Val: &ast.CallBuiltinNode{Name: "math." + name, Params: args}},
+			},
+		}
+		mod.Exports[name] = true
+	}
+	for name, val := range map[string]float64{"pi": math.Pi, "e": math.E} {
+		mod.Scope.declareVar(name, &ast.FloatLiteralNode{Value: val})
+		mod.Scope.Consts[name] = true
+		mod.Exports[name] = true
+	}
+	return mod
+}
+
+// Runs a function of the math module. abs, min and max keep ints as ints, floor, ceil and round give ints and
+// everything else gives a float
+func (i *Interpreter) callMath(inode *ast.CallBuiltinNode, local_scope *Scope) ast.Node {
+	name := strings.TrimPrefix(inode.Name, "math.")
+	vals := make([]ast.Node, len(inode.Params))
+	nums := make([]float64, len(inode.Params))
+	allInts := true
+	for j, param := range inode.Params {
+		vals[j] = i.execExpr(param, local_scope)
+		switch v := vals[j].(type) {
+		case *ast.IntLiteralNode:
+			nums[j] = float64(v.Value)
+		case *ast.FloatLiteralNode:
+			nums[j] = v.Value
+			allInts = false
+		default:
+			panic(fmt.Sprintf("[ERROR] math.%v needs numbers, got %v", name, FormatValue(vals[j])))
+		}
+	}
+
+	switch name {
+	case "abs":
+		if allInts {
+			n := vals[0].(*ast.IntLiteralNode).Value
+			if n == math.MinInt64 {
+				panic(fmt.Sprintf("[ERROR] math.abs(%v) is too big for an int", n))
+			}
+			if n < 0 {
+				n = -n
+			}
+			return &ast.IntLiteralNode{Value: n}
+		}
+		return &ast.FloatLiteralNode{Value: math.Abs(nums[0])}
+	case "min", "max":
+		pick := 0
+		if (name == "min") == (nums[1] < nums[0]) {
+			pick = 1
+		}
+		return vals[pick]
+	case "floor":
+		return floatToInt(math.Floor(nums[0]))
+	case "ceil":
+		return floatToInt(math.Ceil(nums[0]))
+	case "round":
+		return floatToInt(math.Round(nums[0]))
+	}
+
+	var res float64
+	switch name {
+	case "sqrt":
+		res = math.Sqrt(nums[0])
+	case "pow":
+		res = math.Pow(nums[0], nums[1])
+	case "sin":
+		res = math.Sin(nums[0])
+	case "cos":
+		res = math.Cos(nums[0])
+	case "tan":
+		res = math.Tan(nums[0])
+	case "asin":
+		res = math.Asin(nums[0])
+	case "acos":
+		res = math.Acos(nums[0])
+	case "atan":
+		res = math.Atan(nums[0])
+	case "atan2":
+		res = math.Atan2(nums[0], nums[1])
+	case "exp":
+		res = math.Exp(nums[0])
+	case "log":
+		res = math.Log(nums[0])
+	case "log2":
+		res = math.Log2(nums[0])
+	case "log10":
+		res = math.Log10(nums[0])
+	default:
+		panic(fmt.Sprintf("[ERROR] Unknown builtin function %v", inode.Name))
+	}
+	// Arguments outside of what the function takes, like sqrt(-1), are an error rather than NaN. So are the
+	// poles at 0 of log(0) and pow(0, -1), an infinity from a large argument like exp(1000) is only an overflow
+	if math.IsNaN(res) || (math.IsInf(res, 0) && nums[0] == 0) {
+		panic(fmt.Sprintf("[ERROR] math.%v is not defined for %v", name, formatArgs(vals)))
+	}
+	return &ast.FloatLiteralNode{Value: res}
+}
+
+func formatArgs(vals []ast.Node) string {
+	var parts []string
+	for _, val := range vals {
+		parts = append(parts, FormatValue(val))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Floats become ints by dropping the fraction, NaN and numbers too big for an int can't
+func floatToInt(f float64) *ast.IntLiteralNode {
+	if math.IsNaN(f) || f >= math.MaxInt64 || f < math.MinInt64 {
+		panic(fmt.Sprintf("[ERROR] Cannot convert %v to int", FormatValue(&ast.FloatLiteralNode{Value: f})))
+	}
+	return &ast.IntLiteralNode{Value: int(f)}
+}
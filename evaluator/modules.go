@@ -0,0 +1,166 @@
+package evaluator
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/lexer"
+	"toy_lang/parser"
+	"toy_lang/resolver"
+)
+
+// Module is the value an import alias is bound to
+type Module struct {
+	Path    string
+	Scope   *Scope
+	Exports map[string]bool
+}
+
+func (m *Module) NodeType() ast.AstNode {
+	return ast.Module
+}
+func (m *Module) String() string {
+	return fmt.Sprintf("module(%v)", m.Path)
+}
+
+// Sets the file being run so imports are resolved relative to it and importing it back is a cycle
+func (i *Interpreter) SetFile(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	i.dir = filepath.Dir(path)
+	i.importStack = []string{path}
+	i.file = path
+}
+
+func (i *Interpreter) execImport(node *ast.ImportStmtNode, local_scope *Scope) {
+	if newModule, ok := stdModules[node.Path]; ok {
+		mod, ok := i.modules[node.Path]
+		if !ok {
+			mod = newModule()
+			i.modules[node.Path] = mod
+		}
+		local_scope.declareVar(node.Alias, mod)
+		local_scope.Consts[node.Alias] = true
+		return
+	}
+	path := i.modulePath(node.Path)
+
+	mod, ok := i.modules[path]
+	if !ok {
+		mod = i.loadModule(path)
+	}
+	local_scope.declareVar(node.Alias, mod)
+	local_scope.Consts[node.Alias] = true
+}
+
+// Where an import points, an absolute path on disk or a name in Interpreter.FS when the program was given
+// files. Then modules come from those files too so imports can't reach anything the program couldn't read
+func (i *Interpreter) modulePath(p string) string {
+	if i.FS != nil {
+		// The main file may be outside the files, its imports start at their root
+		if !filepath.IsAbs(p) && i.file != "" && !filepath.IsAbs(i.file) {
+			p = path.Join(path.Dir(i.file), p)
+		}
+		return fsName("import", p)
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(i.dir, p)
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		panic(fmt.Sprintf("[ERROR] Could not import %v: %v\n", p, err))
+	}
+	return abs
+}
+
+// Runs a module file in its own scope, each file is only run once and then served from the cache
+func (i *Interpreter) loadModule(path string) *Module {
+	for j, loading := range i.importStack {
+		if loading == path {
+			cycle := append(append([]string{}, i.importStack[j:]...), path)
+			for k := range cycle {
+				cycle[k] = filepath.Base(cycle[k])
+			}
+			panic(fmt.Sprintf("[ERROR] Import cycle: %v\n", strings.Join(cycle, " -> ")))
+		}
+	}
+
+	var source []byte
+	var err error
+	if i.FS != nil {
+		source, err = fs.ReadFile(i.FS, path)
+	} else {
+		source, err = os.ReadFile(path)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("[ERROR] Could not import %v: %v\n", path, err))
+	}
+	program := parser.NewParser().Parse(lexer.NewLexer().Lex(string(source)))
+	if errs := resolver.NewResolver().Resolve(program); len(errs) > 0 {
+		panic(fmt.Sprintf("[ERROR] In module %v: %v\n", filepath.Base(path), errs[0]))
+	}
+
+	mod := &Module{
+		Path:    path,
+		Scope:   i.MainScope.Parent.newChild(),
+		Exports: make(map[string]bool),
+	}
+	oldDir, oldFile := i.dir, i.file
+	i.dir, i.file = filepath.Dir(path), path
+	i.importStack = append(i.importStack, path)
+	defer func() {
+		i.dir, i.file = oldDir, oldFile
+		i.importStack = i.importStack[:len(i.importStack)-1]
+	}()
+	if i.Hook != nil {
+		i.pushFrame(moduleFrameName(path), mod.Scope)
+		defer i.popFrame()
+	}
+	if hook, ok := i.Hook.(ProgramHook); ok {
+		hook.Program(path, &program)
+	}
+
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStmtNode); ok {
+			switch n := export.Stmt.(type) {
+			case *ast.FuncDecNode:
+				mod.Exports[n.Name] = true
+			case *ast.LetStmtNode:
+				mod.Exports[n.Name] = true
+			}
+		}
+		i.executeStmt(stmt, mod.Scope)
+	}
+	i.modules[path] = mod
+	return mod
+}
+
+// m.name, only exported constants can be read from outside the module
+func (m *Module) getExport(name string) ast.Node {
+	if !m.Exports[name] {
+		panic(fmt.Sprintf("[ERROR] Module %v does not export %v\n", filepath.Base(m.Path), name))
+	}
+	val, ok := m.Scope.Vars[name]
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] %v is a function in module %v, call it with ()\n", name, filepath.Base(m.Path)))
+	}
+	return copyValue(val)
+}
+
+// m.f(args), the function runs inside the module's scope with its arguments evaluated in the caller's
+func (i *Interpreter) callExport(m *Module, node *ast.MethodCallNode, local_scope *Scope) ast.Node {
+	f, ok := m.Scope.Funcs[node.Name]
+	if !m.Exports[node.Name] || !ok {
+		panic(fmt.Sprintf("[ERROR] Module %v does not export function %v\n", filepath.Base(m.Path), node.Name))
+	}
+	// The arguments are evaluated before the call, so the file only changes for the body
+	oldFile := i.file
+	defer func() { i.file = oldFile }()
+	i.file = m.Path
+	return i.callFunc(f, node.Params, local_scope, m.Scope, nil, false)
+}
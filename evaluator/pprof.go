@@ -0,0 +1,207 @@
+package evaluator
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Field numbers of the pprof profile.proto messages that are written
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileMapping           = 3
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingID             = 1
+	mappingFilename       = 5
+	mappingHasFunctions   = 7
+	mappingHasFilenames   = 8
+	mappingHasLineNumbers = 9
+
+	locationID        = 1
+	locationMappingID = 2
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// WritePprof writes the profile gzipped in the protobuf format of go tool pprof. Every call stack that ran is a
+// sample with the statements it started and the nanoseconds spent in it, the frames are lines of toy functions
+func (p *Profiler) WritePprof(w io.Writer) error {
+	var b protobuf
+	ids := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) uint64 {
+		id, ok := ids[s]
+		if !ok {
+			id = len(table)
+			ids[s] = id
+			table = append(table, s)
+		}
+		return uint64(id)
+	}
+	valueType := func(field int, typ, unit string) {
+		b.message(field, func(b *protobuf) {
+			b.uint64(valueTypeType, str(typ))
+			b.uint64(valueTypeUnit, str(unit))
+		})
+	}
+	valueType(profileSampleType, "statements", "count")
+	valueType(profileSampleType, "time", "nanoseconds")
+	// A single mapping for the interpreter, pprof wants one to say the functions are symbolized
+	b.message(profileMapping, func(b *protobuf) {
+		b.uint64(mappingID, 1)
+		b.uint64(mappingFilename, str("toy_lang"))
+		b.uint64(mappingHasFunctions, 1)
+		b.uint64(mappingHasFilenames, 1)
+		b.uint64(mappingHasLineNumbers, 1)
+	})
+
+	funcs := make(map[funcKey]uint64)
+	locs := make(map[location]uint64)
+	var locOrder []location
+	locID := func(loc location) uint64 {
+		id, ok := locs[loc]
+		if !ok {
+			id = uint64(len(locs) + 1)
+			locs[loc] = id
+			locOrder = append(locOrder, loc)
+		}
+		return id
+	}
+
+	var samples func(n *stackNode)
+	samples = func(n *stackNode) {
+		if n.hits > 0 || n.time > 0 {
+			var ids []uint64
+			for s := n; s != p.root; s = s.parent {
+				ids = append(ids, locID(s.loc))
+			}
+			b.message(profileSample, func(b *protobuf) {
+				b.packed(sampleLocationID, ids)
+				b.packed(sampleValue, []uint64{uint64(n.hits), uint64(n.time)})
+			})
+		}
+		// Children in a fixed order so the same run gives the same file
+		children := make([]*stackNode, 0, len(n.children))
+		for _, child := range n.children {
+			children = append(children, child)
+		}
+		sort.Slice(children, func(a, b int) bool {
+			x, y := children[a].loc, children[b].loc
+			if x.file != y.file {
+				return x.file < y.file
+			}
+			if x.line != y.line {
+				return x.line < y.line
+			}
+			return x.name < y.name
+		})
+		for _, child := range children {
+			samples(child)
+		}
+	}
+	samples(p.root)
+
+	for _, loc := range locOrder {
+		key := funcKey{loc.name, loc.file}
+		fnID, ok := funcs[key]
+		if !ok {
+			fnID = uint64(len(funcs) + 1)
+			funcs[key] = fnID
+			b.message(profileFunction, func(b *protobuf) {
+				b.uint64(functionID, fnID)
+				// pprof drops names in angle brackets like C++ template arguments, so <main> is written as main
+				name := strings.Trim(loc.name, "<>")
+				b.uint64(functionName, str(name))
+				b.uint64(functionSystemName, str(name))
+				b.uint64(functionFilename, str(loc.file))
+			})
+		}
+		b.message(profileLocation, func(b *protobuf) {
+			b.uint64(locationID, locs[loc])
+			b.uint64(locationMappingID, 1)
+			b.message(locationLine, func(b *protobuf) {
+				b.uint64(lineFunctionID, fnID)
+				b.uint64(lineLine, uint64(loc.line))
+			})
+		})
+	}
+
+	if !p.start.IsZero() {
+		b.uint64(profileTimeNanos, uint64(p.start.UnixNano()))
+	}
+	b.uint64(profileDurationNanos, uint64(p.total))
+	b.uint64(profileDefaultSampleType, str("time"))
+	for _, s := range table {
+		b.bytes(profileStringTable, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Just enough of the protobuf wire format for a profile
+type protobuf struct {
+	data []byte
+}
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+// Writes a varint field, zero is the default so it is left out
+func (b *protobuf) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field)<<3 | 0)
+	b.varint(x)
+}
+
+// Writes a length delimited field, strings are always written because the string table needs its "" entry
+func (b *protobuf) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protobuf) packed(field int, xs []uint64) {
+	var inner protobuf
+	for _, x := range xs {
+		inner.varint(x)
+	}
+	b.bytes(field, inner.data)
+}
+
+func (b *protobuf) message(field int, write func(b *protobuf)) {
+	var inner protobuf
+	write(&inner)
+	b.bytes(field, inner.data)
+}
@@ -0,0 +1,235 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// FuncProfile is what a Profiler measured for one function
+type FuncProfile struct {
+	// See Frame.Name, the file is the one the function was called from for builtins
+	Name string
+	File string
+	// Calls made to the function, <main> and modules count once per run
+	Calls int
+	// Time from the calls starting to them returning, recursive calls are only counted once
+	Inclusive time.Duration
+	// Inclusive time minus the time spent in the functions it called
+	Exclusive time.Duration
+}
+
+// LineProfile is how many statements starting on a line ran
+type LineProfile struct {
+	File string
+	Line int
+	// The function the line is in
+	Func string
+	Hits int
+}
+
+// Profiler is a CallHook that counts calls and statements and times every function. It also keeps the time
+// spent on each line by call stack, which WritePprof writes in the format go tool pprof reads
+type Profiler struct {
+	funcs map[funcKey]*FuncProfile
+	lines map[location]*LineProfile
+	// Calls of each function that are running, for not counting recursive calls twice
+	running map[*FuncProfile]int
+	calls   []*activeCall
+	root    *stackNode
+	// When the profile started, when the last event happened and the time charged so far
+	start time.Time
+	last  time.Time
+	total time.Duration
+	now   func() time.Time
+}
+
+type funcKey struct {
+	name, file string
+}
+
+// A line of a function, the places a pprof profile is made of
+type location struct {
+	name, file string
+	line       int
+}
+
+type activeCall struct {
+	fn      *FuncProfile
+	started time.Time
+	// Inclusive time of the calls made from this one
+	children time.Duration
+	// Where the caller was when it made the call and where this call is now, line 0 of the function until
+	// its first statement
+	caller *stackNode
+	node   *stackNode
+}
+
+// A call stack ending on a line, the root is empty and every node below it adds a line
+type stackNode struct {
+	loc      location
+	parent   *stackNode
+	children map[location]*stackNode
+	// Statements started and time spent with exactly this stack
+	hits int
+	time time.Duration
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		funcs:   make(map[funcKey]*FuncProfile),
+		lines:   make(map[location]*LineProfile),
+		running: make(map[*FuncProfile]int),
+		root:    &stackNode{children: make(map[location]*stackNode)},
+		now:     time.Now,
+	}
+}
+
+// Charges the time since the last event to the stack the program was on and returns the time now
+func (p *Profiler) tick() time.Time {
+	t := p.now()
+	if p.start.IsZero() {
+		p.start = t
+	} else if len(p.calls) > 0 {
+		elapsed := t.Sub(p.last)
+		p.calls[len(p.calls)-1].node.time += elapsed
+		p.total += elapsed
+	}
+	p.last = t
+	return t
+}
+
+func (p *Profiler) Call(stack []*Frame) {
+	t := p.tick()
+	top := stack[len(stack)-1]
+	key := funcKey{top.Name, top.File}
+	fn, ok := p.funcs[key]
+	if !ok {
+		fn = &FuncProfile{Name: top.Name, File: top.File}
+		p.funcs[key] = fn
+	}
+	fn.Calls++
+	p.running[fn]++
+
+	caller := p.root
+	if n := len(stack) - 1; n > 0 && n <= len(p.calls) {
+		caller = p.calls[n-1].node
+	}
+	entry := caller.child(location{top.Name, top.File, 0})
+	p.calls = append(p.calls[:min(len(stack)-1, len(p.calls))], &activeCall{fn: fn, started: t, caller: caller, node: entry})
+}
+
+func (p *Profiler) Return(stack []*Frame) {
+	t := p.tick()
+	if len(p.calls) == 0 {
+		return
+	}
+	c := p.calls[len(p.calls)-1]
+	p.calls = p.calls[:len(p.calls)-1]
+	elapsed := t.Sub(c.started)
+	c.fn.Exclusive += elapsed - c.children
+	if len(p.calls) > 0 {
+		p.calls[len(p.calls)-1].children += elapsed
+	}
+	p.running[c.fn]--
+	if p.running[c.fn] == 0 {
+		c.fn.Inclusive += elapsed
+	}
+}
+
+func (p *Profiler) Statement(stack []*Frame) {
+	p.tick()
+	top := stack[len(stack)-1]
+	loc := location{top.Name, top.File, top.Pos.Line}
+	line, ok := p.lines[loc]
+	if !ok {
+		line = &LineProfile{File: top.File, Line: top.Pos.Line, Func: top.Name}
+		p.lines[loc] = line
+	}
+	line.Hits++
+
+	if len(p.calls) == 0 {
+		return
+	}
+	c := p.calls[len(p.calls)-1]
+	c.node = c.caller.child(loc)
+	c.node.hits++
+}
+
+func (n *stackNode) child(loc location) *stackNode {
+	child, ok := n.children[loc]
+	if !ok {
+		child = &stackNode{loc: loc, parent: n, children: make(map[location]*stackNode)}
+		n.children[loc] = child
+	}
+	return child
+}
+
+// Total is the time between the first and the last event
+func (p *Profiler) Total() time.Duration {
+	return p.total
+}
+
+// Functions returns every function that was called, the most exclusive time first
+func (p *Profiler) Functions() []FuncProfile {
+	funcs := make([]FuncProfile, 0, len(p.funcs))
+	for _, fn := range p.funcs {
+		funcs = append(funcs, *fn)
+	}
+	sort.Slice(funcs, func(a, b int) bool {
+		if funcs[a].Exclusive != funcs[b].Exclusive {
+			return funcs[a].Exclusive > funcs[b].Exclusive
+		}
+		if funcs[a].Name != funcs[b].Name {
+			return funcs[a].Name < funcs[b].Name
+		}
+		return funcs[a].File < funcs[b].File
+	})
+	return funcs
+}
+
+// Lines returns every line that ran, the most hits first
+func (p *Profiler) Lines() []LineProfile {
+	lines := make([]LineProfile, 0, len(p.lines))
+	for _, line := range p.lines {
+		lines = append(lines, *line)
+	}
+	sort.Slice(lines, func(a, b int) bool {
+		if lines[a].Hits != lines[b].Hits {
+			return lines[a].Hits > lines[b].Hits
+		}
+		if lines[a].File != lines[b].File {
+			return lines[a].File < lines[b].File
+		}
+		return lines[a].Line < lines[b].Line
+	})
+	return lines
+}
+
+// WriteReport writes the functions and lines as text tables
+func (p *Profiler) WriteReport(w io.Writer) {
+	fmt.Fprintf(w, "Total time: %v\n\nFunctions by exclusive time:\n", roundDuration(p.total))
+	fmt.Fprintf(w, "%12s %12s %12s  %v\n", "calls", "exclusive", "inclusive", "function")
+	for _, fn := range p.Functions() {
+		fmt.Fprintf(w, "%12d %12v %12v  %v\n", fn.Calls, roundDuration(fn.Exclusive), roundDuration(fn.Inclusive), placeName(fn.Name, fn.File, 0))
+	}
+	fmt.Fprintf(w, "\nLines by hits:\n%12s  %v\n", "hits", "line")
+	for _, line := range p.Lines() {
+		fmt.Fprintf(w, "%12d  %v\n", line.Hits, placeName(line.Func, line.File, line.Line))
+	}
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+func placeName(name, file string, line int) string {
+	if file == "" {
+		file = "<eval>"
+	}
+	if line == 0 {
+		return fmt.Sprintf("%v (%v)", name, file)
+	}
+	return fmt.Sprintf("%v:%d (%v)", file, line, name)
+}
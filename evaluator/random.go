@@ -0,0 +1,61 @@
+package evaluator
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+	"toy_lang/ast"
+)
+
+// Seed makes randInt, randf, choice and shuffle give the same values every time the program runs, like
+// seed(n) does from toy code
+func (i *Interpreter) Seed(n int64) {
+	i.Rand = rand.New(rand.NewSource(n))
+}
+
+// The interpreter's own source of random numbers, made the first time it is needed when Rand isn't set
+func (i *Interpreter) rng() *rand.Rand {
+	if i.Rand == nil {
+		i.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return i.Rand
+}
+
+// The elements of an array in order, only arrays indexed 0 to n-1 can be picked from or shuffled
+func (i *Interpreter) listElems(name string, node ast.Node, local_scope *Scope) []ast.Node {
+	arr, ok := i.execExpr(node, local_scope).(*ast.ArrLiteralNode)
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] %v needs an array", name))
+	}
+	elems := make([]ast.Node, len(arr.Elems))
+	for j := range elems {
+		key := ast.IntLiteralNode{Value: j}
+		elem, ok := arr.Elems[key.String()]
+		if !ok {
+			panic(fmt.Sprintf("[ERROR] %v needs an array indexed from 0, got %v", name, FormatValue(arr)))
+		}
+		elems[j] = elem
+	}
+	return elems
+}
+
+// choice(arr) returns a random element of arr
+func (i *Interpreter) callChoice(inode *ast.CallBuiltinNode, local_scope *Scope) ast.Node {
+	elems := i.listElems("choice", inode.Params[0], local_scope)
+	if len(elems) == 0 {
+		panic("[ERROR] choice needs an array with at least one element")
+	}
+	return copyValue(elems[i.rng().Intn(len(elems))])
+}
+
+// shuffle(arr) returns a copy of arr with its elements in a random order, arr itself is left as it was
+func (i *Interpreter) callShuffle(inode *ast.CallBuiltinNode, local_scope *Scope) ast.Node {
+	elems := i.listElems("shuffle", inode.Params[0], local_scope)
+	i.rng().Shuffle(len(elems), func(a, b int) { elems[a], elems[b] = elems[b], elems[a] })
+	shuffled := make(map[string]ast.Node, len(elems))
+	for j, elem := range elems {
+		key := ast.IntLiteralNode{Value: j}
+		shuffled[key.String()] = copyValue(elem)
+	}
+	return &ast.ArrLiteralNode{Elems: shuffled}
+}
@@ -8,7 +8,9 @@ import (
 type Scope struct {
 	Vars   v_map
 	Funcs  f_map
-	Parent *Scope
+	Consts  map[string]bool
+	Structs map[string]*ast.StructDecNode
+	Parent  *Scope
 }
 
 func (s *Scope) getVar(name string) (ast.Node, bool) {
@@ -31,18 +33,49 @@ func (s *Scope) getFunc(name string) (ast.FuncDecNode, bool) {
 	return ast.FuncDecNode{}, false
 }
 
+func (s *Scope) getStruct(name string) (*ast.StructDecNode, bool) {
+	if val, ok := s.Structs[name]; ok {
+		return val, true
+	}
+	if s.Parent != nil {
+		return s.Parent.getStruct(name)
+	}
+	return nil, false
+}
+
+func (s *Scope) declareStruct(dec *ast.StructDecNode) {
+	s.Structs[dec.Name] = dec
+}
+
 func (s *Scope) declareFunc(f ast.FuncDecNode) {
 	s.Funcs[f.Name] = f
 }
 
 func (s *Scope) declareVar(name string, val ast.Node) {
+	if s.Consts[name] {
+		panic(fmt.Sprintf("[ERROR] Cannot redeclare constant %s\n", name))
+	}
 	s.Vars[name] = val
 }
 
+// Reports whether name resolves to a constant, looking through parent scopes like getVar
+func (s *Scope) isConst(name string) bool {
+	if _, ok := s.Vars[name]; ok {
+		return s.Consts[name]
+	}
+	if s.Parent != nil {
+		return s.Parent.isConst(name)
+	}
+	return false
+}
+
 func (s *Scope) assignVar(name string, val ast.Node) bool {
-	// Fixed: Added StringLiteral to the condition
-	if val.NodeType() == ast.IntLiteral || val.NodeType() == ast.BoolLiteral || val.NodeType() == ast.StringLiteral {
+	switch val.NodeType() {
+	case ast.IntLiteral, ast.BoolLiteral, ast.StringLiteral, ast.FloatLiteral, ast.NullLiteral, ast.ArrLiteral, ast.StructLiteral:
 		if _, ok := s.Vars[name]; ok {
+			if s.Consts[name] {
+				panic(fmt.Sprintf("[ERROR] Cannot reassign constant %s\n", name))
+			}
 			s.Vars[name] = val
 			return true
 		}
@@ -58,7 +91,9 @@ func (s *Scope) newChild() *Scope {
 	return &Scope{
 		Vars:   make(v_map),
 		Funcs:  make(f_map),
-		Parent: s,
+		Consts:  make(map[string]bool),
+		Structs: make(map[string]*ast.StructDecNode),
+		Parent:  s,
 	}
 }
 
@@ -69,6 +69,9 @@ func (i *Interpreter) execStringExpr(node ast.Node, local_scope *Scope) string {
 		str := strconv.FormatBool(refNode.Value)
 		return str
 	}
+	if node.NodeType() == ast.NullLiteral {
+		return "null"
+	}
 	if node.NodeType() == ast.EmptyExpr {
 		emptNode, ok := node.(*ast.EmptyExprNode)
 		if !ok {
@@ -76,6 +79,15 @@ func (i *Interpreter) execStringExpr(node ast.Node, local_scope *Scope) string {
 		}
 		return i.execStringExpr(emptNode.Child, local_scope)
 	}
+	if node.NodeType() == ast.FieldAccess || node.NodeType() == ast.MethodCall || node.NodeType() == ast.ArrRef {
+		return i.execStringExpr(i.execExpr(node, local_scope), local_scope)
+	}
+	if node.NodeType() == ast.FloatLiteral {
+		return strconv.FormatFloat(node.(*ast.FloatLiteralNode).Value, 'f', -1, 64)
+	}
+	if node.NodeType() == ast.StructLiteral {
+		return FormatValue(node)
+	}
 	if node.NodeType() == ast.FuncCall {
 		funcCall, ok := node.(*ast.FuncCallNode)
 		if !ok {
@@ -85,31 +97,3 @@ func (i *Interpreter) execStringExpr(node ast.Node, local_scope *Scope) string {
 	}
 	panic(fmt.Sprintf("[ERROR] Type unsupported for string operations, got %v of value %v\n", node.NodeType(), node))
 }
-
-func (i *Interpreter) isStringExpression(node ast.Node, local_scope *Scope) bool {
-	switch node.NodeType() {
-	case ast.StringLiteral:
-		return true
-	case ast.ReferenceExpr:
-		refNode, ok := node.(*ast.ReferenceExprNode)
-		if !ok {
-			return false
-		}
-		val, exists := local_scope.getVar(refNode.Name)
-		if !exists {
-			return false
-		}
-		return val.NodeType() == ast.StringLiteral
-	case ast.InfixExpr:
-		infixNode, ok := node.(*ast.InfixExprNode)
-		if !ok {
-			return false
-		}
-		return i.isStringExpression(infixNode.Left, local_scope) || i.isStringExpression(infixNode.Right, local_scope)
-
-	case ast.FuncCall:
-		//THIS IS TEMPORARY PLACEHOLDER CODE!!!!!!!
-		return true
-	}
-	return false
-}
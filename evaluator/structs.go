@@ -0,0 +1,172 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"toy_lang/ast"
+)
+
+// Builds an instance from a struct literal, fields are stored in declaration order and missing ones are null
+func (i *Interpreter) instantiateStruct(lit *ast.StructLiteralNode, local_scope *Scope) *ast.StructLiteralNode {
+	dec, found := local_scope.getStruct(lit.Name)
+	if !found {
+		panic(fmt.Sprintf("[ERROR] Could not find struct %s\n", lit.Name))
+	}
+	for _, field := range lit.Fields {
+		if !dec.HasField(field.Name) {
+			panic(fmt.Sprintf("[ERROR] Struct %s has no field %s\n", lit.Name, field.Name))
+		}
+	}
+	instance := &ast.StructLiteralNode{Name: lit.Name, Fields: []ast.StructField{}}
+	for _, name := range dec.Fields {
+		var val ast.Node = &ast.NullLiteralNode{}
+		if given, ok := lit.GetField(name); ok {
+			val = copyValue(i.execExpr(given, local_scope))
+		}
+		instance.Fields = append(instance.Fields, ast.StructField{Name: name, Value: val})
+	}
+	return instance
+}
+
+// Evaluates obj and makes sure it is a struct instance
+func (i *Interpreter) execStructObj(obj ast.Node, local_scope *Scope) *ast.StructLiteralNode {
+	val := i.execExpr(obj, local_scope)
+	if _, ok := val.(*Module); ok {
+		panic(fmt.Sprintf("[ERROR] Cannot change %v, modules can only be read from\n", obj))
+	}
+	instance, ok := val.(*ast.StructLiteralNode)
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] %v is not a struct, it is a %v\n", obj, val.NodeType()))
+	}
+	return instance
+}
+
+func (i *Interpreter) execFieldAccess(node *ast.FieldAccessNode, local_scope *Scope) ast.Node {
+	if mod, ok := i.execExpr(node.Obj, local_scope).(*Module); ok {
+		return mod.getExport(node.Field)
+	}
+	instance := i.execStructObj(node.Obj, local_scope)
+	val, ok := instance.GetField(node.Field)
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] Struct %s has no field %s\n", instance.Name, node.Field))
+	}
+	return val
+}
+
+func (i *Interpreter) execFieldReassign(node *ast.FieldReassignNode, local_scope *Scope) {
+	i.checkFieldsMutable(node.Obj, local_scope)
+	instance := i.execStructObj(node.Obj, local_scope)
+	if !instance.SetField(node.Field, copyValue(i.execExpr(node.NewVal, local_scope))) {
+		panic(fmt.Sprintf("[ERROR] Struct %s has no field %s\n", instance.Name, node.Field))
+	}
+}
+
+// Panics if obj is stored in a constant, like c.x = 1 or c.inner.x = 1 where c is const
+func (i *Interpreter) checkFieldsMutable(obj ast.Node, local_scope *Scope) {
+	if name, ok := rootName(obj); ok && local_scope.isConst(name) {
+		panic(fmt.Sprintf("[ERROR] Cannot modify fields of constant %v\n", name))
+	}
+}
+
+// Returns the variable a chain like a.b[0].c starts from
+func rootName(node ast.Node) (string, bool) {
+	switch n := node.(type) {
+	case *ast.ReferenceExprNode:
+		return n.Name, true
+	case *ast.ArrRefNode:
+		return n.Arr.Name, true
+	case *ast.FieldAccessNode:
+		return rootName(n.Obj)
+	case *ast.EmptyExprNode:
+		return rootName(n.Child)
+	}
+	return "", false
+}
+
+// Calls a method with self bound to the instance itself so the method can change its fields
+func (i *Interpreter) execMethodCall(node *ast.MethodCallNode, local_scope *Scope) ast.Node {
+	obj := i.execExpr(node.Obj, local_scope)
+	if mod, ok := obj.(*Module); ok {
+		return i.callExport(mod, node, local_scope)
+	}
+	instance, ok := obj.(*ast.StructLiteralNode)
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] %v is not a struct, it is a %v\n", node.Obj, obj.NodeType()))
+	}
+	dec, found := local_scope.getStruct(instance.Name)
+	if !found {
+		panic(fmt.Sprintf("[ERROR] Could not find struct %s\n", instance.Name))
+	}
+	method, found := dec.GetMethod(node.Name)
+	if !found {
+		panic(fmt.Sprintf("[ERROR] Struct %s has no method %s\n", instance.Name, node.Name))
+	}
+	// A method called on a constant, or on self inside a method called on one, can't change the fields
+	name, ok := rootName(node.Obj)
+	return i.callFunc(method, node.Params, local_scope, local_scope, instance, ok && local_scope.isConst(name))
+}
+
+// Structs and arrays are copied when they are assigned so each variable owns its value
+func copyValue(val ast.Node) ast.Node {
+	switch v := val.(type) {
+	case *ast.StructLiteralNode:
+		fields := make([]ast.StructField, len(v.Fields))
+		for j, field := range v.Fields {
+			fields[j] = ast.StructField{Name: field.Name, Value: copyValue(field.Value)}
+		}
+		return &ast.StructLiteralNode{Name: v.Name, Fields: fields}
+	case *ast.ArrLiteralNode:
+		elems := make(map[string]ast.Node)
+		for key, elem := range v.Elems {
+			elems[key] = copyValue(elem)
+		}
+		return &ast.ArrLiteralNode{Elems: elems}
+	}
+	return val
+}
+
+// FormatValue shows a value the way it would be written in a program, like Point{x: 1, y: "a"} or [1, 2].
+// Strings are quoted, print and str leave a string on its own as it is
+func FormatValue(val ast.Node) string {
+	switch v := val.(type) {
+	case nil, *ast.NullLiteralNode:
+		return "null"
+	case *ast.StringLiteralNode:
+		return fmt.Sprintf("%q", v.Value)
+	case *ast.IntLiteralNode:
+		return strconv.Itoa(v.Value)
+	case *ast.BoolLiteralNode:
+		return strconv.FormatBool(v.Value)
+	case *ast.FloatLiteralNode:
+		return strconv.FormatFloat(v.Value, 'f', -1, 64)
+	case *ast.ArrLiteralNode:
+		keys := ast.ElemKeys(v)
+		elems := make([]string, len(keys))
+		list := isList(keys)
+		for j, key := range keys {
+			elems[j] = FormatValue(v.Elems[key])
+			if !list {
+				elems[j] = keyName(key) + ": " + elems[j]
+			}
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case *ast.StructLiteralNode:
+		fields := make([]string, len(v.Fields))
+		for j, field := range v.Fields {
+			fields[j] = field.Name + ": " + FormatValue(field.Value)
+		}
+		return v.Name + "{" + strings.Join(fields, ", ") + "}"
+	}
+	return val.String()
+}
+
+// Whether sorted array keys are 0 to n-1, an array like that is a list and is shown without its keys
+func isList(keys []string) bool {
+	for j, key := range keys {
+		if key != fmt.Sprintf("INT(%d)", j) {
+			return false
+		}
+	}
+	return true
+}
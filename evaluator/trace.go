@@ -0,0 +1,171 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/formatter"
+)
+
+// TraceFormat picks how a Tracer writes its entries
+type TraceFormat int
+
+const (
+	// One line of text per statement
+	TraceLines TraceFormat = iota
+	// One JSON object per line
+	TraceJSON
+)
+
+// TraceEntry is one executed statement. Entries are written when the statement finishes, so the statements
+// inside a call or a block come before the statement that contains them, Seq is the order they started in
+type TraceEntry struct {
+	Seq  int    `json:"seq"`
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+	// The function the statement is in, see Frame.Name
+	Func string `json:"func"`
+	// Number of calls on the stack, the top level is 1
+	Depth int `json:"depth"`
+	// Number of scopes the statement runs in, the top level of a file is 1 and every call and block adds one
+	Scope int `json:"scope"`
+	// The statement as formatted code, blocks only show their first line
+	Stmt string `json:"stmt"`
+	// Variables the statement declared or changed, seen from where it ran, with their new values
+	Changes map[string]string `json:"changes,omitempty"`
+	// The statement didn't finish because the program failed in it
+	Unfinished bool `json:"unfinished,omitempty"`
+}
+
+// Tracer is a DoneHook that writes a TraceEntry for every statement the program runs. Call Flush when the
+// program has ended to write the statements a runtime error left unfinished
+type Tracer struct {
+	out     io.Writer
+	format  TraceFormat
+	seq     int
+	running []tracing
+}
+
+// A statement that has started, with the variables it could see before it ran
+type tracing struct {
+	entry  TraceEntry
+	before map[string]string
+}
+
+func NewTracer(out io.Writer, format TraceFormat) *Tracer {
+	return &Tracer{out: out, format: format}
+}
+
+func (t *Tracer) Statement(stack []*Frame) {
+	top := stack[len(stack)-1]
+	t.seq++
+	t.running = append(t.running, tracing{
+		entry: TraceEntry{
+			Seq:   t.seq,
+			File:  top.File,
+			Line:  top.Pos.Line,
+			Col:   top.Pos.Col,
+			Func:  top.Name,
+			Depth: len(stack),
+			Scope: scopeDepth(top.Scope),
+			Stmt:  traceText(top.Stmt),
+		},
+		before: visibleVars(top),
+	})
+}
+
+func (t *Tracer) StatementDone(stack []*Frame) {
+	last := t.running[len(t.running)-1]
+	t.running = t.running[:len(t.running)-1]
+	for name, val := range visibleVars(stack[len(stack)-1]) {
+		if old, ok := last.before[name]; !ok || old != val {
+			if last.entry.Changes == nil {
+				last.entry.Changes = make(map[string]string)
+			}
+			last.entry.Changes[name] = val
+		}
+	}
+	t.write(last.entry)
+}
+
+// Flush writes the statements that never finished, innermost first
+func (t *Tracer) Flush() {
+	for j := len(t.running) - 1; j >= 0; j-- {
+		entry := t.running[j].entry
+		entry.Unfinished = true
+		t.write(entry)
+	}
+	t.running = nil
+}
+
+func (t *Tracer) write(entry TraceEntry) {
+	if t.format == TraceJSON {
+		enc := json.NewEncoder(t.out)
+		enc.SetEscapeHTML(false)
+		enc.Encode(entry)
+		return
+	}
+	file := entry.File
+	if file == "" {
+		file = "<eval>"
+	}
+	line := fmt.Sprintf("%d %v:%d:%d %v depth=%d scope=%d: %v", entry.Seq, file, entry.Line, entry.Col, entry.Func, entry.Depth, entry.Scope, entry.Stmt)
+	if len(entry.Changes) > 0 {
+		names := make([]string, 0, len(entry.Changes))
+		for name := range entry.Changes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		changes := make([]string, len(names))
+		for j, name := range names {
+			changes[j] = name + " = " + entry.Changes[name]
+		}
+		line += " => " + strings.Join(changes, ", ")
+	}
+	if entry.Unfinished {
+		line += " (unfinished)"
+	}
+	fmt.Fprintln(t.out, line)
+}
+
+// Every variable the frame's statement can see, formatted so values can be compared after it has run
+func visibleVars(f *Frame) map[string]string {
+	vars := make(map[string]string)
+	for name, val := range f.Globals() {
+		vars[name] = FormatValue(val)
+	}
+	for name, val := range f.Locals() {
+		vars[name] = FormatValue(val)
+	}
+	return vars
+}
+
+// Counts the scopes up to the builtins, which don't count
+func scopeDepth(s *Scope) int {
+	depth := 0
+	for ; s != nil && s.Parent != nil; s = s.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Formats a statement on one line, blocks are cut down to the line that opens them
+func traceText(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.IfStmtNode:
+		return "if " + formatter.Cond(n.Cond) + " { ... }"
+	case *ast.WhileStmtNode:
+		return "while " + formatter.Cond(n.Cond) + " { ... }"
+	case *ast.FuncDecNode:
+		return formatter.FuncHeader(n) + " { ... }"
+	case *ast.StructDecNode:
+		return "struct " + n.Name + " { ... }"
+	case *ast.ExportStmtNode:
+		return "export " + traceText(n.Stmt)
+	}
+	return formatter.Stmt(node)
+}
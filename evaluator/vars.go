@@ -3,36 +3,19 @@ package evaluator
 import (
 	"fmt"
 	"toy_lang/ast"
-	"toy_lang/token"
 )
 
 func (i *Interpreter) assignValue(name string, value ast.Node, local_scope *Scope, isDeclaration bool) {
-	if emptyNode, ok := value.(*ast.EmptyExprNode); ok {
-		value = emptyNode.Child
-	}
+	value = unwrapEmpty(value)
 	var valNode ast.Node
-
-	// Check if this is a string operation first
-	if value.NodeType() == ast.InfixExpr {
-		iNode, ok := value.(*ast.InfixExprNode)
-		if ok && iNode.Operator == token.PLUS {
-			// Check if either operand suggests this is a string operation
-			if i.isStringExpression(iNode.Left, local_scope) || i.isStringExpression(iNode.Right, local_scope) {
-				valNode = &ast.StringLiteralNode{Value: i.execStringExpr(value, local_scope)}
-				goto AfterStringParse
-			}
-		}
-	}
-
 	switch v := value.(type) {
 	case *ast.IntLiteralNode:
 		valNode = &ast.IntLiteralNode{Value: i.execIntExpr(v, local_scope)}
 	case *ast.InfixExprNode:
-		// If we get here, it's not a string operation, so it must be int
 		valNode = i.execExpr(v, local_scope)
 	case *ast.BoolLiteralNode, *ast.BoolInfixNode, *ast.PrefixExprNode:
 		valNode = &ast.BoolLiteralNode{Value: i.execBoolExpr(v, local_scope)}
-	case *ast.FloatLiteralNode:
+	case *ast.FloatLiteralNode, *ast.NullLiteralNode:
 		valNode = v
 	case *ast.ReferenceExprNode:
 		refValO, ok := local_scope.getVar(v.Name)
@@ -46,6 +29,8 @@ func (i *Interpreter) assignValue(name string, value ast.Node, local_scope *Scop
 			valNode = &ast.BoolLiteralNode{Value: i.execBoolExpr(refVal, local_scope)}
 		case *ast.StringLiteralNode:
 			valNode = &ast.StringLiteralNode{Value: i.execStringExpr(refVal, local_scope)}
+		case *ast.FloatLiteralNode, *ast.NullLiteralNode:
+			valNode = refVal
 		case *ast.ArrLiteralNode:
 
 			arrNode := refValO.(*ast.ArrLiteralNode)
@@ -54,15 +39,16 @@ func (i *Interpreter) assignValue(name string, value ast.Node, local_scope *Scop
 				elems[key] = i.execExpr(val, local_scope)
 			}
 			valNode = &ast.ArrLiteralNode{Elems: elems}		
+		case *ast.StructLiteralNode:
+			valNode = copyValue(refVal)
 		default:
 			panic(fmt.Sprintf("[ERROR] Unknown reference type: %T\n", refVal))
 		}
 	case *ast.FuncCallNode:
 		result := i.execFuncCall(v, local_scope)
-		if result == nil {
-			panic(fmt.Sprintf("[ERROR] Function %s did not return a value", v.Name.Name))
-		}
 		switch r := result.(type) {
+		case *ast.NullLiteralNode:
+			valNode = r
 		case *ast.IntLiteralNode, *ast.InfixExprNode:
 			valNode = &ast.IntLiteralNode{Value: i.execIntExpr(r, local_scope)}
 		case *ast.BoolLiteralNode, *ast.BoolInfixNode, *ast.PrefixExprNode:
@@ -71,16 +57,22 @@ func (i *Interpreter) assignValue(name string, value ast.Node, local_scope *Scop
 			valNode = &ast.StringLiteralNode{Value: i.execStringExpr(r, local_scope)}
 		case *ast.FloatLiteralNode:
 			valNode = &ast.FloatLiteralNode{Value: i.execFloatExpr(r, local_scope)}
+		case *ast.StructLiteralNode, *ast.ArrLiteralNode:
+			valNode = copyValue(r)
 		default:
 			panic(fmt.Sprintf("[ERROR] Unsupported return type from function: %T", r))
 		}
+	case *ast.StructLiteralNode:
+		valNode = i.instantiateStruct(v, local_scope)
+	case *ast.FieldAccessNode, *ast.MethodCallNode:
+		valNode = copyValue(i.execExpr(v, local_scope))
 	case *ast.StringLiteralNode:
 		valNode = &ast.StringLiteralNode{Value: i.execStringExpr(v, local_scope)}
 	case *ast.ArrLiteralNode:
 		arrNode := value.(*ast.ArrLiteralNode)
 		elems := make(map[string]ast.Node)
 		for key, val := range arrNode.Elems {
-			elems[key] = i.execExpr(val, local_scope)
+			elems[key] = copyValue(i.execExpr(val, local_scope))
 		}
 		valNode = &ast.ArrLiteralNode{Elems: elems}
 	case *ast.ArrRefNode:
@@ -107,11 +99,10 @@ func (i *Interpreter) assignValue(name string, value ast.Node, local_scope *Scop
 		if val == nil {
 			panic(fmt.Sprintf("[ERROR] Value %v not found in arr %+v\n", refNode.Idx, arrMap))
 		}
-		valNode = val
+		valNode = copyValue(val)
 	default:
 		panic(fmt.Sprintf("[ERROR] Unknown value type: %v, type: %v\n", value, value.NodeType()))
 	}
-AfterStringParse:
 	if valNode == nil {
 		panic(fmt.Sprintf("[ERROR] Variable is undefined, %v\n", name))
 	}
@@ -137,6 +128,9 @@ func (i *Interpreter) changeVarVal(node ast.Node, local_scope *Scope) {
 		} else {
 			i.assignValue(n.Name, n.Value, local_scope, true)
 		}
+		if n.Const {
+			local_scope.Consts[n.Name] = true
+		}
 	case *ast.VarReassignNode:
 		varName := n.Var.Name
 		i.assignValue(varName, n.NewVal, local_scope, false)
@@ -144,3 +138,46 @@ func (i *Interpreter) changeVarVal(node ast.Node, local_scope *Scope) {
 		panic(fmt.Sprintf("[ERROR] Unsupported node type: %T", node))
 	}
 }
+
+func (i *Interpreter) execCompoundAssign(node *ast.CompoundAssignNode, local_scope *Scope) {
+	rhs := i.execExpr(node.Value, local_scope)
+	switch target := node.Target.(type) {
+	case *ast.ReferenceExprNode:
+		oldVal, found := local_scope.getVar(target.Name)
+		if !found {
+			panic(fmt.Sprintf("[ERROR] Reassigning undefined variable %s", target.Name))
+		}
+		newVal := i.execExpr(&ast.InfixExprNode{Left: oldVal, Operator: node.Operator, Right: rhs}, local_scope)
+		if !local_scope.assignVar(target.Name, newVal) {
+			panic(fmt.Sprintf("[ERROR] Reassigning undefined variable %s", target.Name))
+		}
+	case *ast.ArrRefNode:
+		arr, found := local_scope.getVar(target.Arr.Name)
+		if !found {
+			panic(fmt.Sprintf("[ERROR] Could not find array %v\n", target.Arr.Name))
+		}
+		if local_scope.isConst(target.Arr.Name) {
+			panic(fmt.Sprintf("[ERROR] Cannot modify elements of constant %v\n", target.Arr.Name))
+		}
+		arrLit, ok := arr.(*ast.ArrLiteralNode)
+		if !ok {
+			panic(fmt.Sprintf("[ERROR] Variable %v is not an array\n", target.Arr.Name))
+		}
+		key := i.execExpr(target.Idx, local_scope).String()
+		oldVal, found := arrLit.Elems[key]
+		if !found {
+			panic(fmt.Sprintf("[ERROR] Value %v not found in arr %v\n", key, target.Arr.Name))
+		}
+		arrLit.Elems[key] = i.execExpr(&ast.InfixExprNode{Left: oldVal, Operator: node.Operator, Right: rhs}, local_scope)
+	case *ast.FieldAccessNode:
+		i.checkFieldsMutable(target.Obj, local_scope)
+		instance := i.execStructObj(target.Obj, local_scope)
+		oldVal, found := instance.GetField(target.Field)
+		if !found {
+			panic(fmt.Sprintf("[ERROR] Struct %s has no field %s\n", instance.Name, target.Field))
+		}
+		instance.SetField(target.Field, i.execExpr(&ast.InfixExprNode{Left: oldVal, Operator: node.Operator, Right: rhs}, local_scope))
+	default:
+		panic(fmt.Sprintf("[ERROR] Cannot apply compound assignment to %v\n", node.Target))
+	}
+}
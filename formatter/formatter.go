@@ -0,0 +1,339 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/lexer"
+	"toy_lang/parser"
+	"toy_lang/token"
+)
+
+const indentStr = "    "
+
+var operators = map[token.TokenType]string{
+	token.PLUS:             "+",
+	token.MINUS:            "-",
+	token.MULTIPLY:         "*",
+	token.DIVIDE:           "/",
+	token.MODULO:           "%",
+	token.EXPONENT:         "**",
+	token.LESS_THAN:        "<",
+	token.LESS_THAN_EQT:    "<=",
+	token.GREATER_THAN:     ">",
+	token.GREATER_THAN_EQT: ">=",
+	token.EQUALS:           "==",
+	token.NOT_EQUAL:        "!=",
+	token.AND:              "&&",
+	token.OR:               "||",
+}
+
+// Format prints a parsed program back as toy source, one statement per line with 4 space indents
+func Format(program ast.ProgramNode) string {
+	return format(program, nil)
+}
+
+// Source formats toy source code. Unlike Format it keeps comments and single blank lines between statements,
+// formatting its own output gives the same output back
+func Source(src string) (out string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(strings.TrimSpace(fmt.Sprint(r)))
+		}
+	}()
+	lex := lexer.NewLexer()
+	toks := lex.Lex(src)
+	comments := token.Comments(toks)
+	if len(toks) == 0 {
+		// A file of only comments has no tokens to carry them
+		comments = lex.Comments()
+	}
+	return format(parser.NewParser().Parse(toks), comments), nil
+}
+
+func format(program ast.ProgramNode, comments []token.Comment) string {
+	f := &formatter{comments: comments}
+	f.block(program.Statements, token.Position{})
+	f.flushComments(token.Position{}, true)
+	return f.out.String()
+}
+
+type formatter struct {
+	out    bytes.Buffer
+	indent int
+	// Comments that haven't been printed yet, in source order
+	comments []token.Comment
+	// Last source line printed, used to keep blank lines
+	prevLine int
+	// Set until the first line of a block is printed so blocks never start with a blank line
+	blockStart bool
+}
+
+func (f *formatter) line(s string) {
+	f.out.WriteString(strings.Repeat(indentStr, f.indent))
+	f.out.WriteString(s)
+	f.out.WriteString("\n")
+	f.blockStart = false
+}
+
+// Prints a blank line if the source had one before line
+func (f *formatter) keepBlank(line int) {
+	if line != 0 && f.prevLine != 0 && line > f.prevLine+1 && !f.blockStart {
+		f.out.WriteString("\n")
+	}
+}
+
+func (f *formatter) hasCommentBefore(pos token.Position) bool {
+	return len(f.comments) > 0 && f.comments[0].Pos.Before(pos)
+}
+
+// Prints the comments that come before pos on their own lines, all of them if rest is set
+func (f *formatter) flushComments(pos token.Position, rest bool) {
+	for len(f.comments) > 0 && (rest || f.comments[0].Pos.Before(pos)) {
+		c := f.comments[0]
+		f.comments = f.comments[1:]
+		f.keepBlank(c.Pos.Line)
+		f.line(c.Text)
+		f.prevLine = c.Pos.Line + strings.Count(c.Text, "\n")
+	}
+}
+
+// Moves comments that start on the last line of a statement onto the end of its printed line. Comments from
+// before on are left alone, they belong to whatever comes next
+func (f *formatter) trailingComments(end token.Position, before token.Position) {
+	for len(f.comments) > 0 && end.Line != 0 && f.comments[0].Pos.Line == end.Line && end.Before(f.comments[0].Pos) &&
+		(before.Line == 0 || f.comments[0].Pos.Before(before)) {
+		f.out.Truncate(f.out.Len() - 1)
+		f.out.WriteString(" " + f.comments[0].Text + "\n")
+		f.prevLine = end.Line + strings.Count(f.comments[0].Text, "\n")
+		f.comments = f.comments[1:]
+	}
+}
+
+// Prints stmts followed by the comments that come before end, the position of the closing brace
+func (f *formatter) block(stmts []ast.Node, end token.Position) {
+	f.blockStart = true
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
+		}
+		span := ast.SpanOf(stmt)
+		f.flushComments(span.Start, false)
+		f.keepBlank(span.Start.Line)
+		f.stmt(stmt, "")
+		f.trailingComments(span.End, end)
+		if span.End.Line > f.prevLine {
+			f.prevLine = span.End.Line
+		}
+	}
+	f.flushComments(end, false)
+}
+
+// Prints header followed by a braced body, empty bodies stay on one line like fn f() {}
+func (f *formatter) braced(header string, body []ast.Node, end token.Position) {
+	if len(body) == 0 && !f.hasCommentBefore(end) {
+		f.line(header + " {}")
+		return
+	}
+	f.line(header + " {")
+	f.indent++
+	f.block(body, end)
+	f.indent--
+	f.line("}")
+}
+
+// Where the first statement of body starts, end for an empty body
+func bodyStart(body []ast.Node, end token.Position) token.Position {
+	for _, stmt := range body {
+		if stmt != nil {
+			return ast.SpanOf(stmt).Start
+		}
+	}
+	return end
+}
+
+func (f *formatter) stmt(node ast.Node, prefix string) {
+	switch n := node.(type) {
+	case *ast.IfStmtNode:
+		if len(n.Alt) == 0 {
+			f.braced(prefix+"if "+Cond(n.Cond), n.Body, n.End)
+			return
+		}
+		f.line(prefix + "if " + Cond(n.Cond) + " {")
+		f.indent++
+		// The span of an if with an else ends at the else's closing brace, so the if body ends at the else.
+		// Trees without its position print the comments after the if body at the start of the else body
+		f.block(n.Body, n.Else)
+		f.indent--
+		// A comment after else { stays on that line, it would end the if body's last line otherwise
+		f.line("} else {")
+		f.trailingComments(n.Else, bodyStart(n.Alt, n.End))
+		f.indent++
+		f.block(n.Alt, n.End)
+		f.indent--
+		f.line("}")
+	case *ast.WhileStmtNode:
+		f.braced(prefix+"while "+Cond(n.Cond), n.Body, n.End)
+	case *ast.FuncDecNode:
+		f.braced(prefix+FuncHeader(n), n.Body, n.End)
+	case *ast.StructDecNode:
+		f.structDec(n, prefix)
+	case *ast.ExportStmtNode:
+		f.stmt(n.Stmt, prefix+"export ")
+	default:
+		f.line(prefix + Stmt(node) + ";")
+	}
+}
+
+// FuncHeader formats the first line of a function declaration, like fn add(a, b)
+func FuncHeader(n *ast.FuncDecNode) string {
+	params := make([]string, len(n.Params))
+	for i, param := range n.Params {
+		params[i] = param.Name
+	}
+	return "fn " + n.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+func (f *formatter) structDec(n *ast.StructDecNode, prefix string) {
+	if len(n.Fields) == 0 && len(n.Methods) == 0 && !f.hasCommentBefore(n.End) {
+		f.line(prefix + "struct " + n.Name + " {}")
+		return
+	}
+	f.line(prefix + "struct " + n.Name + " {")
+	f.indent++
+	f.blockStart = true
+	if len(n.Fields) > 0 {
+		f.line(strings.Join(n.Fields, ", "))
+	}
+	for i := range n.Methods {
+		method := &n.Methods[i]
+		if i > 0 || len(n.Fields) > 0 {
+			f.out.WriteString("\n")
+			f.blockStart = true
+		}
+		f.flushComments(method.Start, false)
+		f.stmt(method, "")
+		f.trailingComments(method.End, n.End)
+	}
+	f.flushComments(n.End, false)
+	f.indent--
+	f.line("}")
+}
+
+// Stmt formats a statement that fits on one line, without the trailing semicolon
+func Stmt(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.LetStmtNode:
+		if n.Const {
+			return "const " + n.Name + " = " + Expr(n.Value)
+		}
+		return "let " + n.Name + " = " + Expr(n.Value)
+	case *ast.VarReassignNode:
+		return n.Var.Name + " = " + Expr(n.NewVal)
+	case *ast.ArrReassignNode:
+		return n.Arr.Name + "[" + Expr(n.Idx) + "] = " + Expr(n.NewVal)
+	case *ast.FieldReassignNode:
+		return Expr(n.Obj) + "." + n.Field + " = " + Expr(n.NewVal)
+	case *ast.CompoundAssignNode:
+		if n.Postfix {
+			return Expr(n.Target) + operators[n.Operator] + operators[n.Operator]
+		}
+		return Expr(n.Target) + " " + operators[n.Operator] + "= " + Expr(n.Value)
+	case *ast.ReturnExprNode:
+		if n.Val == nil {
+			return "return"
+		}
+		return "return " + Expr(n.Val)
+	case *ast.ContinueStmtNode:
+		return "continue"
+	case *ast.BreakStmtNode:
+		return "break"
+	case *ast.ImportStmtNode:
+		return "import " + strconv.Quote(n.Path) + " as " + n.Alias
+	}
+	return Expr(node)
+}
+
+// Cond formats an if or while condition, dropping the "|| false" the parser wraps non boolean conditions in
+func Cond(cond ast.Bool) string {
+	if b, ok := cond.(*ast.BoolInfixNode); ok && b.Operator == token.OR {
+		if right, ok := b.Right.(*ast.BoolLiteralNode); ok && !right.Value {
+			return Expr(b.Left)
+		}
+	}
+	return Expr(cond)
+}
+
+// Expr formats an expression, parentheses are only printed where the source had them
+func Expr(node ast.Node) string {
+	switch n := node.(type) {
+	case nil:
+		return ""
+	case *ast.EmptyExprNode:
+		switch n.Child.(type) {
+		// Calls, field accesses and literals are wrapped by the parser without any parentheses in the source
+		case *ast.FuncCallNode, *ast.MethodCallNode, *ast.FieldAccessNode, *ast.StructLiteralNode, *ast.ArrRefNode:
+			return Expr(n.Child)
+		}
+		return "(" + Expr(n.Child) + ")"
+	case *ast.IntLiteralNode:
+		return strconv.Itoa(n.Value)
+	case *ast.FloatLiteralNode:
+		str := strconv.FormatFloat(n.Value, 'f', -1, 64)
+		if !strings.Contains(str, ".") {
+			str += ".0"
+		}
+		return str
+	case *ast.StringLiteralNode:
+		return "\"" + n.Value + "\""
+	case *ast.BoolLiteralNode:
+		return strconv.FormatBool(n.Value)
+	case *ast.NullLiteralNode:
+		return "null"
+	case *ast.ReferenceExprNode:
+		return n.Name
+	case *ast.InfixExprNode:
+		// The parser reads -x as 0 - x
+		if left, ok := n.Left.(*ast.IntLiteralNode); ok && left.Value == 0 && n.Operator == token.MINUS {
+			return "-" + Expr(n.Right)
+		}
+		return Expr(n.Left) + " " + operators[n.Operator] + " " + Expr(n.Right)
+	case *ast.BoolInfixNode:
+		return Expr(n.Left) + " " + operators[n.Operator] + " " + Expr(n.Right)
+	case *ast.PrefixExprNode:
+		return "!" + Expr(n.Value)
+	case *ast.FuncCallNode:
+		return n.Name.Name + "(" + exprList(n.Params) + ")"
+	case *ast.MethodCallNode:
+		return Expr(n.Obj) + "." + n.Name + "(" + exprList(n.Params) + ")"
+	case *ast.FieldAccessNode:
+		return Expr(n.Obj) + "." + n.Field
+	case *ast.ArrRefNode:
+		return n.Arr.Name + "[" + Expr(n.Idx) + "]"
+	case *ast.ArrLiteralNode:
+		elems := make([]ast.Node, len(n.Elems))
+		for i := range elems {
+			key := ast.IntLiteralNode{Value: i}
+			elems[i] = n.Elems[key.String()]
+		}
+		return "[" + exprList(elems) + "]"
+	case *ast.StructLiteralNode:
+		fields := make([]string, len(n.Fields))
+		for i, field := range n.Fields {
+			fields[i] = field.Name + ": " + Expr(field.Value)
+		}
+		return n.Name + "{" + strings.Join(fields, ", ") + "}"
+	}
+	return node.String()
+}
+
+func exprList(nodes []ast.Node) string {
+	strs := make([]string, len(nodes))
+	for i, node := range nodes {
+		strs[i] = Expr(node)
+	}
+	return strings.Join(strs, ", ")
+}
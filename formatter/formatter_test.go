@@ -0,0 +1,103 @@
+package formatter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+		id     int
+	}{
+		{
+			input:  "let x=1+2*3;",
+			output: "let x = 1 + 2 * 3;\n",
+			id:     1,
+		},
+		{
+			input:  "fn fib(n){if n<2{return n;} return fib(n-1)+fib(n-2);}",
+			output: "fn fib(n) {\n    if n < 2 {\n        return n;\n    }\n    return fib(n - 1) + fib(n - 2);\n}\n",
+			id:     2,
+		},
+		{
+			input:  "let a = -x; let b = (1 + 2) * 3; let c = !true;",
+			output: "let a = -x;\nlet b = (1 + 2) * 3;\nlet c = !true;\n",
+			id:     3,
+		},
+		{
+			input:  "let arr = [1, \"a\", 2.50]; arr[0] = null; arr[1] += 2;",
+			output: "let arr = [1, \"a\", 2.5];\narr[0] = null;\narr[1] += 2;\n",
+			id:     4,
+		},
+		{
+			input: "while n < 3{n++;} if n {println(n);} else {}",
+			// An empty else has nothing to print
+			output: "while n < 3 {\n    n++;\n}\nif n {\n    println(n);\n}\n",
+			id:     5,
+		},
+		{
+			input:  "struct P{x,y fn sum(){return self.x+self.y;}} let p = P{x: 1, y: 2}; p.x = p.sum();",
+			output: "struct P {\n    x, y\n\n    fn sum() {\n        return self.x + self.y;\n    }\n}\nlet p = P{x: 1, y: 2};\np.x = p.sum();\n",
+			id:     6,
+		},
+		{
+			input:  "import \"lib.toy\" as lib; export const X = lib.f(); export fn g(){}",
+			output: "import \"lib.toy\" as lib;\nexport const X = lib.f();\nexport fn g() {}\n",
+			id:     7,
+		},
+		{
+			input:  "/* head */\n\n\nlet x = 1; /* trailing */\nfn f() { /* inside */ }\n\n\n/* tail */",
+			output: "/* head */\n\nlet x = 1; /* trailing */\nfn f() {\n    /* inside */\n}\n\n/* tail */\n",
+			id:     8,
+		},
+		{
+			input:  "fn f(a) {\n\n    let b = a;\n\n\n    return b; /* done */\n    /* last */\n}",
+			output: "fn f(a) {\n    let b = a;\n\n    return b; /* done */\n    /* last */\n}\n",
+			id:     9,
+		},
+		{
+			input:  "// only comments\n/* here */",
+			output: "// only comments\n/* here */\n",
+			id:     10,
+		},
+		{
+			input:  "let x = 1; // one\nfn f() { // two\n  return x; // three\n}",
+			output: "let x = 1; // one\nfn f() {\n    // two\n    return x; // three\n}\n",
+			id:     11,
+		},
+		{
+			input:  "if a {\n  b = 1;\n} else { // c\n  b = 2;\n}\nif a {\n  b = 1; } else { // d\n  b = 2; // e\n  // f\n}",
+			output: "if a {\n    b = 1;\n} else { // c\n    b = 2;\n}\nif a {\n    b = 1;\n} else { // d\n    b = 2; // e\n    // f\n}\n",
+			id:     12,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("[FAILURE] Test number %d has failed\nError: %v\n", tt.id, err)
+			continue
+		}
+		if got != tt.output {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot:\n%v\nWant:\n%v\n", tt.id, got, tt.output)
+			continue
+		}
+		// Formatting formatted code must not change it
+		again, err := Source(got)
+		if err != nil || again != got {
+			t.Errorf("[FAILURE] Test number %d is not idempotent\nFirst:\n%v\nSecond:\n%v\n", tt.id, got, again)
+			continue
+		}
+		fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	if _, err := Source("let = ;"); err == nil {
+		t.Errorf("[FAILURE] Expected an error for invalid source")
+	} else {
+		fmt.Printf("\033[32m[PASS] Test number 1 has passed\033[0m\n")
+	}
+}
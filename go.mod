@@ -1,3 +1,3 @@
 module toy_lang
 
-go 1.23.3
+go 1.24
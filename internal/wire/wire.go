@@ -0,0 +1,85 @@
+// Package wire has what the cli, the language server and the debug adapter share: Content-Length framed JSON
+// messages and turning the panics the lexer, parser and evaluator report errors with into messages
+package wire
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The largest body ReadMessage accepts, a bad or hostile Content-Length can't make it allocate more
+const maxMessage = 64 << 20
+
+// ReadMessage reads one message, each one is a Content-Length header, a blank line and a JSON body. It returns
+// io.EOF when the stream ends between messages
+func ReadMessage(in *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length == -1 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("[ERROR] Could not read message header: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("[ERROR] Malformed message header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("[ERROR] Bad Content-Length %q", value)
+			}
+			if length > maxMessage {
+				return nil, fmt.Errorf("[ERROR] Content-Length %d is over the limit of %d bytes", length, maxMessage)
+			}
+		}
+	}
+	if length == -1 {
+		return nil, errors.New("[ERROR] Message has no Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(in, body); err != nil {
+		return nil, fmt.Errorf("[ERROR] Could not read message body: %v", err)
+	}
+	return body, nil
+}
+
+// WriteMessage writes v as a JSON body with its Content-Length header
+func WriteMessage(out io.Writer, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("[ERROR] Could not encode message: %v", err))
+	}
+	fmt.Fprintf(out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// Message turns a recovered panic into an error message, toy errors are already strings and anything else,
+// like a Go runtime error, gets an [ERROR] prefix
+func Message(r any) string {
+	if msg, ok := r.(string); ok {
+		return strings.TrimSpace(msg)
+	}
+	return fmt.Sprintf("[ERROR] %v", r)
+}
+
+// Catch runs f and returns the message it panicked with, or "" if it didn't
+func Catch(f func()) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = Message(r)
+		}
+	}()
+	f()
+	return ""
+}
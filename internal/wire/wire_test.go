@@ -0,0 +1,98 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+		err   string
+		id    int
+	}{
+		{
+			input: "Content-Length: 2\r\n\r\n{}content-length:7\r\nContent-Type: x\r\n\r\n[1,2,3]",
+			want:  []string{"{}", "[1,2,3]"},
+			id:    1,
+		},
+		{
+			input: "Content-Length: 5\r\n\r\n{}",
+			err:   "[ERROR] Could not read message body: unexpected EOF",
+			id:    2,
+		},
+		{
+			input: "Content-Type: x\r\n\r\n{}",
+			err:   "[ERROR] Message has no Content-Length header",
+			id:    3,
+		},
+		{
+			input: "Content-Length: -1\r\n\r\n",
+			err:   `[ERROR] Bad Content-Length " -1"`,
+			id:    4,
+		},
+		{
+			input: "hello\r\n\r\n",
+			err:   `[ERROR] Malformed message header "hello"`,
+			id:    5,
+		},
+		{
+			input: "Content-Length: 9223372036854775807\r\n\r\n{}",
+			err:   "[ERROR] Content-Length 9223372036854775807 is over the limit of 67108864 bytes",
+			id:    6,
+		},
+	}
+
+	for _, tt := range tests {
+		in := bufio.NewReader(strings.NewReader(tt.input))
+		var got []string
+		var err error
+		for {
+			var body []byte
+			body, err = ReadMessage(in)
+			if err != nil {
+				break
+			}
+			got = append(got, string(body))
+		}
+		errMsg := ""
+		if err != io.EOF {
+			errMsg = err.Error()
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || errMsg != tt.err {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %q %q\nWant: %q %q\n", tt.id, got, errMsg, tt.want, tt.err)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestWriteAndCatch(t *testing.T) {
+	var out bytes.Buffer
+	WriteMessage(&out, map[string]any{"a": 1})
+	if body, err := ReadMessage(bufio.NewReader(&out)); err != nil || string(body) != `{"a":1}` {
+		t.Errorf("[FAILURE] WriteMessage wrote %q %v", body, err)
+	}
+
+	tests := []struct {
+		f    func()
+		want string
+		id   int
+	}{
+		{f: func() {}, want: "", id: 1},
+		{f: func() { panic("[ERROR] Bad thing\n") }, want: "[ERROR] Bad thing", id: 2},
+		{f: func() { var arr []int; _ = arr[1] }, want: "[ERROR] runtime error: index out of range [1] with length 0", id: 3},
+	}
+	for _, tt := range tests {
+		if got := Catch(tt.f); got != tt.want {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %q\nWant: %q\n", tt.id, got, tt.want)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
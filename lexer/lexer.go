@@ -1,6 +1,9 @@
 package lexer
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"toy_lang/token"
 	"unicode"
 )
@@ -12,7 +15,13 @@ type Lexer struct {
 	pos        int
 	tokens     []token.Token
 	inString   bool
-	isInComment bool
+	// Where the word, number or string in currNum/currString started
+	wordStart int
+	// Offsets of the first rune of every line, used to turn offsets into positions
+	lineStarts []int
+	comments   []token.Comment
+	// For each comment, how many tokens came before it
+	commentAt []int
 }
 
 func NewLexer() *Lexer {
@@ -23,10 +32,25 @@ func NewLexer() *Lexer {
 		pos:        0,
 		tokens:     []token.Token{},
 		inString:   false,
-		isInComment: false,
 	}
 }
 
+// Comments returns every comment found by the last call to Lex in source order, including the ones in a file
+// without any tokens to attach them to
+func (l *Lexer) Comments() []token.Comment {
+	return l.comments
+}
+
+func (l *Lexer) position(offset int) token.Position {
+	line := sort.Search(len(l.lineStarts), func(i int) bool { return l.lineStarts[i] > offset })
+	return token.Position{Line: line, Col: offset - l.lineStarts[line-1] + 1}
+}
+
+func (l *Lexer) push(tok *token.Token, offset int) {
+	tok.Pos = l.position(offset)
+	l.tokens = append(l.tokens, *tok)
+}
+
 func (l *Lexer) getChar() rune {
 	if l.pos >= len(l.chars) {
 		return 0
@@ -51,10 +75,10 @@ func (l *Lexer) containsDot() bool {
 func (l *Lexer) flushNum() {
 	if len(l.currNum) != 0 {
 		if !l.containsDot() {
-			l.tokens = append(l.tokens, *token.NewToken(token.INTEGER, string(l.currNum)))
+			l.push(token.NewToken(token.INTEGER, string(l.currNum)), l.wordStart)
 			l.currNum = []rune{}
 		} else {
-			l.tokens = append(l.tokens, *token.NewToken(token.FLOAT, string(l.currNum)))
+			l.push(token.NewToken(token.FLOAT, string(l.currNum)), l.wordStart)
 			l.currNum = []rune{}
 		}
 	}
@@ -63,18 +87,23 @@ func (l *Lexer) flushNum() {
 func (l *Lexer) flushStr() {
 	if len(l.currString) != 0 {
 		if len(l.tokens) > 0 {
-			if l.tokens[len(l.tokens)-1].TokType == token.LET {
-				l.tokens = append(l.tokens, *token.NewToken(token.VAR_NAME, string(l.currString)))
+			if l.tokens[len(l.tokens)-1].TokType == token.LET || l.tokens[len(l.tokens)-1].TokType == token.CONST || l.tokens[len(l.tokens)-1].TokType == token.AS {
+				l.push(token.NewToken(token.VAR_NAME, string(l.currString)), l.wordStart)
+				l.currString = []rune{}
+				return
+			}
+			if l.tokens[len(l.tokens)-1].TokType == token.STRUCT {
+				l.push(token.NewToken(token.STRUCT_NAME, string(l.currString)), l.wordStart)
 				l.currString = []rune{}
 				return
 			}
 			if l.tokens[len(l.tokens)-1].TokType == token.FN {
-				l.tokens = append(l.tokens, *token.NewToken(token.FUNC_NAME, string(l.currString)))
+				l.push(token.NewToken(token.FUNC_NAME, string(l.currString)), l.wordStart)
 				l.currString = []rune{}
 				return
 			}
 		}
-		l.tokens = append(l.tokens, *token.NewToken(token.VAR_REF, string(l.currString)))
+		l.push(token.NewToken(token.VAR_REF, string(l.currString)), l.wordStart)
 		l.currString = []rune{}
 		return
 	}
@@ -83,15 +112,26 @@ func (l *Lexer) flushStr() {
 func (l *Lexer) eat() {
 	l.pos++
 }
+func isIdentChar(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
+}
+
 func (l *Lexer) parseKeyword(word string, tok token.Token) bool {
+	// Keywords only count as whole words so names like "letter" or "nullable" stay names
+	if len(l.currString) != 0 {
+		return false
+	}
 	for i, val := range []rune(word) {
 		if val != l.peek(i) {
 			return false
 		}
 	}
+	if isIdentChar(l.peek(len([]rune(word)))) {
+		return false
+	}
 	l.flushStr()
 	l.flushNum()
-	l.tokens = append(l.tokens, tok)
+	l.push(&tok, l.pos)
 	l.pos += len([]rune(word))
 	return true
 }
@@ -103,15 +143,16 @@ func (l *Lexer) Lex(s string) []token.Token {
 	l.currNum = []rune{}
 	l.currString = []rune{}
 
-	for l.pos < len(l.chars) {
-		if l.isInComment{
-			if l.chars[l.pos] == '*' && l.peek(1) == '/'{
-				l.isInComment = false;
-			}
-			l.eat();
-			l.eat();
-			continue;
+	l.comments = []token.Comment{}
+	l.commentAt = []int{}
+	l.lineStarts = []int{0}
+	for i, ch := range l.chars {
+		if ch == '\n' {
+			l.lineStarts = append(l.lineStarts, i+1)
 		}
+	}
+
+	for l.pos < len(l.chars) {
 		ch := l.getChar()
 		if l.inString && ch != '"' {
 			l.currString = append(l.currString, ch)
@@ -155,93 +196,123 @@ func (l *Lexer) Lex(s string) []token.Token {
 		if l.parseKeyword("break", *token.NewToken(token.BREAK, "break")) {
 			continue
 		}
+		if l.parseKeyword("null", *token.NewToken(token.NULL, "null")) {
+			continue
+		}
+		if l.parseKeyword("const", *token.NewToken(token.CONST, "const")) {
+			continue
+		}
+		if l.parseKeyword("struct", *token.NewToken(token.STRUCT, "struct")) {
+			continue
+		}
+		if l.parseKeyword("import", *token.NewToken(token.IMPORT, "import")) {
+			continue
+		}
+		if l.parseKeyword("export", *token.NewToken(token.EXPORT, "export")) {
+			continue
+		}
+		if l.parseKeyword("as", *token.NewToken(token.AS, "as")) {
+			continue
+		}
 
 		switch {
 		case ch == ';':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.SEMICOLON, ";"))
+			l.push(token.NewToken(token.SEMICOLON, ";"), l.pos)
 			l.eat()
 			continue
-		case ch == '/' && l.peek(1) == '*':
-			l.isInComment = true;
-			l.eat();
-			l.eat();
-			continue;
+		case ch == '/' && (l.peek(1) == '*' || l.peek(1) == '/'):
+			l.flushNum()
+			l.flushStr()
+			l.lexComment()
+			continue
 		case ch == ',':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.COMMA, ","))
+			l.push(token.NewToken(token.COMMA, ","), l.pos)
 			l.eat()
 			continue
 		case ch == '+':
 			l.flushNum()
 			l.flushStr()
 			if l.peek(1) == '=' {
-				l.tokens = append(l.tokens, *token.NewToken(token.COMPOUND_PLUS, "+="))
+				l.push(token.NewToken(token.COMPOUND_PLUS, "+="), l.pos)
 				l.eat()
 			} else if l.peek(1) == '+' {
-				l.tokens = append(l.tokens, *token.NewToken(token.PLUS_PLUS, "++"))
+				l.push(token.NewToken(token.PLUS_PLUS, "++"), l.pos)
 				l.eat()
 			} else {
-				l.tokens = append(l.tokens, *token.NewToken(token.PLUS, "+"))
+				l.push(token.NewToken(token.PLUS, "+"), l.pos)
 			}
 		case ch == '-':
 			l.flushNum()
 			l.flushStr()
 			if l.peek(1) == '=' {
-				l.tokens = append(l.tokens, *token.NewToken(token.COMPOUND_MINUS, "-="))
+				l.push(token.NewToken(token.COMPOUND_MINUS, "-="), l.pos)
 				l.eat()
 			} else if l.peek(1) == '-' {
-				l.tokens = append(l.tokens, *token.NewToken(token.MINUS_MINUS, "--"))
+				l.push(token.NewToken(token.MINUS_MINUS, "--"), l.pos)
 				l.eat()
 			} else {
-				l.tokens = append(l.tokens, *token.NewToken(token.MINUS, "-"))
+				l.push(token.NewToken(token.MINUS, "-"), l.pos)
 			}
 		case ch == '*':
 			l.flushNum()
 			l.flushStr()
 			if l.peek(1) == '=' {
-				l.tokens = append(l.tokens, *token.NewToken(token.COMPOUND_MULTIPLY, "*="))
+				l.push(token.NewToken(token.COMPOUND_MULTIPLY, "*="), l.pos)
+				l.eat()
+			} else if l.peek(1) == '*' && l.peek(2) == '=' {
+				l.push(token.NewToken(token.COMPOUND_EXPONENT, "**="), l.pos)
+				l.eat()
 				l.eat()
 			} else if l.peek(1) == '*' {
-				l.tokens = append(l.tokens, *token.NewToken(token.EXPONENT, "*"))
+				l.push(token.NewToken(token.EXPONENT, "**"), l.pos)
 				l.eat()
 			} else {
-				l.tokens = append(l.tokens, *token.NewToken(token.MULTIPLY, "*"))
+				l.push(token.NewToken(token.MULTIPLY, "*"), l.pos)
 			}
 		case ch == '%':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.MODULO, "%"))
+			if l.peek(1) == '=' {
+				l.push(token.NewToken(token.COMPOUND_MODULO, "%="), l.pos)
+				l.eat()
+			} else {
+				l.push(token.NewToken(token.MODULO, "%"), l.pos)
+			}
 		case ch == '/':
 			l.flushNum()
 			l.flushStr()
 			if l.peek(1) == '=' {
-				l.tokens = append(l.tokens, *token.NewToken(token.COMPOUND_DIVIDE, "/="))
+				l.push(token.NewToken(token.COMPOUND_DIVIDE, "/="), l.pos)
 				l.eat()
 			} else {
-				l.tokens = append(l.tokens, *token.NewToken(token.DIVIDE, "/"))
+				l.push(token.NewToken(token.DIVIDE, "/"), l.pos)
 			}
 		case ch == '=':
 			l.flushNum()
 			l.flushStr()
 			if l.peek(1) == '=' {
-				l.tokens = append(l.tokens, *token.NewToken(token.EQUALS, "=="))
+				l.push(token.NewToken(token.EQUALS, "=="), l.pos)
 				l.eat()
 			} else {
 
-				l.tokens = append(l.tokens, *token.NewToken(token.ASSIGN, "="))
+				l.push(token.NewToken(token.ASSIGN, "="), l.pos)
 			}
 		case ch == '"':
 			if l.inString {
 				// closing quote
-				l.tokens = append(l.tokens, *token.NewToken(token.STRING, string(l.currString)))
+				l.push(token.NewToken(token.STRING, string(l.currString)), l.wordStart)
 				l.currString = []rune{}
 				l.inString = false
 			} else {
 				// opening quote
+				l.flushNum()
+				l.flushStr()
 				l.inString = true
+				l.wordStart = l.pos
 			}
 			l.eat()
 			continue
@@ -249,73 +320,87 @@ func (l *Lexer) Lex(s string) []token.Token {
 			l.flushNum()
 			l.flushStr()
 			if l.peek(1) == '=' {
-				l.tokens = append(l.tokens, *token.NewToken(token.GREATER_THAN_EQT, ">="))
+				l.push(token.NewToken(token.GREATER_THAN_EQT, ">="), l.pos)
 				l.eat()
 			} else {
-				l.tokens = append(l.tokens, *token.NewToken(token.GREATER_THAN, ">"))
+				l.push(token.NewToken(token.GREATER_THAN, ">"), l.pos)
 			}
 		case ch == '<':
 			l.flushNum()
 			l.flushStr()
 			if l.peek(1) == '=' {
-				l.tokens = append(l.tokens, *token.NewToken(token.LESS_THAN_EQT, "<="))
+				l.push(token.NewToken(token.LESS_THAN_EQT, "<="), l.pos)
 				l.eat()
 			} else {
-				l.tokens = append(l.tokens, *token.NewToken(token.LESS_THAN, "<"))
+				l.push(token.NewToken(token.LESS_THAN, "<"), l.pos)
 			}
 		case ch == '[':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.LBRACK, "["))
+			l.push(token.NewToken(token.LBRACK, "["), l.pos)
 		case ch == ']':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.RBRACK, "]"))
+			l.push(token.NewToken(token.RBRACK, "]"), l.pos)
 		case ch == '&' && l.peek(1) == '&':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.AND, "&&"))
+			l.push(token.NewToken(token.AND, "&&"), l.pos)
 			l.eat()
 		case ch == '|' && l.peek(1) == '|':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.OR, "||"))
+			l.push(token.NewToken(token.OR, "||"), l.pos)
 			l.eat()
 		case ch == '!':
 			if l.peek(1) == '=' {
 				l.flushNum()
 				l.flushStr()
-				l.tokens = append(l.tokens, *token.NewToken(token.NOT_EQUAL, "!="))
+				l.push(token.NewToken(token.NOT_EQUAL, "!="), l.pos)
 				l.eat()
 			} else {
 
 				l.flushNum()
 				l.flushStr()
-				l.tokens = append(l.tokens, *token.NewToken(token.NOT, "!"))
+				l.push(token.NewToken(token.NOT, "!"), l.pos)
 			}
 		case ch == '{':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.LBRACE, "{"))
+			l.push(token.NewToken(token.LBRACE, "{"), l.pos)
 		case ch == '}':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.RBRACE, "}"))
+			l.push(token.NewToken(token.RBRACE, "}"), l.pos)
 		case ch == '(':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.LPAREN, "("))
+			l.push(token.NewToken(token.LPAREN, "("), l.pos)
 		case ch == ')':
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.RPAREN, ")"))
-		case unicode.IsLetter(ch) || (len(l.currString) > 0 && unicode.IsDigit(ch)):
+			l.push(token.NewToken(token.RPAREN, ")"), l.pos)
+		case unicode.IsLetter(ch) || ch == '_' || (len(l.currString) > 0 && unicode.IsDigit(ch)):
 			l.flushNum()
+			if len(l.currString) == 0 {
+				l.wordStart = l.pos
+			}
 			l.currString = append(l.currString, ch)
 			l.eat()
 			continue
+		case ch == '.' && len(l.currNum) == 0 && (len(l.currString) > 0 || !unicode.IsDigit(l.peek(1))):
+			// Field access like p.x, a dot only belongs to a number when it is inside one or starts one like .5
+			l.flushStr()
+			l.push(token.NewToken(token.DOT, "."), l.pos)
+		case ch == ':':
+			l.flushNum()
+			l.flushStr()
+			l.push(token.NewToken(token.COLON, ":"), l.pos)
 		case unicode.IsDigit(ch) || ch == '.':
 			l.flushStr()
+			if len(l.currNum) == 0 {
+				l.wordStart = l.pos
+			}
 			l.currNum = append(l.currNum, ch)
 			l.eat()
 			continue
@@ -323,7 +408,7 @@ func (l *Lexer) Lex(s string) []token.Token {
 		default:
 			l.flushNum()
 			l.flushStr()
-			l.tokens = append(l.tokens, *token.NewToken(token.ILLEGAL, string(ch)))
+			l.push(token.NewToken(token.ILLEGAL, string(ch)), l.pos)
 		}
 
 		l.eat()
@@ -331,6 +416,45 @@ func (l *Lexer) Lex(s string) []token.Token {
 
 	l.flushNum()
 	l.flushStr()
+	l.attachComments()
 
 	return l.tokens
 }
+
+// Reads a /* */ or // comment starting at the current position and records it
+func (l *Lexer) lexComment() {
+	start := l.pos
+	if l.peek(1) == '/' {
+		for l.pos < len(l.chars) && l.chars[l.pos] != '\n' {
+			l.eat()
+		}
+	} else {
+		l.pos += 2
+		for l.pos < len(l.chars) && !(l.chars[l.pos] == '*' && l.peek(1) == '/') {
+			l.eat()
+		}
+		if l.pos >= len(l.chars) {
+			pos := l.position(start)
+			panic(fmt.Sprintf("[ERROR] Unterminated comment starting at line %d, column %d\n", pos.Line, pos.Col))
+		}
+		l.pos += 2
+	}
+	text := strings.TrimRight(string(l.chars[start:l.pos]), "\r")
+	l.comments = append(l.comments, token.Comment{Text: text, Pos: l.position(start)})
+	l.commentAt = append(l.commentAt, len(l.tokens))
+}
+
+// Turns the recorded comments into trivia on the tokens around them
+func (l *Lexer) attachComments() {
+	if len(l.tokens) == 0 {
+		return
+	}
+	for i, c := range l.comments {
+		at := l.commentAt[i]
+		if at > 0 && (at == len(l.tokens) || l.tokens[at-1].Pos.Line == c.Pos.Line) {
+			l.tokens[at-1].Trailing = append(l.tokens[at-1].Trailing, c)
+			continue
+		}
+		l.tokens[at].Leading = append(l.tokens[at].Leading, c)
+	}
+}
@@ -1,7 +1,11 @@
 package lexer
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"toy_lang/token"
 )
@@ -23,7 +27,7 @@ func compareTokens(t *testing.T, got, want []token.Token, tt lTest) {
 	}
 
 	for i := 0; i < minLen; i++ {
-		if got[i] != want[i] {
+		if got[i].TokType != want[i].TokType || got[i].Literal != want[i].Literal {
 			stderr += fmt.Sprintf("Mismatch at index %d: got %+v, want %+v\n", i, got[i], want[i])
 		}
 	}
@@ -51,9 +55,9 @@ type lTest struct {
 	id     int
 }
 
-func TestLexer(t *testing.T) {
-	lex := NewLexer()
-	tests := []lTest{
+// The TestLexer cases, FuzzLex starts from their inputs
+func lexerTests() []lTest {
+	return []lTest{
 		{
 			input: "let x = 4;",
 			output: []token.Token{
@@ -727,9 +731,267 @@ func TestLexer(t *testing.T) {
 			},
 			id: 34,
 		},
+		{
+			input: "x%=2; x**=3; y = x ** 2;",
+			output: []token.Token{
+				*token.NewToken(token.VAR_REF, "x"),
+				*token.NewToken(token.COMPOUND_MODULO, "%="),
+				*token.NewToken(token.INTEGER, "2"),
+				*token.NewToken(token.SEMICOLON, ";"),
+				*token.NewToken(token.VAR_REF, "x"),
+				*token.NewToken(token.COMPOUND_EXPONENT, "**="),
+				*token.NewToken(token.INTEGER, "3"),
+				*token.NewToken(token.SEMICOLON, ";"),
+				*token.NewToken(token.VAR_REF, "y"),
+				*token.NewToken(token.ASSIGN, "="),
+				*token.NewToken(token.VAR_REF, "x"),
+				*token.NewToken(token.EXPONENT, "**"),
+				*token.NewToken(token.INTEGER, "2"),
+				*token.NewToken(token.SEMICOLON, ";"),
+			},
+			id: 35,
+		},
+		{
+			input: "let letter = null; let nullable = iffy;",
+			output: []token.Token{
+				*token.NewToken(token.LET, "let"),
+				*token.NewToken(token.VAR_NAME, "letter"),
+				*token.NewToken(token.ASSIGN, "="),
+				*token.NewToken(token.NULL, "null"),
+				*token.NewToken(token.SEMICOLON, ";"),
+				*token.NewToken(token.LET, "let"),
+				*token.NewToken(token.VAR_NAME, "nullable"),
+				*token.NewToken(token.ASSIGN, "="),
+				*token.NewToken(token.VAR_REF, "iffy"),
+				*token.NewToken(token.SEMICOLON, ";"),
+			},
+			id: 36,
+		},
+		{
+			input: "struct P { x } let p = P{x: 1.5}; p.x = .5;",
+			output: []token.Token{
+				*token.NewToken(token.STRUCT, "struct"),
+				*token.NewToken(token.STRUCT_NAME, "P"),
+				*token.NewToken(token.LBRACE, "{"),
+				*token.NewToken(token.VAR_REF, "x"),
+				*token.NewToken(token.RBRACE, "}"),
+				*token.NewToken(token.LET, "let"),
+				*token.NewToken(token.VAR_NAME, "p"),
+				*token.NewToken(token.ASSIGN, "="),
+				*token.NewToken(token.VAR_REF, "P"),
+				*token.NewToken(token.LBRACE, "{"),
+				*token.NewToken(token.VAR_REF, "x"),
+				*token.NewToken(token.COLON, ":"),
+				*token.NewToken(token.FLOAT, "1.5"),
+				*token.NewToken(token.RBRACE, "}"),
+				*token.NewToken(token.SEMICOLON, ";"),
+				*token.NewToken(token.VAR_REF, "p"),
+				*token.NewToken(token.DOT, "."),
+				*token.NewToken(token.VAR_REF, "x"),
+				*token.NewToken(token.ASSIGN, "="),
+				*token.NewToken(token.FLOAT, ".5"),
+				*token.NewToken(token.SEMICOLON, ";"),
+			},
+			id: 37,
+		},
+		{
+			input: "import \"lib/a.toy\" as lib; export fn has(){}",
+			output: []token.Token{
+				*token.NewToken(token.IMPORT, "import"),
+				*token.NewToken(token.STRING, "lib/a.toy"),
+				*token.NewToken(token.AS, "as"),
+				*token.NewToken(token.VAR_NAME, "lib"),
+				*token.NewToken(token.SEMICOLON, ";"),
+				*token.NewToken(token.EXPORT, "export"),
+				*token.NewToken(token.FN, "fn"),
+				*token.NewToken(token.FUNC_NAME, "has"),
+				*token.NewToken(token.LPAREN, "("),
+				*token.NewToken(token.RPAREN, ")"),
+				*token.NewToken(token.LBRACE, "{"),
+				*token.NewToken(token.RBRACE, "}"),
+			},
+			id: 38,
+		},
+		{
+			input: "fn test_add(){} let _x = my_var;",
+			output: []token.Token{
+				*token.NewToken(token.FN, "fn"),
+				*token.NewToken(token.FUNC_NAME, "test_add"),
+				*token.NewToken(token.LPAREN, "("),
+				*token.NewToken(token.RPAREN, ")"),
+				*token.NewToken(token.LBRACE, "{"),
+				*token.NewToken(token.RBRACE, "}"),
+				*token.NewToken(token.LET, "let"),
+				*token.NewToken(token.VAR_NAME, "_x"),
+				*token.NewToken(token.ASSIGN, "="),
+				*token.NewToken(token.VAR_REF, "my_var"),
+				*token.NewToken(token.SEMICOLON, ";"),
+			},
+			id: 39,
+		},
 	}
-	for _, tt := range tests {
+}
+
+func TestLexer(t *testing.T) {
+	lex := NewLexer()
+	for _, tt := range lexerTests() {
 		res := lex.Lex(tt.input)
 		compareTokens(t, res, tt.output, tt)
 	}
 }
+
+func TestPositions(t *testing.T) {
+	lex := NewLexer()
+	toks := lex.Lex("let x = 1; /* one */\n  fn f(a) {\n\treturn \"hi\";\n}/* two\n*/")
+	want := []token.Position{
+		{Line: 1, Col: 1}, {Line: 1, Col: 5}, {Line: 1, Col: 7}, {Line: 1, Col: 9}, {Line: 1, Col: 10},
+		{Line: 2, Col: 3}, {Line: 2, Col: 6}, {Line: 2, Col: 7}, {Line: 2, Col: 8}, {Line: 2, Col: 9}, {Line: 2, Col: 11},
+		{Line: 3, Col: 2}, {Line: 3, Col: 9}, {Line: 3, Col: 13},
+		{Line: 4, Col: 1},
+	}
+	if len(toks) != len(want) {
+		t.Fatalf("[FAILURE] Wanted %d tokens, got %d: %v", len(want), len(toks), toks)
+	}
+	for i, tok := range toks {
+		if tok.Pos != want[i] {
+			t.Errorf("[FAILURE] Token %d (%v) is at %+v, want %+v", i, tok, tok.Pos, want[i])
+		}
+	}
+	comments := lex.Comments()
+	wantComments := []token.Comment{
+		{Text: "/* one */", Pos: token.Position{Line: 1, Col: 12}},
+		{Text: "/* two\n*/", Pos: token.Position{Line: 4, Col: 2}},
+	}
+	if len(comments) != len(wantComments) {
+		t.Fatalf("[FAILURE] Wanted %d comments, got %v", len(wantComments), comments)
+	}
+	for i, c := range comments {
+		if c != wantComments[i] {
+			t.Errorf("[FAILURE] Comment %d is %+v, want %+v", i, c, wantComments[i])
+		}
+	}
+	if !t.Failed() {
+		fmt.Println("\033[32m[PASS] Positions test has passed\033[0m")
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input string
+		// Comment texts expected on each token, keyed by token index
+		leading  map[int][]string
+		trailing map[int][]string
+		types    []token.TokenType
+		id       int
+	}{
+		{
+			input:    "let x = 1; // one\n// two\nx++;",
+			trailing: map[int][]string{4: {"// one"}},
+			leading:  map[int][]string{5: {"// two"}},
+			types:    []token.TokenType{token.LET, token.VAR_NAME, token.ASSIGN, token.INTEGER, token.SEMICOLON, token.VAR_REF, token.PLUS_PLUS, token.SEMICOLON},
+			id:       1,
+		},
+		{
+			input:    "/* a */ /* b */ let/* c */x = 2 / 1;\n/* end */",
+			leading:  map[int][]string{0: {"/* a */", "/* b */"}},
+			trailing: map[int][]string{0: {"/* c */"}, 6: {"/* end */"}},
+			types:    []token.TokenType{token.LET, token.VAR_NAME, token.ASSIGN, token.INTEGER, token.DIVIDE, token.INTEGER, token.SEMICOLON},
+			id:       2,
+		},
+		{
+			input: "println(\"// not /* a comment\");",
+			types: []token.TokenType{token.VAR_REF, token.LPAREN, token.STRING, token.RPAREN, token.SEMICOLON},
+			id:    3,
+		},
+	}
+
+	texts := func(comments []token.Comment) []string {
+		var strs []string
+		for _, c := range comments {
+			strs = append(strs, c.Text)
+		}
+		return strs
+	}
+	for _, tt := range tests {
+		toks := NewLexer().Lex(tt.input)
+		failed := len(toks) != len(tt.types)
+		for i := 0; !failed && i < len(toks); i++ {
+			failed = toks[i].TokType != tt.types[i] ||
+				fmt.Sprint(texts(toks[i].Leading)) != fmt.Sprint(tt.leading[i]) ||
+				fmt.Sprint(texts(toks[i].Trailing)) != fmt.Sprint(tt.trailing[i])
+		}
+		if failed {
+			t.Errorf("[FAILURE] Test number %d has failed\nGot: %+v\n", tt.id, toks)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+
+	func() {
+		defer func() {
+			want := "[ERROR] Unterminated comment starting at line 2, column 3\n"
+			if r := recover(); r != want {
+				t.Errorf("[FAILURE] Unterminated comment test has failed\nGot: %q\nWant: %q\n", r, want)
+			} else {
+				fmt.Println("\033[32m[PASS] Unterminated comment test has passed\033[0m")
+			}
+		}()
+		NewLexer().Lex("let x = 1;\n  /* never closed\nlet y = 2;")
+	}()
+}
+
+func TestTokenJSON(t *testing.T) {
+	toks := NewLexer().Lex("let x = 1.5; // one\nprintln(x >= 2);")
+	data, err := json.Marshal(toks)
+	if err != nil {
+		t.Fatalf("[FAILURE] Marshal failed: %v", err)
+	}
+	var back []token.Token
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("[FAILURE] Unmarshal failed: %v", err)
+	}
+	if fmt.Sprintf("%+v", back) != fmt.Sprintf("%+v", toks) || len(back[4].Trailing) != 1 || back[4].Trailing[0] != toks[4].Trailing[0] {
+		t.Errorf("[FAILURE] Tokens changed in the round trip\nBefore: %+v\nAfter: %+v\n", toks, back)
+	}
+	for i := range toks {
+		if back[i].Pos != toks[i].Pos {
+			t.Errorf("[FAILURE] Token %d moved from %+v to %+v", i, toks[i].Pos, back[i].Pos)
+		}
+	}
+
+	want := `{"type":"LET","literal":"let","pos":{"line":1,"col":1}}`
+	if got, _ := json.Marshal(toks[0]); string(got) != want {
+		t.Errorf("[FAILURE] Got %s, want %s", got, want)
+	}
+	var bad token.Token
+	if err := json.Unmarshal([]byte(`{"type":"NOPE"}`), &bad); err == nil {
+		t.Errorf("[FAILURE] Expected an error for an unknown token type")
+	}
+	if !t.Failed() {
+		fmt.Println("\033[32m[PASS] Token JSON test has passed\033[0m")
+	}
+}
+
+// Seeds are the TestLexer inputs and the programs in test_programs, run with go test ./lexer -fuzz FuzzLex
+func FuzzLex(f *testing.F) {
+	for _, tt := range lexerTests() {
+		f.Add(tt.input)
+	}
+	programs, _ := filepath.Glob("../test_programs/*.toy")
+	for _, path := range programs {
+		if source, err := os.ReadFile(path); err == nil {
+			f.Add(string(source))
+		}
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		// Bad input may stop the lexer with an [ERROR], anything else that panics is a bug
+		defer func() {
+			if r := recover(); r != nil {
+				if msg, ok := r.(string); !ok || !strings.HasPrefix(msg, "[ERROR]") {
+					t.Fatalf("Lexing %q panicked with %v", input, r)
+				}
+			}
+		}()
+		NewLexer().Lex(input)
+	})
+}
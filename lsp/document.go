@@ -0,0 +1,539 @@
+package lsp
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"toy_lang/ast"
+	"toy_lang/evaluator"
+	"toy_lang/formatter"
+	"toy_lang/internal/wire"
+	"toy_lang/lexer"
+	"toy_lang/parser"
+	"toy_lang/resolver"
+	"toy_lang/token"
+	"unicode"
+	"unicode/utf16"
+)
+
+type document struct {
+	text  string
+	lines [][]rune
+	// The last program that parsed, it is kept after an edit breaks the document so hover and completion
+	// keep working while the user types
+	program     ast.ProgramNode
+	diagnostics []Diagnostic
+}
+
+// The lexer reports where an unterminated comment starts in its message
+var lexerPosition = regexp.MustCompile(`line (\d+), column (\d+)`)
+
+func newDocument(text string, prev *document) *document {
+	d := &document{text: text, diagnostics: []Diagnostic{}}
+	for _, line := range strings.Split(text, "\n") {
+		d.lines = append(d.lines, []rune(line))
+	}
+	if prev != nil {
+		d.program = prev.program
+	}
+
+	var toks []token.Token
+	if msg := wire.Catch(func() { toks = lexer.NewLexer().Lex(text) }); msg != "" {
+		var span ast.Span
+		if m := lexerPosition.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			col, _ := strconv.Atoi(m[2])
+			span = ast.Span{Start: token.Position{Line: line, Col: col}, End: token.Position{Line: line, Col: col}}
+		}
+		d.addError(span, msg)
+		return d
+	}
+	p := parser.NewParser()
+	var program ast.ProgramNode
+	if msg := wire.Catch(func() { program = p.Parse(toks) }); msg != "" {
+		d.addError(p.ErrorSpan(), msg)
+		return d
+	}
+	d.program = program
+	for _, err := range resolver.NewResolver().Resolve(program) {
+		var span ast.Span
+		if rerr, ok := err.(*resolver.Error); ok {
+			span = rerr.Span
+		}
+		d.addError(span, err.Error())
+	}
+	return d
+}
+
+func (d *document) addError(span ast.Span, msg string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    d.spanRange(span),
+		Severity: severityError,
+		Source:   "toy_lang",
+		Message:  msg,
+	})
+}
+
+func utf16Len(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// Converts a 1 based token position, which counts runes, to an LSP position
+func (d *document) position(p token.Position) Position {
+	line := min(max(p.Line-1, 0), len(d.lines)-1)
+	col := min(max(p.Col-1, 0), len(d.lines[line]))
+	return Position{Line: line, Character: utf16Len(d.lines[line][:col])}
+}
+
+// Converts an LSP position to a token position
+func (d *document) tokenPos(p Position) token.Position {
+	line := min(max(p.Line, 0), len(d.lines)-1)
+	units, col := 0, 0
+	for col < len(d.lines[line]) && units < p.Character {
+		units += utf16.RuneLen(d.lines[line][col])
+		col++
+	}
+	return token.Position{Line: line + 1, Col: col + 1}
+}
+
+// Returns the rune at p, or 0 when p is past the end of its line
+func (d *document) at(p token.Position) rune {
+	if p.Line < 1 || p.Line > len(d.lines) || p.Col < 1 || p.Col > len(d.lines[p.Line-1]) {
+		return 0
+	}
+	return d.lines[p.Line-1][p.Col-1]
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Spans end at the start of their last token, this finds where that token ends
+func (d *document) tokenEnd(p token.Position) token.Position {
+	switch r := d.at(p); {
+	case isIdent(r):
+		for isIdent(d.at(p)) {
+			p.Col++
+		}
+	case r == '"':
+		p.Col++
+		for d.at(p) != '"' && d.at(p) != 0 {
+			p.Col++
+		}
+		p.Col++
+	default:
+		p.Col++
+	}
+	return p
+}
+
+// Errors without a position cover the first line
+func (d *document) spanRange(span ast.Span) Range {
+	if span.Start.Line == 0 {
+		return Range{End: Position{Character: utf16Len(d.lines[0])}}
+	}
+	return Range{Start: d.position(span.Start), End: d.position(d.tokenEnd(span.End))}
+}
+
+// Returns the name under p along with where it starts and ends, or "" if there isn't one
+func (d *document) wordAt(p Position) (string, token.Position, token.Position) {
+	start := d.tokenPos(p)
+	// A cursor right after a name still counts as on it
+	if !isIdent(d.at(start)) && start.Col > 1 {
+		start.Col--
+	}
+	if !isIdent(d.at(start)) {
+		return "", start, start
+	}
+	for start.Col > 1 && isIdent(d.at(token.Position{Line: start.Line, Col: start.Col - 1})) {
+		start.Col--
+	}
+	end := start
+	for isIdent(d.at(end)) {
+		end.Col++
+	}
+	word := string(d.lines[start.Line-1][start.Col-1 : end.Col-1])
+	if unicode.IsDigit(rune(word[0])) {
+		return "", start, start
+	}
+	return word, start, end
+}
+
+// Whether the name starting at p is a field or method, like the x in p.x
+func (d *document) afterDot(p token.Position) bool {
+	p.Col--
+	for d.at(p) == ' ' || d.at(p) == '\t' {
+		p.Col--
+	}
+	return d.at(p) == '.'
+}
+
+// Returns the range of the first whole word occurrence of name at or after from, nodes only know where they
+// start so this is how declarations find their names
+func (d *document) findName(from token.Position, name string) Range {
+	target := []rune(name)
+	for line := max(from.Line, 1); line <= len(d.lines); line++ {
+		runes := d.lines[line-1]
+		col := 0
+		if line == from.Line {
+			col = max(from.Col-1, 0)
+		}
+		for ; col+len(target) <= len(runes); col++ {
+			if string(runes[col:col+len(target)]) != name {
+				continue
+			}
+			if col > 0 && isIdent(runes[col-1]) || col+len(target) < len(runes) && isIdent(runes[col+len(target)]) {
+				continue
+			}
+			start := token.Position{Line: line, Col: col + 1}
+			end := token.Position{Line: line, Col: col + len(target) + 1}
+			return Range{Start: d.position(start), End: d.position(end)}
+		}
+	}
+	p := d.position(from)
+	return Range{Start: p, End: p}
+}
+
+// Kinds of declaration
+const (
+	declLet = iota
+	declConst
+	declFunc
+	declParam
+	declSelf
+	declStruct
+	declImport
+)
+
+type decl struct {
+	name string
+	kind int
+	// The declaring LetStmtNode, FuncDecNode, StructDecNode or ImportStmtNode, the function for a parameter
+	// and the struct for self
+	node ast.Node
+}
+
+// The statement a declaration is in starts at its span, the name comes after that
+func (d *document) declRange(dec decl) Range {
+	return d.findName(ast.SpanOf(dec.node).Start, dec.name)
+}
+
+func spanContains(span ast.Span, p token.Position) bool {
+	return span.Start.Line != 0 && !p.Before(span.Start) && p.Line <= span.End.Line
+}
+
+// Returns the names visible at p, inner declarations hide outer ones
+func (d *document) visibleAt(p token.Position) map[string]decl {
+	decls := make(map[string]decl)
+	collect(d.program.Statements, p, decls)
+	return decls
+}
+
+func collect(stmts []ast.Node, p token.Position, decls map[string]decl) {
+	// Functions and structs can be used anywhere in the block they're declared in
+	for _, stmt := range stmts {
+		switch n := unexport(stmt).(type) {
+		case *ast.FuncDecNode:
+			decls[n.Name] = decl{name: n.Name, kind: declFunc, node: n}
+		case *ast.StructDecNode:
+			decls[n.Name] = decl{name: n.Name, kind: declStruct, node: n}
+		}
+	}
+	for _, stmt := range stmts {
+		span := ast.SpanOf(stmt)
+		if !span.Start.Before(p) {
+			return
+		}
+		switch n := unexport(stmt).(type) {
+		case *ast.LetStmtNode:
+			kind := declLet
+			if n.Const {
+				kind = declConst
+			}
+			decls[n.Name] = decl{name: n.Name, kind: kind, node: n}
+		case *ast.ImportStmtNode:
+			decls[n.Alias] = decl{name: n.Alias, kind: declImport, node: n}
+		}
+		if !spanContains(span, p) {
+			continue
+		}
+		switch n := unexport(stmt).(type) {
+		case *ast.IfStmtNode:
+			if len(n.Alt) > 0 && !p.Before(ast.SpanOf(n.Alt[0]).Start) {
+				collect(n.Alt, p, decls)
+			} else {
+				collect(n.Body, p, decls)
+			}
+		case *ast.WhileStmtNode:
+			collect(n.Body, p, decls)
+		case *ast.FuncDecNode:
+			collectFunc(n, p, decls)
+		case *ast.StructDecNode:
+			for j := range n.Methods {
+				if spanContains(n.Methods[j].Span, p) {
+					decls["self"] = decl{name: "self", kind: declSelf, node: n}
+					collectFunc(&n.Methods[j], p, decls)
+				}
+			}
+		}
+	}
+}
+
+func collectFunc(f *ast.FuncDecNode, p token.Position, decls map[string]decl) {
+	for _, param := range f.Params {
+		decls[param.Name] = decl{name: param.Name, kind: declParam, node: f}
+	}
+	collect(f.Body, p, decls)
+}
+
+func unexport(stmt ast.Node) ast.Node {
+	if export, ok := stmt.(*ast.ExportStmtNode); ok {
+		return export.Stmt
+	}
+	return stmt
+}
+
+// Returns every method in the document called name, a method call doesn't say which struct it belongs to
+func (d *document) methods(name string) []*ast.FuncDecNode {
+	var found []*ast.FuncDecNode
+	ast.Inspect(&d.program, func(n ast.Node) bool {
+		if s, ok := n.(*ast.StructDecNode); ok {
+			for j := range s.Methods {
+				if s.Methods[j].Name == name {
+					found = append(found, &s.Methods[j])
+				}
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// Returns the struct that declares method
+func (d *document) structOf(method *ast.FuncDecNode) string {
+	name := ""
+	ast.Inspect(&d.program, func(n ast.Node) bool {
+		if s, ok := n.(*ast.StructDecNode); ok {
+			for j := range s.Methods {
+				if &s.Methods[j] == method {
+					name = s.Name
+				}
+			}
+		}
+		return name == ""
+	})
+	return name
+}
+
+var builtinFuncs map[string]ast.FuncDecNode
+
+// The builtins live in the scope above an interpreter's main scope
+func builtins() map[string]ast.FuncDecNode {
+	if builtinFuncs == nil {
+		in := evaluator.NewInterpreter()
+		builtinFuncs = in.MainScope.Parent.Funcs
+	}
+	return builtinFuncs
+}
+
+func code(s string) string {
+	return "```toy\n" + s + "\n```"
+}
+
+func (d *document) hover(p Position) *Hover {
+	name, start, end := d.wordAt(p)
+	if name == "" {
+		return nil
+	}
+	var text string
+	if d.afterDot(start) {
+		methods := d.methods(name)
+		if len(methods) == 0 {
+			return nil
+		}
+		var parts []string
+		for _, m := range methods {
+			parts = append(parts, code(formatter.FuncHeader(m))+"\n\nMethod of "+d.structOf(m))
+		}
+		text = strings.Join(parts, "\n\n---\n\n")
+	} else if dec, ok := d.visibleAt(start)[name]; ok {
+		text = describe(dec)
+	} else if f, ok := builtins()[name]; ok {
+		text = code(formatter.FuncHeader(&f)) + "\n\nBuiltin function"
+	} else {
+		return nil
+	}
+	return &Hover{
+		Contents: markupContent{Kind: "markdown", Value: text},
+		Range:    Range{Start: d.position(start), End: d.position(end)},
+	}
+}
+
+func describe(dec decl) string {
+	switch n := dec.node.(type) {
+	case *ast.LetStmtNode:
+		return code(formatter.Stmt(n))
+	case *ast.FuncDecNode:
+		if dec.kind == declParam {
+			return code(dec.name) + "\n\nParameter of `" + formatter.FuncHeader(n) + "`"
+		}
+		return code(formatter.FuncHeader(n))
+	case *ast.StructDecNode:
+		if dec.kind == declSelf {
+			return code("self") + "\n\nThe " + n.Name + " the method was called on"
+		}
+		text := code("struct " + n.Name)
+		if len(n.Fields) > 0 {
+			text += "\n\nFields: " + strings.Join(n.Fields, ", ")
+		}
+		if len(n.Methods) > 0 {
+			var methods []string
+			for j := range n.Methods {
+				methods = append(methods, strings.TrimPrefix(formatter.FuncHeader(&n.Methods[j]), "fn "))
+			}
+			text += "\n\nMethods: " + strings.Join(methods, ", ")
+		}
+		return text
+	case *ast.ImportStmtNode:
+		return code(formatter.Stmt(n))
+	}
+	return code(dec.name)
+}
+
+// Finds the function declaration for the name under p
+func (d *document) definition(p Position) (Range, bool) {
+	name, start, _ := d.wordAt(p)
+	if name == "" {
+		return Range{}, false
+	}
+	if d.afterDot(start) {
+		if methods := d.methods(name); len(methods) > 0 {
+			return d.findName(methods[0].Start, name), true
+		}
+		return Range{}, false
+	}
+	if dec, ok := d.visibleAt(start)[name]; ok && dec.kind == declFunc {
+		return d.declRange(dec), true
+	}
+	return Range{}, false
+}
+
+func (d *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, stmt := range d.program.Statements {
+		if sym, ok := d.symbol(unexport(stmt), ast.SpanOf(stmt)); ok {
+			symbols = append(symbols, sym)
+		}
+	}
+	return symbols
+}
+
+func (d *document) symbol(stmt ast.Node, span ast.Span) (DocumentSymbol, bool) {
+	sym := DocumentSymbol{Range: d.spanRange(span)}
+	switch n := stmt.(type) {
+	case *ast.LetStmtNode:
+		sym.Name, sym.Kind = n.Name, symbolVariable
+		if n.Const {
+			sym.Kind = symbolConstant
+		}
+	case *ast.FuncDecNode:
+		sym.Name, sym.Kind, sym.Detail = n.Name, symbolFunction, formatter.FuncHeader(n)
+	case *ast.StructDecNode:
+		sym.Name, sym.Kind = n.Name, symbolStruct
+		for _, field := range n.Fields {
+			r := d.findName(span.Start, field)
+			sym.Children = append(sym.Children, DocumentSymbol{Name: field, Kind: symbolField, Range: r, SelectionRange: r})
+		}
+		for j := range n.Methods {
+			m := &n.Methods[j]
+			sym.Children = append(sym.Children, DocumentSymbol{
+				Name:           m.Name,
+				Detail:         formatter.FuncHeader(m),
+				Kind:           symbolMethod,
+				Range:          d.spanRange(m.Span),
+				SelectionRange: d.findName(m.Start, m.Name),
+			})
+		}
+	case *ast.ImportStmtNode:
+		sym.Name, sym.Kind, sym.Detail = n.Alias, symbolModule, n.Path
+	default:
+		return sym, false
+	}
+	// The alias is the last token of an import, other names come right after their keywords
+	from := ast.SpanOf(stmt).Start
+	if _, ok := stmt.(*ast.ImportStmtNode); ok {
+		from = ast.SpanOf(stmt).End
+	}
+	sym.SelectionRange = d.findName(from, sym.Name)
+	return sym, true
+}
+
+var keywords = []string{"as", "break", "const", "continue", "else", "export", "false", "fn", "if", "import", "let", "null", "return", "struct", "true", "while"}
+
+func (d *document) completion(p Position) []CompletionItem {
+	items := []CompletionItem{}
+	_, start, _ := d.wordAt(p)
+	pos := d.tokenPos(p)
+	if d.afterDot(start) || d.afterDot(pos) {
+		// Fields and methods of every struct, the type of the value isn't known
+		seen := make(map[string]bool)
+		ast.Inspect(&d.program, func(n ast.Node) bool {
+			if s, ok := n.(*ast.StructDecNode); ok {
+				for _, field := range s.Fields {
+					if !seen[field] {
+						seen[field] = true
+						items = append(items, CompletionItem{Label: field, Kind: completionVariable, Detail: "field of " + s.Name})
+					}
+				}
+				for j := range s.Methods {
+					m := &s.Methods[j]
+					if !seen[m.Name] {
+						seen[m.Name] = true
+						items = append(items, CompletionItem{Label: m.Name, Kind: completionFunction, Detail: formatter.FuncHeader(m)})
+					}
+				}
+			}
+			return true
+		})
+		sortCompletions(items)
+		return items
+	}
+
+	seen := make(map[string]bool)
+	for name, dec := range d.visibleAt(pos) {
+		seen[name] = true
+		item := CompletionItem{Label: name}
+		switch dec.kind {
+		case declLet, declParam, declSelf:
+			item.Kind = completionVariable
+		case declConst:
+			item.Kind = completionConstant
+		case declFunc:
+			item.Kind, item.Detail = completionFunction, formatter.FuncHeader(dec.node.(*ast.FuncDecNode))
+		case declStruct:
+			item.Kind = completionStruct
+		case declImport:
+			item.Kind, item.Detail = completionModule, dec.node.(*ast.ImportStmtNode).Path
+		}
+		items = append(items, item)
+	}
+	for name, f := range builtins() {
+		if !seen[name] {
+			items = append(items, CompletionItem{Label: name, Kind: completionFunction, Detail: formatter.FuncHeader(&f)})
+		}
+	}
+	for _, kw := range keywords {
+		items = append(items, CompletionItem{Label: kw, Kind: completionKeyword})
+	}
+	sortCompletions(items)
+	return items
+}
+
+func sortCompletions(items []CompletionItem) {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+}
@@ -0,0 +1,336 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///test.toy"
+
+const source = `fn add(a, b) {
+    return a + b;
+}
+struct P {
+    x
+    fn get() {
+        return self.x;
+    }
+}
+const limit = 10;
+let total = add(1, limit);
+let p = P{x: 1};
+println(p.get());
+`
+
+// Frames each message the way a client sends it
+func frame(msgs ...string) string {
+	var out strings.Builder
+	for _, msg := range msgs {
+		fmt.Fprintf(&out, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	return out.String()
+}
+
+func open(text string) string {
+	data, _ := json.Marshal(text)
+	return `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"` + uri + `","version":1,"text":` + string(data) + `}}}`
+}
+
+func request(id int, method, params string) string {
+	return `{"jsonrpc":"2.0","id":` + strconv.Itoa(id) + `,"method":"` + method + `","params":` + params + `}`
+}
+
+func at(line, char int) string {
+	return fmt.Sprintf(`{"textDocument":{"uri":"%s"},"position":{"line":%d,"character":%d}}`, uri, line, char)
+}
+
+// Runs a whole session, from initialize to exit, and returns every message the server sent
+func session(t *testing.T, msgs ...string) []map[string]json.RawMessage {
+	all := []string{request(1, "initialize", `{}`), `{"jsonrpc":"2.0","method":"initialized","params":{}}`}
+	all = append(all, msgs...)
+	all = append(all, request(99, "shutdown", `null`), `{"jsonrpc":"2.0","method":"exit"}`)
+
+	var out bytes.Buffer
+	if err := NewServer(strings.NewReader(frame(all...)), &out).Serve(); err != nil {
+		t.Fatalf("[FAILURE] Serve failed: %v", err)
+	}
+	return readAll(t, &out)
+}
+
+func readAll(t *testing.T, out io.Reader) []map[string]json.RawMessage {
+	var got []map[string]json.RawMessage
+	s := &Server{in: bufio.NewReader(out)}
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatalf("[FAILURE] Server sent a bad message: %v", err)
+		}
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("[FAILURE] Server sent invalid JSON: %v", err)
+		}
+		got = append(got, msg)
+	}
+}
+
+// Returns the result or error of the response to id, or the params of the first notification of method
+func find(msgs []map[string]json.RawMessage, id string) string {
+	for _, msg := range msgs {
+		if string(msg["id"]) == id {
+			if e, ok := msg["error"]; ok {
+				return string(e)
+			}
+			return string(msg["result"])
+		}
+		if string(msg["method"]) == id {
+			return string(msg["params"])
+		}
+	}
+	return ""
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		text string
+		msg  string
+		// The id of the response to check, or the quoted method of a notification
+		find string
+		// Substrings of the result JSON
+		want []string
+		// Substrings the result must not have
+		unwanted []string
+		id       int
+	}{
+		{
+			text: source,
+			find: `1`,
+			want: []string{`"hoverProvider":true`, `"definitionProvider":true`, `"documentSymbolProvider":true`, `"completionProvider":{}`, `"documentFormattingProvider":true`, `"textDocumentSync":1`},
+			id:   1,
+		},
+		{
+			text: source,
+			find: `"textDocument/publishDiagnostics"`,
+			want: []string{`"diagnostics":[]`},
+			id:   2,
+		},
+		{
+			text: "let x = 1;\nconst y = 2;\ny = 3;\n",
+			find: `"textDocument/publishDiagnostics"`,
+			want: []string{`"range":{"start":{"line":2,"character":0},"end":{"line":2,"character":5}}`, `"severity":1`, `"message":"[ERROR] Cannot reassign constant y"`},
+			id:   3,
+		},
+		{
+			text: "let x = 1;\n  /* never closed",
+			find: `"textDocument/publishDiagnostics"`,
+			want: []string{`"range":{"start":{"line":1,"character":2},"end":{"line":1,"character":3}}`, `Unterminated comment`},
+			id:   4,
+		},
+		{
+			text: "let x = 1;\nlet = 3;\n",
+			find: `"textDocument/publishDiagnostics"`,
+			want: []string{`"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":7}}`, `Declaration needs a name and a value`},
+			id:   5,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/hover", at(10, 13)),
+			find: `2`,
+			want: []string{"fn add(a, b)", `"range":{"start":{"line":10,"character":12},"end":{"line":10,"character":15}}`},
+			id:   6,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/hover", at(10, 20)),
+			find: `2`,
+			want: []string{"const limit = 10"},
+			id:   7,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/hover", at(1, 11)),
+			find: `2`,
+			want: []string{"Parameter of `fn add(a, b)`"},
+			id:   8,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/hover", at(12, 11)),
+			find: `2`,
+			want: []string{"fn get()", "Method of P"},
+			id:   9,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/hover", at(12, 3)),
+			find: `2`,
+			want: []string{"fn println(input)", "Builtin function"},
+			id:   10,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/hover", at(6, 16)),
+			find: `2`,
+			want: []string{"The P the method was called on"},
+			id:   11,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/hover", at(10, 16)),
+			find: `2`,
+			want: []string{"null"},
+			id:   12,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/definition", at(10, 13)),
+			find: `2`,
+			want: []string{`{"uri":"file:///test.toy","range":{"start":{"line":0,"character":3},"end":{"line":0,"character":6}}}`},
+			id:   13,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/definition", at(12, 11)),
+			find: `2`,
+			want: []string{`"range":{"start":{"line":5,"character":7},"end":{"line":5,"character":10}}`},
+			id:   14,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/definition", at(10, 20)),
+			find: `2`,
+			want: []string{"null"},
+			id:   15,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/documentSymbol", `{"textDocument":{"uri":"`+uri+`"}}`),
+			find: `2`,
+			want: []string{
+				`{"name":"add","detail":"fn add(a, b)","kind":12,"range":{"start":{"line":0,"character":0},"end":{"line":2,"character":1}},"selectionRange":{"start":{"line":0,"character":3},"end":{"line":0,"character":6}}}`,
+				`{"name":"x","kind":8,"range":{"start":{"line":4,"character":4},"end":{"line":4,"character":5}}`,
+				`{"name":"get","detail":"fn get()","kind":6`,
+				`{"name":"limit","kind":14`,
+				`{"name":"total","kind":13`,
+			},
+			id: 16,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/completion", at(10, 0)),
+			find: `2`,
+			want: []string{`{"label":"add","kind":3,"detail":"fn add(a, b)"}`, `{"label":"limit","kind":21}`, `{"label":"P","kind":22}`, `{"label":"println","kind":3`, `{"label":"while","kind":14}`},
+			// total is declared on the line being typed, a and b belong to add
+			unwanted: []string{`"total"`, `"a"`, `"self"`},
+			id:       17,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/completion", at(1, 4)),
+			find: `2`,
+			want: []string{`{"label":"a","kind":6}`, `{"label":"b","kind":6}`},
+			id:   18,
+		},
+		{
+			text:     source,
+			msg:      request(2, "textDocument/completion", at(12, 10)),
+			find:     `2`,
+			want:     []string{`{"label":"get","kind":3,"detail":"fn get()"}`, `{"label":"x","kind":6,"detail":"field of P"}`},
+			unwanted: []string{`"println"`},
+			id:       19,
+		},
+		{
+			text: "let x=1;\nfn f(a,b){return a+b;}",
+			msg:  request(2, "textDocument/formatting", `{"textDocument":{"uri":"`+uri+`"}}`),
+			find: `2`,
+			want: []string{`[{"range":{"start":{"line":0,"character":0},"end":{"line":1,"character":22}},"newText":"let x = 1;\nfn f(a, b) {\n    return a + b;\n}\n"}]`},
+			id:   20,
+		},
+		{
+			text: "let x = 1;\n",
+			msg:  request(2, "textDocument/formatting", `{"textDocument":{"uri":"`+uri+`"}}`),
+			find: `2`,
+			want: []string{`[]`},
+			id:   21,
+		},
+		{
+			text: source,
+			msg:  request(2, "textDocument/rename", at(0, 3)),
+			find: `2`,
+			want: []string{`"code":-32601`},
+			id:   22,
+		},
+		{
+			// Hover keeps working with the last program that parsed
+			text: source,
+			msg:  `{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"` + uri + `"},"contentChanges":[{"text":"` + strings.ReplaceAll(source, "\n", `\n`) + `let = ;"}]}}` + "\n" + request(2, "textDocument/hover", at(10, 13)),
+			find: `2`,
+			want: []string{"fn add(a, b)"},
+			id:   23,
+		},
+	}
+
+	for _, tt := range tests {
+		msgs := []string{open(tt.text)}
+		for _, msg := range strings.Split(tt.msg, "\n") {
+			if msg != "" {
+				msgs = append(msgs, msg)
+			}
+		}
+		got := find(session(t, msgs...), tt.find)
+		failed := false
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				failed = true
+			}
+		}
+		for _, unwanted := range tt.unwanted {
+			if strings.Contains(got, unwanted) {
+				failed = true
+			}
+		}
+		if failed {
+			t.Errorf("\033[31m[FAILURE] Test number %d has failed\033[0m\nGot:  %s\nWant: %q\nUnwanted: %q\n", tt.id, got, tt.want, tt.unwanted)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+		id    int
+	}{
+		{input: frame(request(1, "initialize", `{}`), `{"jsonrpc":"2.0","method":"exit"}`), err: "without a shutdown request", id: 1},
+		{input: frame(request(1, "initialize", `{}`)), err: "closed the connection", id: 2},
+		{input: "Content-Type: x\r\n\r\n{}", err: "no Content-Length", id: 3},
+		{input: "Content-Length: 10\r\n\r\n{}", err: "Could not read message body", id: 4},
+	}
+	for _, tt := range tests {
+		err := NewServer(strings.NewReader(tt.input), io.Discard).Serve()
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("\033[31m[FAILURE] Test number %d has failed\033[0m\nGot:  %v\nWant: %q\n", tt.id, err, tt.err)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+
+	// Requests before initialize are refused
+	var out bytes.Buffer
+	NewServer(strings.NewReader(frame(request(1, "textDocument/hover", at(0, 0)))), &out).Serve()
+	if got := find(readAll(t, &out), "1"); !strings.Contains(got, `"code":-32002`) {
+		t.Errorf("\033[31m[FAILURE] Test number 5 has failed\033[0m\nGot: %s\n", got)
+	} else {
+		fmt.Printf("\033[32m[PASS] Test number 5 has passed\033[0m\n")
+	}
+}
@@ -0,0 +1,206 @@
+// Package lsp is a Language Server Protocol server for toy_lang that talks JSON-RPC over a pair of streams
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"toy_lang/formatter"
+	"toy_lang/internal/wire"
+)
+
+// Server keeps the open documents, every document is reanalyzed from scratch when it changes
+type Server struct {
+	in          *bufio.Reader
+	out         io.Writer
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// Serve handles messages until the client sends exit or closes the stream. It returns an error if the stream
+// breaks or the client leaves without asking for a shutdown first
+func (s *Server) Serve() error {
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			if s.shutdown {
+				return nil
+			}
+			return errors.New("[ERROR] Client closed the connection without a shutdown request")
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("[ERROR] Client sent exit without a shutdown request")
+			}
+			return nil
+		}
+		s.handle(msg)
+	}
+}
+
+func (s *Server) read() ([]byte, error) {
+	return wire.ReadMessage(s.in)
+}
+
+func (s *Server) write(v any) {
+	wire.WriteMessage(s.out, v)
+}
+
+func (s *Server) reply(id *json.RawMessage, result any) {
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, msg string) {
+	s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: msg}})
+}
+
+func (s *Server) notify(method string, params any) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Requests have an id and get exactly one response, notifications don't and never get one
+func (s *Server) handle(msg message) {
+	isRequest := msg.ID != nil
+	defer func() {
+		if r := recover(); r != nil {
+			if isRequest {
+				s.replyError(msg.ID, codeInternalError, wire.Message(r))
+			}
+		}
+	}()
+
+	if msg.Method == "" {
+		if isRequest {
+			s.replyError(msg.ID, codeInvalidRequest, "[ERROR] Request has no method")
+		}
+		return
+	}
+	if !s.initialized && msg.Method != "initialize" {
+		if isRequest {
+			s.replyError(msg.ID, codeNotInitialized, "[ERROR] Server is not initialized")
+		}
+		return
+	}
+
+	switch msg.Method {
+	case "initialize":
+		s.initialized = true
+		s.reply(msg.ID, map[string]any{
+			"capabilities": map[string]any{
+				// Full document sync, every change sends the whole text
+				"textDocumentSync":           1,
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"documentSymbolProvider":     true,
+				"completionProvider":         map[string]any{},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "toy_lang"},
+		})
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+		s.reply(msg.ID, nil)
+	case "textDocument/didOpen":
+		var params didOpenParams
+		decode(msg.Params, &params)
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		decode(msg.Params, &params)
+		if len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		decode(msg.Params, &params)
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	case "textDocument/hover":
+		var params positionParams
+		decode(msg.Params, &params)
+		var result any
+		if hover := s.doc(params.TextDocument.URI).hover(params.Position); hover != nil {
+			result = hover
+		}
+		s.reply(msg.ID, result)
+	case "textDocument/definition":
+		var params positionParams
+		decode(msg.Params, &params)
+		var result any
+		if r, ok := s.doc(params.TextDocument.URI).definition(params.Position); ok {
+			result = Location{URI: params.TextDocument.URI, Range: r}
+		}
+		s.reply(msg.ID, result)
+	case "textDocument/documentSymbol":
+		var params documentParams
+		decode(msg.Params, &params)
+		s.reply(msg.ID, s.doc(params.TextDocument.URI).symbols())
+	case "textDocument/completion":
+		var params positionParams
+		decode(msg.Params, &params)
+		s.reply(msg.ID, s.doc(params.TextDocument.URI).completion(params.Position))
+	case "textDocument/formatting":
+		var params documentParams
+		decode(msg.Params, &params)
+		s.reply(msg.ID, s.doc(params.TextDocument.URI).formatting())
+	default:
+		if isRequest {
+			s.replyError(msg.ID, codeMethodNotFound, fmt.Sprintf("[ERROR] Method %s is not supported", msg.Method))
+		}
+	}
+}
+
+func decode(params json.RawMessage, v any) {
+	if err := json.Unmarshal(params, v); err != nil {
+		panic(fmt.Sprintf("[ERROR] Invalid params: %v", err))
+	}
+}
+
+func (s *Server) doc(uri string) *document {
+	doc, ok := s.docs[uri]
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] Document %s is not open", uri))
+	}
+	return doc
+}
+
+// Reanalyzes a document and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	doc := newDocument(text, s.docs[uri])
+	s.docs[uri] = doc
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics})
+}
+
+// Returns edits that turn the document into its formatted form, or none if it doesn't compile
+func (d *document) formatting() []TextEdit {
+	formatted, err := formatter.Source(d.text)
+	if err != nil || formatted == d.text {
+		return []TextEdit{}
+	}
+	last := len(d.lines) - 1
+	return []TextEdit{{
+		Range:   Range{End: Position{Line: last, Character: utf16Len(d.lines[last])}},
+		NewText: formatted,
+	}}
+}
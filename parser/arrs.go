@@ -17,20 +17,7 @@ func (p *Parser) parseArr(toks []token.Token) ast.Node {
 		panic(fmt.Sprintf("[ERROR] Array must end with closing bracket, got %v\n", toks[len(toks)-1]))
 	}
 
-	var vals [][]token.Token
-	var currVal []token.Token
-	for _, val := range toks[1 : len(toks)-1] {
-		if val.TokType == token.COMMA {
-			vals = append(vals, currVal)
-			currVal = []token.Token{}
-			continue
-		}
-		currVal = append(currVal, val)
-	}
-	// append last value
-	if len(currVal) > 0 {
-		vals = append(vals, currVal)
-	}
+	vals := splitArgs(toks[1 : len(toks)-1])
 
 	var valNodes []ast.Node
 	for _, val := range vals {
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"fmt"
+	"toy_lang/ast"
+	"toy_lang/token"
+)
+
+// Maps each compound operator to the arithmetic operator it applies
+var compoundOperators = map[token.TokenType]token.TokenType{
+	token.COMPOUND_PLUS:     token.PLUS,
+	token.COMPOUND_MINUS:    token.MINUS,
+	token.COMPOUND_MULTIPLY: token.MULTIPLY,
+	token.COMPOUND_DIVIDE:   token.DIVIDE,
+	token.COMPOUND_MODULO:   token.MODULO,
+	token.COMPOUND_EXPONENT: token.EXPONENT,
+	token.PLUS_PLUS:         token.PLUS,
+	token.MINUS_MINUS:       token.MINUS,
+}
+
+func findCompoundOperator(toks []token.Token) int {
+	depth := 0
+	for i, tok := range toks {
+		switch tok.TokType {
+		case token.LPAREN, token.LBRACK, token.STRUCT_LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.STRUCT_RBRACE:
+			depth--
+		default:
+			if _, ok := compoundOperators[tok.TokType]; ok && depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (p *Parser) parseCompoundAssign(toks []token.Token, opIdx int) *ast.CompoundAssignNode {
+	if opIdx == 0 {
+		panic(fmt.Sprintf("[ERROR] Compound operator %v needs something to assign to, got %v\n", toks[0].Literal, toks))
+	}
+	target := p.parseExpression(toks[:opIdx])
+	if empty, ok := target.(*ast.EmptyExprNode); ok && empty.Child.NodeType() == ast.FieldAccess {
+		target = empty.Child
+	}
+	if target.NodeType() != ast.ReferenceExpr && target.NodeType() != ast.ArrRef && target.NodeType() != ast.FieldAccess {
+		panic(fmt.Sprintf("[ERROR] Can only use %v on a variable, an array element or a field, got %v\n", toks[opIdx].Literal, target))
+	}
+
+	opTok := toks[opIdx]
+	var value ast.Node
+	if opTok.TokType == token.PLUS_PLUS || opTok.TokType == token.MINUS_MINUS {
+		if opIdx != len(toks)-1 {
+			panic(fmt.Sprintf("[ERROR] Unexpected tokens after %v, got %v\n", opTok.Literal, toks[opIdx+1:]))
+		}
+		value = &ast.IntLiteralNode{Value: 1}
+	} else {
+		if opIdx == len(toks)-1 {
+			panic(fmt.Sprintf("[ERROR] Compound operator %v is missing a value, got %v\n", opTok.Literal, toks))
+		}
+		value = p.parseExpression(toks[opIdx+1:])
+	}
+
+	return &ast.CompoundAssignNode{
+		Target:   target,
+		Operator: compoundOperators[opTok.TokType],
+		Value:    value,
+		Postfix:  opTok.TokType == token.PLUS_PLUS || opTok.TokType == token.MINUS_MINUS,
+	}
+}
@@ -10,6 +10,9 @@ func (p *Parser) parseFuncDecStmt(toks []token.Token) *ast.FuncDecNode {
 	if toks[0].TokType != token.FN {
 		panic(fmt.Sprintf("[ERROR] Must use fn to declare function, got %v\n", toks[0]))
 	}
+	if len(toks) < 3 {
+		panic(fmt.Sprintf("[ERROR] Function declaration needs a name, params and a body, got %v\n", toks))
+	}
 	if toks[1].TokType != token.FUNC_NAME {
 		panic(fmt.Sprintf("[ERROR] Could not figure out function name, got %v\n", toks[1]))
 	}
@@ -34,8 +37,8 @@ func (p *Parser) parseFuncDecStmt(toks []token.Token) *ast.FuncDecNode {
 		astParams = append(astParams, ast.ReferenceExprNode{Name: val.Literal})
 	}
 
-	if toks[i+1].TokType != token.LBRACE {
-		panic(fmt.Sprintf("[ERROR] Expected { after params, got %v", toks[i+1]))
+	if i+1 >= len(toks) || toks[i+1].TokType != token.LBRACE {
+		panic(fmt.Sprintf("[ERROR] Expected { after params, got %v", toks[i+1:]))
 	}
 
 	// find matching }
@@ -56,7 +59,9 @@ func (p *Parser) parseFuncDecStmt(toks []token.Token) *ast.FuncDecNode {
 	bodyTokens := toks[i+2 : j-1]
 	var body []ast.Node
 	for _, line := range p.splitIntoLines(bodyTokens) {
-		body = append(body, p.parseStmt(line))
+		if stmt := p.parseStmt(line); stmt != nil {
+			body = append(body, stmt)
+		}
 	}
 
 	return &ast.FuncDecNode{
@@ -70,8 +75,16 @@ func (p *Parser) parseReturnExpr(toks []token.Token) *ast.ReturnExprNode {
 	if toks[0].TokType != token.RETURN {
 		panic(fmt.Sprintf("[ERROR] Return statement must start with return, got %v\n", toks[0]))
 	}
+	// A bare return; has no value and returns null
+	val := toks[1:]
+	for len(val) > 0 && (val[len(val)-1].TokType == token.SEMICOLON || val[len(val)-1].TokType == token.RBRACE) {
+		val = val[:len(val)-1]
+	}
+	if len(val) == 0 {
+		return &ast.ReturnExprNode{}
+	}
 	return &ast.ReturnExprNode{
-		Val: p.parseStmt(toks[1:]),
+		Val: p.parseStmt(val),
 	}
 }
 
@@ -83,7 +96,7 @@ func (p *Parser) parseFuncCallStmt(toks []token.Token) *ast.FuncCallNode {
 		panic(fmt.Sprintf("[ERROR] Could not figure out function name, got %v\n", toks[0]))
 	}
 	if len(toks) < 2 || toks[1].TokType != token.LPAREN {
-		panic(fmt.Sprintf("[ERROR] Function name must be followed by \"(\", got %v\n", toks[1]))
+		panic(fmt.Sprintf("[ERROR] Function name must be followed by \"(\", got %v\n", toks[1:]))
 	}
 
 	funcName := toks[0].Literal
@@ -108,27 +121,7 @@ func (p *Parser) parseFuncCallStmt(toks []token.Token) *ast.FuncCallNode {
 	argTokens := toks[2:j]
 
 	// split args by top-level commas
-	var args [][]token.Token
-	curr := []token.Token{}
-	depth = 0
-	for _, tk := range argTokens {
-		if tk.TokType == token.LPAREN {
-			depth++
-		} else if tk.TokType == token.RPAREN {
-			depth--
-		}
-		if tk.TokType == token.COMMA && depth == 0 {
-			if len(curr) > 0 {
-				args = append(args, curr)
-				curr = []token.Token{}
-			}
-			continue
-		}
-		curr = append(curr, tk)
-	}
-	if len(curr) > 0 {
-		args = append(args, curr)
-	}
+	args := splitArgs(argTokens)
 
 	var params []ast.Node
 	for _, group := range args {
@@ -139,8 +132,11 @@ func (p *Parser) parseFuncCallStmt(toks []token.Token) *ast.FuncCallNode {
 		params = append(params, val)
 	}
 
-	return &ast.FuncCallNode{
+	call := &ast.FuncCallNode{
 		Name:   ast.ReferenceExprNode{Name: funcName},
 		Params: params,
 	}
+	setSpan(&call.Name, toks[:1])
+	setSpan(call, toks[:j+1])
+	return call
 }
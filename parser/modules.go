@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"fmt"
+	"toy_lang/ast"
+	"toy_lang/token"
+)
+
+// import "lib/math.toy" as m;
+func (p *Parser) parseImportStmt(toks []token.Token) *ast.ImportStmtNode {
+	if len(toks) != 4 || toks[1].TokType != token.STRING || toks[2].TokType != token.AS || toks[3].TokType != token.VAR_NAME {
+		panic(fmt.Sprintf("[ERROR] Import must look like import \"file.toy\" as name, got %v\n", toks))
+	}
+	return &ast.ImportStmtNode{
+		Path:  toks[1].Literal,
+		Alias: toks[3].Literal,
+	}
+}
+
+// export fn f(){...} or export const x = 1;
+func (p *Parser) parseExportStmt(toks []token.Token) *ast.ExportStmtNode {
+	if len(toks) < 2 || (toks[1].TokType != token.FN && toks[1].TokType != token.CONST) {
+		panic(fmt.Sprintf("[ERROR] Only functions and constants can be exported, got %v\n", toks))
+	}
+	return &ast.ExportStmtNode{
+		Stmt: p.parseStmt(toks[1:]),
+	}
+}
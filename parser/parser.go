@@ -11,6 +11,8 @@ type Parser struct {
 	program ast.ProgramNode
 	tokens  []token.Token
 	ifStack []*ast.IfStmtNode
+	// Span of the innermost statement being parsed, it is left in place when parsing panics
+	errSpan ast.Span
 }
 
 func NewParser() *Parser {
@@ -23,7 +25,8 @@ func NewParser() *Parser {
 	}
 }
 
-func (p *Parser) parseExpression(tokens []token.Token) ast.Node {
+func (p *Parser) parseExpression(tokens []token.Token) (node ast.Node) {
+	defer func() { setSpan(node, tokens) }()
 	if len(tokens) == 0 {
 		panic("[ERROR] Empty expression")
 	}
@@ -35,7 +38,11 @@ func (p *Parser) parseExpression(tokens []token.Token) ast.Node {
 	for i < len(tokens) {
 		tok := tokens[i]
 
-		if tok.TokType == token.VAR_REF && i+1 < len(tokens) && tokens[i+1].TokType == token.LPAREN {
+		if node, j := p.parseStructExpr(tokens, i); node != nil {
+			newTokens = append(newTokens, token.Token{TokType: token.EMPTY, Pos: tok.Pos})
+			subNodes = append(subNodes, &ast.EmptyExprNode{Child: node})
+			i = j
+		} else if tok.TokType == token.VAR_REF && i+1 < len(tokens) && tokens[i+1].TokType == token.LPAREN {
 			depth := 1
 			j := i + 2
 			for j < len(tokens) && depth > 0 {
@@ -50,10 +57,11 @@ func (p *Parser) parseExpression(tokens []token.Token) ast.Node {
 				panic("[ERROR] Mismatched parentheses in function call")
 			}
 
-			funcCall := p.parseFuncCallStmt(tokens[i:j])
+			var funcCall ast.Node = p.parseFuncCallStmt(tokens[i:j])
+			funcCall, j = p.parseFieldChain(funcCall, tokens, j)
 			emptyNode := &ast.EmptyExprNode{Child: funcCall}
 
-			newTokens = append(newTokens, *token.NewToken(token.EMPTY, ""))
+			newTokens = append(newTokens, token.Token{TokType: token.EMPTY, Pos: tok.Pos})
 			subNodes = append(subNodes, emptyNode)
 
 			i = j
@@ -73,9 +81,10 @@ func (p *Parser) parseExpression(tokens []token.Token) ast.Node {
 			}
 
 			sub := p.parseExpression(tokens[i+1 : j-1])
+			sub, j = p.parseFieldChain(sub, tokens, j)
 			emptyNode := &ast.EmptyExprNode{Child: sub}
 
-			newTokens = append(newTokens, *token.NewToken(token.EMPTY, ""))
+			newTokens = append(newTokens, token.Token{TokType: token.EMPTY, Pos: tok.Pos})
 			subNodes = append(subNodes, emptyNode)
 
 			i = j
@@ -116,7 +125,8 @@ func (p *Parser) parseExpression(tokens []token.Token) ast.Node {
 	return p.parseSubExpression(newTokens, subNodes)
 }
 
-func (p *Parser) parseSubExpression(tokens []token.Token, subNodes []*ast.EmptyExprNode) ast.Node {
+func (p *Parser) parseSubExpression(tokens []token.Token, subNodes []*ast.EmptyExprNode) (node ast.Node) {
+	defer func() { setSpan(node, tokens) }()
 	if len(tokens) == 0 {
 		panic("[ERROR] Empty expression")
 	}
@@ -138,6 +148,8 @@ func (p *Parser) parseSubExpression(tokens []token.Token, subNodes []*ast.EmptyE
 			return &ast.BoolLiteralNode{Value: val}
 		case token.STRING:
 			return &ast.StringLiteralNode{Value: tok.Literal}
+		case token.NULL:
+			return &ast.NullLiteralNode{}
 		case token.FLOAT:
 			val, err := strconv.ParseFloat(tok.Literal, 64)
 			if err != nil {
@@ -160,7 +172,7 @@ func (p *Parser) parseSubExpression(tokens []token.Token, subNodes []*ast.EmptyE
 			panic(fmt.Sprintf("[ERROR] Unexpected single token: %+v", tok))
 		}
 	}
-	hasOperator, _ := includesAny(tokens, []token.TokenType{
+	hasOperator, _ := includesAnyTopLevel(tokens, []token.TokenType{
 		token.PLUS,
 		token.MINUS,
 		token.MULTIPLY,
@@ -176,6 +188,7 @@ func (p *Parser) parseSubExpression(tokens []token.Token, subNodes []*ast.EmptyE
 		token.AND,
 		token.OR,
 		token.NOT,
+		token.NEG,
 	})
 	if tokens[0].TokType == token.VAR_REF && tokens[1].TokType == token.LBRACK && !hasOperator {
 		arr := p.parseArrRef(tokens)
@@ -225,7 +238,7 @@ func (p *Parser) parseSubExpression(tokens []token.Token, subNodes []*ast.EmptyE
 	case token.AND, token.OR,
 		token.LESS_THAN, token.LESS_THAN_EQT,
 		token.GREATER_THAN, token.GREATER_THAN_EQT,
-		token.EQUALS:
+		token.EQUALS, token.NOT_EQUAL:
 		leftSubNodes := sliceSubNodes(0, lowestIndex)
 		rightSubNodes := sliceSubNodes(lowestIndex+1, len(tokens))
 
@@ -236,6 +249,14 @@ func (p *Parser) parseSubExpression(tokens []token.Token, subNodes []*ast.EmptyE
 			Operator: lowestTok.TokType,
 			Right:    right,
 		}
+	case token.NEG:
+		rightSubNodes := sliceSubNodes(lowestIndex+1, len(tokens))
+		right := p.parseSubExpression(tokens[lowestIndex+1:], rightSubNodes)
+		return &ast.InfixExprNode{
+			Left:     &ast.IntLiteralNode{Value: 0},
+			Operator: token.MINUS,
+			Right:    right,
+		}
 	case token.NOT:
 		rightSubNodes := sliceSubNodes(lowestIndex+1, len(tokens))
 		right := p.parseSubExpression(tokens[lowestIndex+1:], rightSubNodes)
@@ -258,9 +279,12 @@ func (p *Parser) parseSubExpression(tokens []token.Token, subNodes []*ast.EmptyE
 }
 
 func (p *Parser) parseLetStmt(toks []token.Token) *ast.LetStmtNode {
-	if toks[0].TokType != token.LET {
+	if toks[0].TokType != token.LET && toks[0].TokType != token.CONST {
 		panic(fmt.Sprintf("[ERROR] Let statement is required to initialize variable, got %v\n", toks[0]))
 	}
+	if len(toks) < 4 {
+		panic(fmt.Sprintf("[ERROR] Declaration needs a name and a value, got %v\n", toks))
+	}
 	if toks[1].TokType != token.VAR_NAME {
 		panic(fmt.Sprintf("[ERROR] Could not figure out what to name variable, got %v\n", toks[1]))
 	}
@@ -272,6 +296,7 @@ func (p *Parser) parseLetStmt(toks []token.Token) *ast.LetStmtNode {
 	return &ast.LetStmtNode{
 		Name:  name,
 		Value: val,
+		Const: toks[0].TokType == token.CONST,
 	}
 }
 
@@ -304,18 +329,9 @@ func (p *Parser) parseIfStmt(toks []token.Token) *ast.IfStmtNode {
 		panic(fmt.Sprintf("[ERROR] Expected \"IF\" got %v\n", toks[0]))
 	}
 
-	var condToks []token.Token
-	condLen := 0
-	for i, val := range toks[1:] {
-		if val.TokType != token.LBRACE {
-			condToks = append(condToks, val)
-		} else {
-			condLen = i
-			break
-		}
-	}
-	cond := p.parseExpression(condToks)
-	body := p.splitIntoLines(toks[condLen+2 : len(toks)-1])
+	condToks, bodyToks := splitBlock(toks)
+	cond := p.parseCondition(condToks)
+	body := p.splitIntoLines(bodyToks)
 	var parsedStmts []ast.Node
 	for _, val := range body {
 		n := p.parseStmt(val)
@@ -323,53 +339,9 @@ func (p *Parser) parseIfStmt(toks []token.Token) *ast.IfStmtNode {
 			parsedStmts = append(parsedStmts, n)
 		}
 	}
-	var toReturn *ast.IfStmtNode
-	if cond.NodeType() == ast.BoolLiteral {
-		boolCond, ok := cond.(*ast.BoolLiteralNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not figure out conditional, got %+v\n", cond))
-		}
-		toReturn = &ast.IfStmtNode{
-			Cond: boolCond,
-			Body: parsedStmts,
-		}
-	}
-	if cond.NodeType() == ast.BoolInfix {
-		boolCond, ok := cond.(*ast.BoolInfixNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not figure out conditional, got %v\n", cond))
-		}
-		toReturn = &ast.IfStmtNode{
-			Cond: boolCond,
-			Body: parsedStmts,
-		}
-	}
-	if cond.NodeType() == ast.ReferenceExpr {
-		refExpr, ok := cond.(*ast.ReferenceExprNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not figure out conditional, got %v\n", cond))
-		}
-		toReturn = &ast.IfStmtNode{
-			Cond: &ast.BoolInfixNode{
-				Left:     refExpr,
-				Operator: token.OR,
-				Right:    &ast.BoolLiteralNode{Value: false},
-			},
-			Body: parsedStmts,
-		}
-	}
-	if cond.NodeType() == ast.PrefixExpr {
-		prefixExpr, ok := cond.(*ast.PrefixExprNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not figure out conditional, got %v\n", cond))
-		}
-		toReturn = &ast.IfStmtNode{
-			Cond: prefixExpr,
-			Body: parsedStmts,
-		}
-	}
-	if toReturn == nil {
-		panic(fmt.Sprintf("[ERROR] Could not parse if statement, tokens are %+v, cond types are %v\n", toks, cond.NodeType()))
+	toReturn := &ast.IfStmtNode{
+		Cond: cond,
+		Body: parsedStmts,
 	}
 	p.ifStack = append(p.ifStack, toReturn)
 	return toReturn
@@ -379,18 +351,9 @@ func (p *Parser) parseWhileStmt(toks []token.Token) *ast.WhileStmtNode {
 	if toks[0].TokType != token.WHILE {
 		panic(fmt.Sprintf("[ERROR] Expected \"WHILE\" got %v\n", toks[0]))
 	}
-	var condToks []token.Token
-	condLen := 0
-	for i, val := range toks[1:] {
-		if val.TokType != token.LBRACE {
-			condToks = append(condToks, val)
-		} else {
-			condLen = i
-			break
-		}
-	}
-	cond := p.parseExpression(condToks)
-	body := p.splitIntoLines(toks[condLen+2 : len(toks)-1])
+	condToks, bodyToks := splitBlock(toks)
+	cond := p.parseCondition(condToks)
+	body := p.splitIntoLines(bodyToks)
 	var parsedStmts []ast.Node
 	for _, val := range body {
 		n := p.parseStmt(val)
@@ -398,51 +361,45 @@ func (p *Parser) parseWhileStmt(toks []token.Token) *ast.WhileStmtNode {
 			parsedStmts = append(parsedStmts, n)
 		}
 	}
-	if cond.NodeType() == ast.BoolLiteral {
-		boolCond, ok := cond.(*ast.BoolLiteralNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not figure out conditional, got %+v\n", cond))
-		}
-		return &ast.WhileStmtNode{
-			Cond: boolCond,
-			Body: parsedStmts,
-		}
+	return &ast.WhileStmtNode{
+		Cond: cond,
+		Body: parsedStmts,
 	}
-	if cond.NodeType() == ast.BoolInfix {
-		boolCond, ok := cond.(*ast.BoolInfixNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not figure out conditional, got %v\n", cond))
-		}
-		return &ast.WhileStmtNode{
-			Cond: boolCond,
-			Body: parsedStmts,
+}
+
+// Splits if and while statements into the condition and the tokens between the braces
+func splitBlock(toks []token.Token) ([]token.Token, []token.Token) {
+	for i, val := range toks {
+		if val.TokType == token.LBRACE {
+			if toks[len(toks)-1].TokType != token.RBRACE {
+				panic(fmt.Sprintf("[ERROR] Expected } at the end of %v", toks[0].Literal))
+			}
+			return toks[1:i], toks[i+1 : len(toks)-1]
 		}
 	}
-	if cond.NodeType() == ast.ReferenceExpr {
-		refExpr, ok := cond.(*ast.ReferenceExprNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not figure out conditional, got %v\n", cond))
-		}
-		return &ast.WhileStmtNode{
-			Cond: &ast.BoolInfixNode{
-				Left:     refExpr,
-				Operator: token.OR,
-				Right:    &ast.BoolLiteralNode{Value: false},
-			},
-			Body: parsedStmts,
-		}
+	panic(fmt.Sprintf("[ERROR] Expected { after the condition of %v", toks[0].Literal))
+}
+
+// Conditions that are not already boolean expressions are wrapped as (cond || false) so the evaluator
+// applies truthiness to them
+func (p *Parser) parseCondition(condToks []token.Token) ast.Bool {
+	if len(condToks) == 0 {
+		panic("[ERROR] Missing condition")
 	}
-	if cond.NodeType() == ast.PrefixExpr {
-		prefixExpr, ok := cond.(*ast.PrefixExprNode)
-		if !ok {
-			panic(fmt.Sprintf("[ERROR] Could not figure out conditional, got %v\n", cond))
-		}
-		return &ast.WhileStmtNode{
-			Cond: prefixExpr,
-			Body: parsedStmts,
-		}
+	cond := p.parseExpression(condToks)
+	switch c := cond.(type) {
+	case *ast.BoolLiteralNode:
+		return c
+	case *ast.BoolInfixNode:
+		return c
+	case *ast.PrefixExprNode:
+		return c
+	}
+	return &ast.BoolInfixNode{
+		Left:     cond,
+		Operator: token.OR,
+		Right:    &ast.BoolLiteralNode{Value: false},
 	}
-	panic(fmt.Sprintf("[ERROR] Could not parse while statement, tokens are %+v\n, cond types are %v\n", toks, cond.NodeType()))
 }
 
 func (p *Parser) parseElseStmt(toks []token.Token) {
@@ -470,10 +427,23 @@ func (p *Parser) parseElseStmt(toks []token.Token) {
 	lastIfIndex := len(p.ifStack) - 1
 	lastIf := p.ifStack[lastIfIndex]
 	lastIf.Alt = stmts
+	lastIf.Else = toks[0].Pos
+	lastIf.End = toks[len(toks)-1].Pos
 	p.ifStack = p.ifStack[:lastIfIndex]
 }
 
-func (p *Parser) parseStmt(line []token.Token) ast.Node {
+func (p *Parser) parseStmt(line []token.Token) (node ast.Node) {
+	outer := p.errSpan
+	if span := tokenSpan(line); span.Start.Line != 0 {
+		p.errSpan = span
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panic(r)
+		}
+		p.errSpan = outer
+		setSpan(node, line)
+	}()
 	if len(line) == 0 {
 		return nil
 	}
@@ -495,15 +465,34 @@ func (p *Parser) parseStmt(line []token.Token) ast.Node {
 		if firstTok.TokType == token.BREAK {
 			return &ast.BreakStmtNode{}
 		}
+		if firstTok.TokType == token.RETURN {
+			return p.parseReturnExpr(line)
+		}
 		return p.parseExpression(line)
 	}
 
-	if firstTok.TokType == token.LET {
+	if firstTok.TokType == token.LET || firstTok.TokType == token.CONST {
 		return p.parseLetStmt(line)
 	}
 	if firstTok.TokType == token.VAR_REF && secondTok.TokType == token.ASSIGN {
 		return p.parseVarReassign(line)
 	}
+	if firstTok.TokType == token.VAR_REF {
+		if hasAssign, assignIdx := includesAnyTopLevel(line, []token.TokenType{token.ASSIGN}); hasAssign {
+			if hasDot, _ := includesAnyTopLevel(line[:assignIdx], []token.TokenType{token.DOT}); hasDot {
+				return p.parseFieldReassign(line, assignIdx)
+			}
+		}
+	}
+	if firstTok.TokType == token.STRUCT {
+		return p.parseStructDec(line)
+	}
+	if firstTok.TokType == token.IMPORT {
+		return p.parseImportStmt(line)
+	}
+	if firstTok.TokType == token.EXPORT {
+		return p.parseExportStmt(line)
+	}
 	if firstTok.TokType == token.IF {
 		return p.parseIfStmt(line)
 	}
@@ -526,9 +515,18 @@ func (p *Parser) parseStmt(line []token.Token) ast.Node {
 	if firstTok.TokType == token.BREAK {
 		return &ast.BreakStmtNode{}
 	}
+	if opIdx := findCompoundOperator(line); opIdx != -1 {
+		return p.parseCompoundAssign(line, opIdx)
+	}
 	return p.parseExpression(line)
 }
 
+// ErrorSpan returns the span of the statement Parse was working on when it panicked, it is the zero Span if the
+// error came before any statement was reached
+func (p *Parser) ErrorSpan() ast.Span {
+	return p.errSpan
+}
+
 func (p *Parser) Parse(tokens []token.Token) ast.ProgramNode {
 	var tokGroups [][]token.Token = p.splitIntoLines(p.preProcess(tokens))
 	for _, line := range tokGroups {
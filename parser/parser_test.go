@@ -2,6 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"toy_lang/ast"
 	"toy_lang/lexer"
@@ -30,7 +33,7 @@ func deepCompare(got, want ast.Node) bool {
 	if want.NodeType() == ast.VarReassign && got.NodeType() == ast.VarReassign {
 		w := want.(*ast.VarReassignNode)
 		g := got.(*ast.VarReassignNode)
-		namesTrue := w.Var == g.Var
+		namesTrue := w.Var.Name == g.Var.Name
 		valsTrue := deepCompare(g.NewVal, w.NewVal)
 		return namesTrue && valsTrue
 	}
@@ -155,7 +158,7 @@ func deepCompare(got, want ast.Node) bool {
 		w := want.(*ast.FuncCallNode)
 		g := got.(*ast.FuncCallNode)
 
-		nameEq := w.Name == g.Name
+		nameEq := w.Name.Name == g.Name.Name
 		paramsEq := true
 
 		for i := range w.Params {
@@ -234,6 +237,86 @@ func deepCompare(got, want ast.Node) bool {
 
 	}
 
+	if want.NodeType() == ast.CompoundAssign && got.NodeType() == ast.CompoundAssign {
+		gotC := got.(*ast.CompoundAssignNode)
+		wantC := want.(*ast.CompoundAssignNode)
+
+		targetEq := deepCompare(gotC.Target, wantC.Target)
+		oppEq := gotC.Operator == wantC.Operator
+		valEq := deepCompare(gotC.Value, wantC.Value)
+		return targetEq && oppEq && valEq
+	}
+
+	if want.NodeType() == ast.NullLiteral && got.NodeType() == ast.NullLiteral {
+		return true
+	}
+
+	if want.NodeType() == ast.StructDec && got.NodeType() == ast.StructDec {
+		w := want.(*ast.StructDecNode)
+		g := got.(*ast.StructDecNode)
+		if w.Name != g.Name || fmt.Sprint(w.Fields) != fmt.Sprint(g.Fields) || len(w.Methods) != len(g.Methods) {
+			return false
+		}
+		for i := range w.Methods {
+			if !deepCompare(&g.Methods[i], &w.Methods[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if want.NodeType() == ast.StructLiteral && got.NodeType() == ast.StructLiteral {
+		w := want.(*ast.StructLiteralNode)
+		g := got.(*ast.StructLiteralNode)
+		if w.Name != g.Name || len(w.Fields) != len(g.Fields) {
+			return false
+		}
+		for i := range w.Fields {
+			if w.Fields[i].Name != g.Fields[i].Name || !deepCompare(g.Fields[i].Value, w.Fields[i].Value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if want.NodeType() == ast.FieldAccess && got.NodeType() == ast.FieldAccess {
+		w := want.(*ast.FieldAccessNode)
+		g := got.(*ast.FieldAccessNode)
+		return w.Field == g.Field && deepCompare(g.Obj, w.Obj)
+	}
+
+	if want.NodeType() == ast.FieldReassign && got.NodeType() == ast.FieldReassign {
+		w := want.(*ast.FieldReassignNode)
+		g := got.(*ast.FieldReassignNode)
+		return w.Field == g.Field && deepCompare(g.Obj, w.Obj) && deepCompare(g.NewVal, w.NewVal)
+	}
+
+	if want.NodeType() == ast.MethodCall && got.NodeType() == ast.MethodCall {
+		w := want.(*ast.MethodCallNode)
+		g := got.(*ast.MethodCallNode)
+		if w.Name != g.Name || len(w.Params) != len(g.Params) || !deepCompare(g.Obj, w.Obj) {
+			return false
+		}
+		for i := range w.Params {
+			if !deepCompare(g.Params[i], w.Params[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if want.NodeType() == ast.ImportStmt && got.NodeType() == ast.ImportStmt {
+		w := want.(*ast.ImportStmtNode)
+		g := got.(*ast.ImportStmtNode)
+		return w.Path == g.Path && w.Alias == g.Alias
+	}
+
+	if want.NodeType() == ast.ExportStmt && got.NodeType() == ast.ExportStmt {
+		w := want.(*ast.ExportStmtNode)
+		g := got.(*ast.ExportStmtNode)
+		return deepCompare(g.Stmt, w.Stmt)
+	}
+
 	fmt.Printf("[WARNING] HEY MORON!!!!! USING UNDEFINED TYPES IN TETS, got %v, want %v\n", got.NodeType(), want.NodeType())
 	return got.String() == want.String()
 }
@@ -298,7 +381,7 @@ func compareTokens(t *testing.T, got, want []token.Token) {
 	}
 
 	for i := 0; i < minLen; i++ {
-		if got[i] != want[i] {
+		if got[i].TokType != want[i].TokType || got[i].Literal != want[i].Literal {
 			t.Errorf("Mismatch at index %d: got %+v, want %+v", i, got[i], want[i])
 		}
 	}
@@ -331,9 +414,7 @@ func TestPreParser(t *testing.T) {
 				*token.NewToken(token.INTEGER, "5"),
 				*token.NewToken(token.SEMICOLON, ";"),
 				*token.NewToken(token.VAR_REF, "x"),
-				*token.NewToken(token.ASSIGN, "="),
-				*token.NewToken(token.VAR_REF, "x"),
-				*token.NewToken(token.PLUS, "+"),
+				*token.NewToken(token.COMPOUND_PLUS, "+="),
 				*token.NewToken(token.INTEGER, "1"),
 				*token.NewToken(token.SEMICOLON, ";"),
 			},
@@ -353,9 +434,7 @@ func TestPreParser(t *testing.T) {
 				*token.NewToken(token.INTEGER, "3"),
 				*token.NewToken(token.SEMICOLON, ";"),
 				*token.NewToken(token.VAR_REF, "a"),
-				*token.NewToken(token.ASSIGN, "="),
-				*token.NewToken(token.VAR_REF, "a"),
-				*token.NewToken(token.PLUS, "+"),
+				*token.NewToken(token.COMPOUND_PLUS, "+="),
 				*token.NewToken(token.VAR_REF, "b"),
 				*token.NewToken(token.SEMICOLON, ";"),
 			},
@@ -370,9 +449,7 @@ func TestPreParser(t *testing.T) {
 				*token.NewToken(token.INTEGER, "10"),
 				*token.NewToken(token.SEMICOLON, ";"),
 				*token.NewToken(token.VAR_REF, "x"),
-				*token.NewToken(token.ASSIGN, "="),
-				*token.NewToken(token.VAR_REF, "x"),
-				*token.NewToken(token.MINUS, "-"),
+				*token.NewToken(token.COMPOUND_MINUS, "-="),
 				*token.NewToken(token.VAR_REF, "x"),
 				*token.NewToken(token.SEMICOLON, ";"),
 			},
@@ -386,15 +463,11 @@ func TestPreParser(t *testing.T) {
 				*token.NewToken(token.INTEGER, "1"),
 				*token.NewToken(token.SEMICOLON, ";"),
 				*token.NewToken(token.VAR_REF, "x"),
-				*token.NewToken(token.ASSIGN, "="),
-				*token.NewToken(token.VAR_REF, "x"),
-				*token.NewToken(token.MULTIPLY, "*"),
+				*token.NewToken(token.COMPOUND_MULTIPLY, "*="),
 				*token.NewToken(token.INTEGER, "2"),
 				*token.NewToken(token.SEMICOLON, ";"),
 				*token.NewToken(token.VAR_REF, "x"),
-				*token.NewToken(token.ASSIGN, "="),
-				*token.NewToken(token.VAR_REF, "x"),
-				*token.NewToken(token.DIVIDE, "/"),
+				*token.NewToken(token.COMPOUND_DIVIDE, "/="),
 				*token.NewToken(token.VAR_REF, "x"),
 				*token.NewToken(token.SEMICOLON, ";"),
 			},
@@ -405,8 +478,7 @@ func TestPreParser(t *testing.T) {
 				*token.NewToken(token.LET, "let"),
 				*token.NewToken(token.VAR_NAME, "y"),
 				*token.NewToken(token.ASSIGN, "="),
-				*token.NewToken(token.INTEGER, "0"),
-				*token.NewToken(token.MINUS, "-"),
+				*token.NewToken(token.NEG, "-"),
 				*token.NewToken(token.INTEGER, "4"),
 				*token.NewToken(token.SEMICOLON, ";"),
 			},
@@ -420,8 +492,7 @@ func TestPreParser(t *testing.T) {
 				*token.NewToken(token.INTEGER, "5"),
 				*token.NewToken(token.PLUS, "+"),
 				*token.NewToken(token.LPAREN, "("),
-				*token.NewToken(token.INTEGER, "0"),
-				*token.NewToken(token.MINUS, "-"),
+				*token.NewToken(token.NEG, "-"),
 				*token.NewToken(token.INTEGER, "4"),
 				*token.NewToken(token.PLUS, "+"),
 				*token.NewToken(token.INTEGER, "1"),
@@ -437,15 +508,70 @@ func TestPreParser(t *testing.T) {
 	}
 }
 
+// Operators of the same level group left to right except **, a minus with nothing before it is unary
+func TestOperators(t *testing.T) {
+	infix := func(left ast.Node, op token.TokenType, right ast.Node) *ast.InfixExprNode {
+		return &ast.InfixExprNode{Left: left, Operator: op, Right: right}
+	}
+	num := func(n int) *ast.IntLiteralNode { return &ast.IntLiteralNode{Value: n} }
+	ref := func(name string) *ast.ReferenceExprNode { return &ast.ReferenceExprNode{Name: name} }
+	let := func(value ast.Node) ast.ProgramNode {
+		return ast.ProgramNode{Statements: []ast.Node{&ast.LetStmtNode{Name: "x", Value: value}}}
+	}
+
+	tests := []ttype{
+		{
+			input:  "let x = 10 - 3 - 2;",
+			output: let(infix(infix(num(10), token.MINUS, num(3)), token.MINUS, num(2))),
+			id:     1,
+		},
+		{
+			input:  "let x = 8 / 4 * 2 % 3;",
+			output: let(infix(infix(infix(num(8), token.DIVIDE, num(4)), token.MULTIPLY, num(2)), token.MODULO, num(3))),
+			id:     2,
+		},
+		{
+			input:  "let x = 2 ** 3 ** 2;",
+			output: let(infix(num(2), token.EXPONENT, infix(num(3), token.EXPONENT, num(2)))),
+			id:     3,
+		},
+		{
+			input:  "let x = a * -b;",
+			output: let(infix(ref("a"), token.MULTIPLY, infix(num(0), token.MINUS, ref("b")))),
+			id:     4,
+		},
+		{
+			input:  "let x = 2 - -3;",
+			output: let(infix(num(2), token.MINUS, infix(num(0), token.MINUS, num(3)))),
+			id:     5,
+		},
+		{
+			input:  "let x = -2 ** 2;",
+			output: let(infix(num(0), token.MINUS, infix(num(2), token.EXPONENT, num(2)))),
+			id:     6,
+		},
+		{
+			input:  "let x = 1.5 - 0.5;",
+			output: let(infix(&ast.FloatLiteralNode{Value: 1.5}, token.MINUS, &ast.FloatLiteralNode{Value: 0.5})),
+			id:     7,
+		},
+	}
+
+	for _, tt := range tests {
+		prog := NewParser().Parse(lexer.NewLexer().Lex(tt.input))
+		compareNodes(t, prog.Statements, tt.output.Statements, tt)
+	}
+}
+
 type ttype struct {
 	input  string
 	output ast.ProgramNode
 	id     int
 }
 
-func TestParser(t *testing.T) {
-
-	tests := []ttype{
+// The TestParser cases, FuzzParse starts from their inputs
+func parserTests() []ttype {
+	return []ttype{
 		{
 			input: "let x = 4;",
 			output: ast.ProgramNode{
@@ -717,13 +843,10 @@ func TestParser(t *testing.T) {
 							&ast.IfStmtNode{
 								Cond: &ast.BoolLiteralNode{Value: false},
 								Body: []ast.Node{
-									&ast.VarReassignNode{
-										Var: ast.ReferenceExprNode{Name: "x"},
-										NewVal: &ast.InfixExprNode{
-											Left:     &ast.ReferenceExprNode{Name: "x"},
-											Operator: token.PLUS,
-											Right:    &ast.IntLiteralNode{Value: 5},
-										},
+									&ast.CompoundAssignNode{
+										Target:   &ast.ReferenceExprNode{Name: "x"},
+										Operator: token.PLUS,
+										Value:    &ast.IntLiteralNode{Value: 5},
 									},
 								},
 							},
@@ -1247,13 +1370,10 @@ func TestParser(t *testing.T) {
 							Right:    &ast.IntLiteralNode{Value: 4},
 						},
 						Body: []ast.Node{
-							&ast.VarReassignNode{
-								Var: ast.ReferenceExprNode{Name: "x"},
-								NewVal: &ast.InfixExprNode{
-									Left:     &ast.ReferenceExprNode{Name: "x"},
-									Operator: token.PLUS,
-									Right:    &ast.IntLiteralNode{Value: 1},
-								},
+							&ast.CompoundAssignNode{
+								Target:   &ast.ReferenceExprNode{Name: "x"},
+								Operator: token.PLUS,
+								Value:    &ast.IntLiteralNode{Value: 1},
 							},
 						},
 					},
@@ -1556,13 +1676,10 @@ if arr[0] == 0{
 									Right: &ast.IntLiteralNode{Value: 2},
 								},
 							},
-							&ast.VarReassignNode{
-								Var: ast.ReferenceExprNode{Name: "n"},
-								NewVal: &ast.InfixExprNode{
-									Left: &ast.ReferenceExprNode{Name: "n"},
-									Operator: token.PLUS,
-									Right: &ast.IntLiteralNode{Value: 1},
-								},
+							&ast.CompoundAssignNode{
+								Target:   &ast.ReferenceExprNode{Name: "n"},
+								Operator: token.PLUS,
+								Value:    &ast.IntLiteralNode{Value: 1},
 							},
 						},
 					},
@@ -1592,9 +1709,251 @@ if arr[0] == 0{
 			},
 			id: 41,
 		},
+		{
+			input: "let arr = [1, 2]; arr[1] += 3; let x = 7; x %= 3; x **= 2; x--;",
+			output: ast.ProgramNode{
+				Statements: []ast.Node{
+					&ast.LetStmtNode{
+						Name: "arr",
+						Value: &ast.ArrLiteralNode{
+							Elems: map[string]ast.Node{
+								(&ast.IntLiteralNode{Value: 0}).String(): &ast.IntLiteralNode{Value: 1},
+								(&ast.IntLiteralNode{Value: 1}).String(): &ast.IntLiteralNode{Value: 2},
+							},
+						},
+					},
+					&ast.CompoundAssignNode{
+						Target: &ast.ArrRefNode{
+							Arr: ast.ReferenceExprNode{Name: "arr"},
+							Idx: &ast.IntLiteralNode{Value: 1},
+						},
+						Operator: token.PLUS,
+						Value:    &ast.IntLiteralNode{Value: 3},
+					},
+					&ast.LetStmtNode{
+						Name:  "x",
+						Value: &ast.IntLiteralNode{Value: 7},
+					},
+					&ast.CompoundAssignNode{
+						Target:   &ast.ReferenceExprNode{Name: "x"},
+						Operator: token.MODULO,
+						Value:    &ast.IntLiteralNode{Value: 3},
+					},
+					&ast.CompoundAssignNode{
+						Target:   &ast.ReferenceExprNode{Name: "x"},
+						Operator: token.EXPONENT,
+						Value:    &ast.IntLiteralNode{Value: 2},
+					},
+					&ast.CompoundAssignNode{
+						Target:   &ast.ReferenceExprNode{Name: "x"},
+						Operator: token.MINUS,
+						Value:    &ast.IntLiteralNode{Value: 1},
+					},
+				},
+			},
+			id: 42,
+		},
+		{
+			input: "let x = null; if x != null{x = 1;}",
+			output: ast.ProgramNode{
+				Statements: []ast.Node{
+					&ast.LetStmtNode{
+						Name:  "x",
+						Value: &ast.NullLiteralNode{},
+					},
+					&ast.IfStmtNode{
+						Cond: &ast.BoolInfixNode{
+							Left:     &ast.ReferenceExprNode{Name: "x"},
+							Operator: token.NOT_EQUAL,
+							Right:    &ast.NullLiteralNode{},
+						},
+						Body: []ast.Node{
+							&ast.VarReassignNode{
+								Var:    ast.ReferenceExprNode{Name: "x"},
+								NewVal: &ast.IntLiteralNode{Value: 1},
+							},
+						},
+					},
+				},
+			},
+			id: 43,
+		},
+		{
+			input: "let ok = x != 0 && 10 / x > 1; while n{n--;}",
+			output: ast.ProgramNode{
+				Statements: []ast.Node{
+					&ast.LetStmtNode{
+						Name: "ok",
+						Value: &ast.BoolInfixNode{
+							Left: &ast.BoolInfixNode{
+								Left:     &ast.ReferenceExprNode{Name: "x"},
+								Operator: token.NOT_EQUAL,
+								Right:    &ast.IntLiteralNode{Value: 0},
+							},
+							Operator: token.AND,
+							Right: &ast.BoolInfixNode{
+								Left: &ast.InfixExprNode{
+									Left:     &ast.IntLiteralNode{Value: 10},
+									Operator: token.DIVIDE,
+									Right:    &ast.ReferenceExprNode{Name: "x"},
+								},
+								Operator: token.GREATER_THAN,
+								Right:    &ast.IntLiteralNode{Value: 1},
+							},
+						},
+					},
+					&ast.WhileStmtNode{
+						Cond: &ast.BoolInfixNode{
+							Left:     &ast.ReferenceExprNode{Name: "n"},
+							Operator: token.OR,
+							Right:    &ast.BoolLiteralNode{Value: false},
+						},
+						Body: []ast.Node{
+							&ast.CompoundAssignNode{
+								Target:   &ast.ReferenceExprNode{Name: "n"},
+								Operator: token.MINUS,
+								Value:    &ast.IntLiteralNode{Value: 1},
+							},
+						},
+					},
+				},
+			},
+			id: 44,
+		},
+		{
+			input: "struct Point { x, y fn sum(){ return self.x + self.y; } } let p = Point{x: 1, y: 2}; p.x = 3; p.y += 1; let s = p.sum();",
+			output: ast.ProgramNode{
+				Statements: []ast.Node{
+					&ast.StructDecNode{
+						Name:   "Point",
+						Fields: []string{"x", "y"},
+						Methods: []ast.FuncDecNode{
+							{
+								Name: "sum",
+								Body: []ast.Node{
+									&ast.ReturnExprNode{
+										Val: &ast.InfixExprNode{
+											Left:     &ast.FieldAccessNode{Obj: &ast.ReferenceExprNode{Name: "self"}, Field: "x"},
+											Operator: token.PLUS,
+											Right:    &ast.FieldAccessNode{Obj: &ast.ReferenceExprNode{Name: "self"}, Field: "y"},
+										},
+									},
+								},
+							},
+						},
+					},
+					&ast.LetStmtNode{
+						Name: "p",
+						Value: &ast.StructLiteralNode{
+							Name: "Point",
+							Fields: []ast.StructField{
+								{Name: "x", Value: &ast.IntLiteralNode{Value: 1}},
+								{Name: "y", Value: &ast.IntLiteralNode{Value: 2}},
+							},
+						},
+					},
+					&ast.FieldReassignNode{
+						Obj:    &ast.ReferenceExprNode{Name: "p"},
+						Field:  "x",
+						NewVal: &ast.IntLiteralNode{Value: 3},
+					},
+					&ast.CompoundAssignNode{
+						Target:   &ast.FieldAccessNode{Obj: &ast.ReferenceExprNode{Name: "p"}, Field: "y"},
+						Operator: token.PLUS,
+						Value:    &ast.IntLiteralNode{Value: 1},
+					},
+					&ast.LetStmtNode{
+						Name:  "s",
+						Value: &ast.MethodCallNode{Obj: &ast.ReferenceExprNode{Name: "p"}, Name: "sum"},
+					},
+				},
+			},
+			id: 45,
+		},
+		{
+			input: "let l = Line{a: Point{x: 1, y: 2}, b: Point{}}; pts[0].x = l.a.x - 1;",
+			output: ast.ProgramNode{
+				Statements: []ast.Node{
+					&ast.LetStmtNode{
+						Name: "l",
+						Value: &ast.StructLiteralNode{
+							Name: "Line",
+							Fields: []ast.StructField{
+								{Name: "a", Value: &ast.StructLiteralNode{
+									Name: "Point",
+									Fields: []ast.StructField{
+										{Name: "x", Value: &ast.IntLiteralNode{Value: 1}},
+										{Name: "y", Value: &ast.IntLiteralNode{Value: 2}},
+									},
+								}},
+								{Name: "b", Value: &ast.StructLiteralNode{Name: "Point", Fields: []ast.StructField{}}},
+							},
+						},
+					},
+					&ast.FieldReassignNode{
+						Obj: &ast.ArrRefNode{
+							Arr: ast.ReferenceExprNode{Name: "pts"},
+							Idx: &ast.IntLiteralNode{Value: 0},
+						},
+						Field: "x",
+						NewVal: &ast.InfixExprNode{
+							Left: &ast.FieldAccessNode{
+								Obj:   &ast.FieldAccessNode{Obj: &ast.ReferenceExprNode{Name: "l"}, Field: "a"},
+								Field: "x",
+							},
+							Operator: token.MINUS,
+							Right:    &ast.IntLiteralNode{Value: 1},
+						},
+					},
+				},
+			},
+			id: 46,
+		},
+		{
+			input: "import \"lib/math.toy\" as m; export const PI = 3; export fn f(){ return m.sq(PI); } let x = m.PI;",
+			output: ast.ProgramNode{
+				Statements: []ast.Node{
+					&ast.ImportStmtNode{Path: "lib/math.toy", Alias: "m"},
+					&ast.ExportStmtNode{
+						Stmt: &ast.LetStmtNode{Name: "PI", Value: &ast.IntLiteralNode{Value: 3}, Const: true},
+					},
+					&ast.ExportStmtNode{
+						Stmt: &ast.FuncDecNode{
+							Name: "f",
+							Body: []ast.Node{
+								&ast.ReturnExprNode{
+									Val: &ast.MethodCallNode{
+										Obj:    &ast.ReferenceExprNode{Name: "m"},
+										Name:   "sq",
+										Params: []ast.Node{&ast.ReferenceExprNode{Name: "PI"}},
+									},
+								},
+							},
+						},
+					},
+					&ast.LetStmtNode{
+						Name:  "x",
+						Value: &ast.FieldAccessNode{Obj: &ast.ReferenceExprNode{Name: "m"}, Field: "PI"},
+					},
+				},
+			},
+			id: 47,
+		},
+		{
+			input: "fn f(){ return; } fn g(){ return }",
+			output: ast.ProgramNode{
+				Statements: []ast.Node{
+					&ast.FuncDecNode{Name: "f", Body: []ast.Node{&ast.ReturnExprNode{}}},
+					&ast.FuncDecNode{Name: "g", Body: []ast.Node{&ast.ReturnExprNode{}}},
+				},
+			},
+			id: 48,
+		},
 	}
+}
 
-	for _, tt := range tests {
+func TestParser(t *testing.T) {
+	for _, tt := range parserTests() {
 		lex := lexer.NewLexer()
 		parse := NewParser()
 		toks := lex.Lex(tt.input)
@@ -1602,3 +1961,27 @@ if arr[0] == 0{
 		compareNodes(t, prog.Statements, tt.output.Statements, tt)
 	}
 }
+
+// Seeds are the TestParser inputs and the programs in test_programs, run with go test ./parser -fuzz FuzzParse
+func FuzzParse(f *testing.F) {
+	for _, tt := range parserTests() {
+		f.Add(tt.input)
+	}
+	programs, _ := filepath.Glob("../test_programs/*.toy")
+	for _, path := range programs {
+		if source, err := os.ReadFile(path); err == nil {
+			f.Add(string(source))
+		}
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		// Syntax errors are [ERROR] panics from the lexer or the parser, any other panic is a bug
+		defer func() {
+			if r := recover(); r != nil {
+				if msg, ok := r.(string); !ok || !strings.HasPrefix(msg, "[ERROR]") {
+					t.Fatalf("Parsing %q panicked with %v", input, r)
+				}
+			}
+		}()
+		NewParser().Parse(lexer.NewLexer().Lex(input))
+	})
+}
@@ -5,75 +5,24 @@ import (
 )
 
 func (p *Parser) preProcess(tokens []token.Token) []token.Token {
-	// Handles preprocessing for compound operators
-	var toReturn []token.Token
-	for i, val := range tokens {
-		if val.TokType == token.COMPOUND_PLUS {
-			// ensure there's a left-hand token available
-			if i-1 >= 0 {
-				toReturn = append(toReturn, *token.NewToken(token.ASSIGN, "="))
-				toReturn = append(toReturn, tokens[i-1])
-				toReturn = append(toReturn, *token.NewToken(token.PLUS, "+"))
-				continue
-			}
-		}
-		if val.TokType == token.PLUS_PLUS {
-			if i-1 >= 0 {
-				toReturn = append(toReturn, *token.NewToken(token.ASSIGN, "="))
-				toReturn = append(toReturn, tokens[i-1])
-				toReturn = append(toReturn, *token.NewToken(token.PLUS, "+"))
-				toReturn = append(toReturn, *token.NewToken(token.INTEGER, "1"))
-				continue
-			}
-		}
-		if val.TokType == token.COMPOUND_MINUS {
-			if i-1 >= 0 {
-				toReturn = append(toReturn, *token.NewToken(token.ASSIGN, "="))
-				toReturn = append(toReturn, tokens[i-1])
-				toReturn = append(toReturn, *token.NewToken(token.MINUS, "-"))
-				continue
-			}
-		}
-		if val.TokType == token.MINUS_MINUS {
-			if i-1 >= 0 {
-				toReturn = append(toReturn, *token.NewToken(token.ASSIGN, "="))
-				toReturn = append(toReturn, tokens[i-1])
-				toReturn = append(toReturn, *token.NewToken(token.MINUS, "-"))
-				toReturn = append(toReturn, *token.NewToken(token.INTEGER, "1"))
-				continue
-			}
-		}
-		if val.TokType == token.COMPOUND_MULTIPLY {
-			if i-1 >= 0 {
-				toReturn = append(toReturn, *token.NewToken(token.ASSIGN, "="))
-				toReturn = append(toReturn, tokens[i-1])
-				toReturn = append(toReturn, *token.NewToken(token.MULTIPLY, "*"))
-				continue
-			}
-		}
-		if val.TokType == token.COMPOUND_DIVIDE {
-			if i-1 >= 0 {
-				toReturn = append(toReturn, *token.NewToken(token.ASSIGN, "="))
-				toReturn = append(toReturn, tokens[i-1])
-				toReturn = append(toReturn, *token.NewToken(token.DIVIDE, "/"))
-				continue
-			}
-		}
-		toReturn = append(toReturn, val)
-	}
-	//Second pass replace let y = -5; with let y = 0 - 5;;
+	// Compound operators are parsed into ast.CompoundAssignNode, so the only rewrites left are struct braces and unary minus
+	toReturn := append([]token.Token{}, tokens...)
+	markStructBraces(toReturn)
+	// A minus that doesn't follow a value is unary, let y = -5; is parsed as let y = 0 - 5;
 	for i, val := range toReturn {
-		if val.TokType == token.MINUS &&
-			i > 0 &&
-			(toReturn[i-1].TokType != token.INTEGER &&
-				toReturn[i-1].TokType != token.RPAREN &&
-				toReturn[i-1].TokType != token.VAR_REF) {
-
-			// insert 0 before the minus
-			toReturn = append(toReturn[:i],
-				append([]token.Token{*token.NewToken(token.INTEGER, "0"), val}, toReturn[i+1:]...)...)
+		if val.TokType == token.MINUS && (i == 0 || !endsOperand(toReturn[i-1].TokType)) {
+			toReturn[i].TokType = token.NEG
 		}
-
 	}
 	return toReturn
 }
+
+// Whether a token can be the last token of a value, so a minus after it subtracts
+func endsOperand(t token.TokenType) bool {
+	switch t {
+	case token.INTEGER, token.FLOAT, token.STRING, token.BOOLEAN, token.NULL, token.VAR_REF,
+		token.RPAREN, token.RBRACK, token.STRUCT_RBRACE:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package parser
+
+import (
+	"fmt"
+	"toy_lang/ast"
+	"toy_lang/token"
+)
+
+// Struct literals use braces too, so they are retyped to STRUCT_LBRACE/STRUCT_RBRACE before the program is
+// split into lines. A brace opens a literal when it follows a name and starts with "field:". An empty Name{}
+// is a literal when Name is declared in the same program or when it can't be a block (like after "=" or ",")
+func markStructBraces(toks []token.Token) {
+	structNames := make(map[string]bool)
+	for _, tok := range toks {
+		if tok.TokType == token.STRUCT_NAME {
+			structNames[tok.Literal] = true
+		}
+	}
+
+	var isLiteral []bool
+	for i := range toks {
+		switch toks[i].TokType {
+		case token.LBRACE:
+			lit := i > 0 && toks[i-1].TokType == token.VAR_REF &&
+				((i+2 < len(toks) && toks[i+1].TokType == token.VAR_REF && toks[i+2].TokType == token.COLON) ||
+					(i+1 < len(toks) && toks[i+1].TokType == token.RBRACE &&
+						(structNames[toks[i-1].Literal] || (i > 1 && isValuePosition(toks[i-2].TokType)))))
+			if lit {
+				toks[i].TokType = token.STRUCT_LBRACE
+			}
+			isLiteral = append(isLiteral, lit)
+		case token.RBRACE:
+			if len(isLiteral) == 0 {
+				continue
+			}
+			if isLiteral[len(isLiteral)-1] {
+				toks[i].TokType = token.STRUCT_RBRACE
+			}
+			isLiteral = isLiteral[:len(isLiteral)-1]
+		}
+	}
+}
+
+// Reports whether a value that follows tok can't be the condition of an if or while
+func isValuePosition(tok token.TokenType) bool {
+	switch tok {
+	case token.ASSIGN, token.COLON, token.COMMA, token.LPAREN, token.LBRACK, token.RETURN:
+		return true
+	}
+	return false
+}
+
+// Splits toks on commas that are not nested inside parens, brackets or a struct literal
+func splitArgs(toks []token.Token) [][]token.Token {
+	var args [][]token.Token
+	curr := []token.Token{}
+	depth := 0
+	for _, tk := range toks {
+		switch tk.TokType {
+		case token.LPAREN, token.LBRACK, token.STRUCT_LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.STRUCT_RBRACE:
+			depth--
+		}
+		if tk.TokType == token.COMMA && depth == 0 {
+			if len(curr) > 0 {
+				args = append(args, curr)
+				curr = []token.Token{}
+			}
+			continue
+		}
+		curr = append(curr, tk)
+	}
+	if len(curr) > 0 {
+		args = append(args, curr)
+	}
+	return args
+}
+
+// Returns the index of the token closing the group opened at toks[start]
+func findClosing(toks []token.Token, start int, open token.TokenType, close token.TokenType) int {
+	depth := 0
+	for i := start; i < len(toks); i++ {
+		if toks[i].TokType == open {
+			depth++
+		} else if toks[i].TokType == close {
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	panic(fmt.Sprintf("[ERROR] Could not find closing %v for %v, got %v\n", close, open, toks[start:]))
+}
+
+func (p *Parser) parseStructDec(toks []token.Token) *ast.StructDecNode {
+	if len(toks) < 4 || toks[1].TokType != token.STRUCT_NAME {
+		panic(fmt.Sprintf("[ERROR] Could not figure out struct name, got %v\n", toks))
+	}
+	if toks[2].TokType != token.LBRACE || toks[len(toks)-1].TokType != token.RBRACE {
+		panic(fmt.Sprintf("[ERROR] Struct body must be wrapped in braces, got %v\n", toks))
+	}
+
+	node := &ast.StructDecNode{Name: toks[1].Literal, Fields: []string{}, Methods: []ast.FuncDecNode{}}
+	seen := make(map[string]bool)
+	body := toks[3 : len(toks)-1]
+	i := 0
+	for i < len(body) {
+		switch body[i].TokType {
+		case token.COMMA, token.SEMICOLON:
+			i++
+		case token.VAR_REF:
+			if seen[body[i].Literal] {
+				panic(fmt.Sprintf("[ERROR] Struct %v declares %v twice\n", node.Name, body[i].Literal))
+			}
+			seen[body[i].Literal] = true
+			node.Fields = append(node.Fields, body[i].Literal)
+			i++
+		case token.FN:
+			_, open := includesItem(body[i:], *token.NewToken(token.LBRACE, "{"))
+			if open == -1 {
+				panic(fmt.Sprintf("[ERROR] Method in struct %v is missing a body\n", node.Name))
+			}
+			end := findClosing(body, i+open, token.LBRACE, token.RBRACE)
+			method := p.parseFuncDecStmt(body[i : end+1])
+			setSpan(method, body[i:end+1])
+			if seen[method.Name] {
+				panic(fmt.Sprintf("[ERROR] Struct %v declares %v twice\n", node.Name, method.Name))
+			}
+			seen[method.Name] = true
+			node.Methods = append(node.Methods, *method)
+			i = end + 1
+		default:
+			panic(fmt.Sprintf("[ERROR] Expected a field or method in struct %v, got %v\n", node.Name, body[i]))
+		}
+	}
+	return node
+}
+
+// Point{x: 1, y: 2}
+func (p *Parser) parseStructLiteral(toks []token.Token) *ast.StructLiteralNode {
+	node := &ast.StructLiteralNode{Name: toks[0].Literal, Fields: []ast.StructField{}}
+	for _, field := range splitArgs(toks[2 : len(toks)-1]) {
+		if len(field) < 3 || field[0].TokType != token.VAR_REF || field[1].TokType != token.COLON {
+			panic(fmt.Sprintf("[ERROR] Struct fields must be written as name: value, got %v\n", field))
+		}
+		if _, exists := node.GetField(field[0].Literal); exists {
+			panic(fmt.Sprintf("[ERROR] Field %v is set twice in %v literal\n", field[0].Literal, node.Name))
+		}
+		node.Fields = append(node.Fields, ast.StructField{
+			Name:  field[0].Literal,
+			Value: p.parseExpression(field[2:]),
+		})
+	}
+	return node
+}
+
+// Parses a struct literal or a name followed by field accesses and method calls (p.x, pts[0].x, p.sum()).
+// Returns nil when tokens[i] does not start one, otherwise the node and the index after it
+func (p *Parser) parseStructExpr(tokens []token.Token, i int) (ast.Node, int) {
+	if tokens[i].TokType != token.VAR_REF || i+1 >= len(tokens) {
+		return nil, i
+	}
+	switch tokens[i+1].TokType {
+	case token.STRUCT_LBRACE:
+		end := findClosing(tokens, i+1, token.STRUCT_LBRACE, token.STRUCT_RBRACE)
+		return p.parseFieldChain(p.parseStructLiteral(tokens[i:end+1]), tokens, end+1)
+	case token.DOT:
+		return p.parseFieldChain(&ast.ReferenceExprNode{Name: tokens[i].Literal}, tokens, i+1)
+	case token.LBRACK:
+		end := findClosing(tokens, i+1, token.LBRACK, token.RBRACK)
+		if end+1 < len(tokens) && tokens[end+1].TokType == token.DOT {
+			return p.parseFieldChain(p.parseArrRef(tokens[i:end+1]), tokens, end+1)
+		}
+	}
+	return nil, i
+}
+
+// Wraps obj in every .field and .method(args) that follows it starting at tokens[j]
+func (p *Parser) parseFieldChain(obj ast.Node, tokens []token.Token, j int) (ast.Node, int) {
+	for j < len(tokens) && tokens[j].TokType == token.DOT {
+		if j+1 >= len(tokens) || tokens[j+1].TokType != token.VAR_REF {
+			panic(fmt.Sprintf("[ERROR] Expected a field name after \".\", got %v\n", tokens[j:]))
+		}
+		name := tokens[j+1].Literal
+		if j+2 < len(tokens) && tokens[j+2].TokType == token.LPAREN {
+			end := findClosing(tokens, j+2, token.LPAREN, token.RPAREN)
+			var params []ast.Node
+			for _, arg := range splitArgs(tokens[j+3 : end]) {
+				params = append(params, p.parseExpression(arg))
+			}
+			obj = &ast.MethodCallNode{Obj: obj, Name: name, Params: params}
+			j = end + 1
+			continue
+		}
+		obj = &ast.FieldAccessNode{Obj: obj, Field: name}
+		j += 2
+	}
+	return obj, j
+}
+
+// p.x = 3, pts[0].x = 3
+func (p *Parser) parseFieldReassign(toks []token.Token, assignIdx int) *ast.FieldReassignNode {
+	target := p.parseExpression(toks[:assignIdx])
+	if empty, ok := target.(*ast.EmptyExprNode); ok {
+		target = empty.Child
+	}
+	field, ok := target.(*ast.FieldAccessNode)
+	if !ok {
+		panic(fmt.Sprintf("[ERROR] Can only assign to a field, got %v\n", target))
+	}
+	if assignIdx == len(toks)-1 {
+		panic(fmt.Sprintf("[ERROR] Missing value to assign to %v\n", field))
+	}
+	return &ast.FieldReassignNode{
+		Obj:    field.Obj,
+		Field:  field.Field,
+		NewVal: p.parseExpression(toks[assignIdx+1:]),
+	}
+}
@@ -1,30 +1,35 @@
 package parser
 
 import (
+	"toy_lang/ast"
 	"toy_lang/token"
 )
 
 func (p *Parser) generatePrecedenceTable() map[token.TokenType]int {
+	// Lower binds looser: || < && < comparisons < + - < * / % < unary - < ** < !
 	return map[token.TokenType]int{
-		token.PLUS:             1,
-		token.MINUS:            1,
-		token.MULTIPLY:         2,
-		token.DIVIDE:           2,
-		token.MODULO:           2,
-		token.EXPONENT:         3,
+		token.OR:               1,
+		token.AND:              2,
+		token.LESS_THAN:        3,
+		token.LESS_THAN_EQT:    3,
+		token.GREATER_THAN:     3,
+		token.GREATER_THAN_EQT: 3,
+		token.EQUALS:           3,
+		token.NOT_EQUAL:        3,
+		token.PLUS:             4,
+		token.MINUS:            4,
+		token.MULTIPLY:         5,
+		token.DIVIDE:           5,
+		token.MODULO:           5,
+		token.NEG:              6,
+		token.EXPONENT:         7,
+		token.NOT:              8,
 		token.BOOLEAN:          100,
 		token.INTEGER:          100, // Boolean, int, string, and var ref should never be "bound to"
 		token.STRING:           100,
 		token.VAR_REF:          100,
 		token.FLOAT:            100,
-		token.AND:              4,
-		token.OR:               4,
-		token.NOT:              5, // Logical operators have lower precedence than arithmetic, not is lowest
-		token.LESS_THAN:        4,
-		token.LESS_THAN_EQT:    4,
-		token.GREATER_THAN:     4,
-		token.GREATER_THAN_EQT: 4,
-		token.EQUALS:           4,
+		token.NULL:             100,
 	}
 }
 
@@ -72,13 +77,25 @@ func (p *Parser) findLowestBp(pt map[token.TokenType]int, tokens []token.Token)
 
 	for i, tok := range tokens {
 		switch tok.TokType {
-		case token.LPAREN:
+		case token.LPAREN, token.LBRACK, token.STRUCT_LBRACE:
 			depth++
-		case token.RPAREN:
+		case token.RPAREN, token.RBRACK, token.STRUCT_RBRACE:
 			depth--
 		default:
 			if depth == 0 {
-				if val, ok := pt[tok.TokType]; ok && val < lowestVal {
+				val, ok := pt[tok.TokType]
+				if !ok {
+					continue
+				}
+				// A prefix operator only splits the expression when it starts it, otherwise it belongs to the
+				// operand on its right
+				if (tok.TokType == token.NOT || tok.TokType == token.NEG) && i > 0 {
+					continue
+				}
+				// The last of equally low operators is split on, so a - b - c is (a - b) - c. ** and prefix
+				// operators group to the right
+				if val < lowestVal || (val == lowestVal && val < 100 && tok.TokType != token.EXPONENT &&
+					tok.TokType != token.NOT && tok.TokType != token.NEG) {
 					lowestVal = val
 					lowestTok = tok
 					lowestIndex = i
@@ -93,7 +110,7 @@ func (p *Parser) findLowestBp(pt map[token.TokenType]int, tokens []token.Token)
 
 func includesItem(arr []token.Token, tok token.Token) (bool, int) {
 	for i, val := range arr {
-		if val == tok {
+		if val.TokType == tok.TokType && val.Literal == tok.Literal {
 			return true, i
 		}
 	}
@@ -109,4 +126,52 @@ func includesAny(arr []token.Token, checkFor []token.TokenType)(bool, int){
 		}
 	}
 	return false, -1;
-}
\ No newline at end of file
+}
+
+// Like includesAny but ignores tokens nested inside parens, brackets or struct literals
+func includesAnyTopLevel(arr []token.Token, checkFor []token.TokenType) (bool, int) {
+	depth := 0
+	for i, val := range arr {
+		switch val.TokType {
+		case token.LPAREN, token.LBRACK, token.STRUCT_LBRACE:
+			depth++
+			continue
+		case token.RPAREN, token.RBRACK, token.STRUCT_RBRACE:
+			depth--
+			continue
+		}
+		if depth != 0 {
+			continue
+		}
+		for _, val2 := range checkFor {
+			if val2 == val.TokType {
+				return true, i
+			}
+		}
+	}
+	return false, -1
+}
+
+// Gives n the span of toks unless it already has one, tokens added by preProcess have no position and are skipped
+func setSpan(n ast.Node, toks []token.Token) {
+	node, ok := n.(ast.Spanned)
+	if !ok || node.NodeSpan().Start.Line != 0 {
+		return
+	}
+	node.SetSpan(tokenSpan(toks))
+}
+
+// Returns the span from the first to the last token of toks that has a position
+func tokenSpan(toks []token.Token) ast.Span {
+	var span ast.Span
+	for _, tok := range toks {
+		if tok.Pos.Line == 0 {
+			continue
+		}
+		if span.Start.Line == 0 {
+			span.Start = tok.Pos
+		}
+		span.End = tok.Pos
+	}
+	return span
+}
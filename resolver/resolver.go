@@ -0,0 +1,181 @@
+package resolver
+
+import (
+	"fmt"
+	"toy_lang/ast"
+)
+
+// Resolver checks a parsed program before it runs and reports the mistakes that can be found without
+// executing it. Anything it can't be sure about (like globals used inside a function, which depend on
+// the caller) is left to the evaluator
+type Resolver struct {
+	scopes []*scope
+	errors []error
+}
+
+type scope struct {
+	// name -> whether it was declared with const
+	names map[string]bool
+	// Names of the structs declared here
+	structs map[string]bool
+	// Function bodies can see their callers variables, so lookups stop here
+	isFunc bool
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		scopes: []*scope{},
+		errors: []error{},
+	}
+}
+
+func (r *Resolver) Resolve(program ast.ProgramNode) []error {
+	r.scopes = []*scope{{names: make(map[string]bool), structs: make(map[string]bool)}}
+	r.errors = []error{}
+	r.resolveBlock(program.Statements)
+	return r.errors
+}
+
+func (r *Resolver) push(isFunc bool) {
+	r.scopes = append(r.scopes, &scope{names: make(map[string]bool), structs: make(map[string]bool), isFunc: isFunc})
+}
+
+func (r *Resolver) pop() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+// Error is a mistake found by the resolver, Span is the statement it was found in
+type Error struct {
+	Msg  string
+	Span ast.Span
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func (r *Resolver) errorf(node ast.Node, format string, args ...any) {
+	r.errors = append(r.errors, &Error{Msg: fmt.Sprintf(format, args...), Span: ast.SpanOf(node)})
+}
+
+// Returns whether name is known to be a constant
+func (r *Resolver) isConst(name string) bool {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if isConst, ok := r.scopes[i].names[name]; ok {
+			return isConst
+		}
+		if r.scopes[i].isFunc {
+			return false
+		}
+	}
+	return false
+}
+
+func (r *Resolver) resolveBlock(stmts []ast.Node) {
+	for _, stmt := range stmts {
+		if stmt != nil {
+			r.resolveStmt(stmt)
+		}
+	}
+}
+
+func (r *Resolver) resolveStmt(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.LetStmtNode:
+		curr := r.scopes[len(r.scopes)-1]
+		if curr.names[n.Name] {
+			r.errorf(node, "[ERROR] Cannot redeclare constant %s", n.Name)
+		}
+		curr.names[n.Name] = n.Const
+	case *ast.VarReassignNode:
+		if r.isConst(n.Var.Name) {
+			r.errorf(node, "[ERROR] Cannot reassign constant %s", n.Var.Name)
+		}
+	case *ast.ArrReassignNode:
+		if r.isConst(n.Arr.Name) {
+			r.errorf(node, "[ERROR] Cannot modify elements of constant %s", n.Arr.Name)
+		}
+	case *ast.CompoundAssignNode:
+		switch target := n.Target.(type) {
+		case *ast.ReferenceExprNode:
+			if r.isConst(target.Name) {
+				r.errorf(node, "[ERROR] Cannot reassign constant %s", target.Name)
+			}
+		case *ast.ArrRefNode:
+			if r.isConst(target.Arr.Name) {
+				r.errorf(node, "[ERROR] Cannot modify elements of constant %s", target.Arr.Name)
+			}
+		case *ast.FieldAccessNode:
+			r.checkFields(node, target.Obj)
+		}
+	case *ast.FieldReassignNode:
+		r.checkFields(node, n.Obj)
+	case *ast.IfStmtNode:
+		r.push(false)
+		r.resolveBlock(n.Body)
+		r.pop()
+		r.push(false)
+		r.resolveBlock(n.Alt)
+		r.pop()
+	case *ast.WhileStmtNode:
+		r.push(false)
+		r.resolveBlock(n.Body)
+		r.pop()
+	case *ast.FuncDecNode:
+		r.resolveFunc(n, false)
+	case *ast.ImportStmtNode:
+		if len(r.scopes) > 1 {
+			r.errorf(node, "[ERROR] import is only allowed at the top level of a file")
+		}
+		r.scopes[len(r.scopes)-1].names[n.Alias] = true
+	case *ast.ExportStmtNode:
+		if len(r.scopes) > 1 {
+			r.errorf(node, "[ERROR] export is only allowed at the top level of a file")
+		}
+		r.resolveStmt(n.Stmt)
+	case *ast.StructDecNode:
+		curr := r.scopes[len(r.scopes)-1]
+		if curr.structs[n.Name] {
+			r.errorf(node, "[ERROR] Struct %s is declared twice", n.Name)
+		}
+		curr.structs[n.Name] = true
+		for j := range n.Methods {
+			r.resolveFunc(&n.Methods[j], true)
+		}
+	}
+}
+
+func (r *Resolver) resolveFunc(f *ast.FuncDecNode, isMethod bool) {
+	r.push(true)
+	for _, param := range f.Params {
+		r.scopes[len(r.scopes)-1].names[param.Name] = false
+	}
+	if isMethod {
+		r.scopes[len(r.scopes)-1].names["self"] = false
+	}
+	r.resolveBlock(f.Body)
+	r.pop()
+}
+
+// Fields can't be changed when the chain starts at a constant, like c.x = 1 or c.inner.x = 1
+func (r *Resolver) checkFields(stmt ast.Node, obj ast.Node) {
+	for {
+		switch n := obj.(type) {
+		case *ast.FieldAccessNode:
+			obj = n.Obj
+			continue
+		case *ast.EmptyExprNode:
+			obj = n.Child
+			continue
+		case *ast.ArrRefNode:
+			if r.isConst(n.Arr.Name) {
+				r.errorf(stmt, "[ERROR] Cannot modify fields of constant %s", n.Arr.Name)
+			}
+		case *ast.ReferenceExprNode:
+			if r.isConst(n.Name) {
+				r.errorf(stmt, "[ERROR] Cannot modify fields of constant %s", n.Name)
+			}
+		}
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package resolver
+
+import (
+	"fmt"
+	"testing"
+	"toy_lang/lexer"
+	"toy_lang/parser"
+)
+
+type rTest struct {
+	input  string
+	errors []string
+	id     int
+}
+
+func TestResolver(t *testing.T) {
+	tests := []rTest{
+		{
+			input:  "const x = 1; let y = x + 1; y = 3;",
+			errors: []string{},
+			id:     1,
+		},
+		{
+			input:  "const x = 1; x = 2;",
+			errors: []string{"[ERROR] Cannot reassign constant x"},
+			id:     2,
+		},
+		{
+			input:  "const x = 1; x += 2; x++;",
+			errors: []string{"[ERROR] Cannot reassign constant x", "[ERROR] Cannot reassign constant x"},
+			id:     3,
+		},
+		{
+			input:  "const arr = [1, 2]; arr[0] = 5; arr[1] *= 2;",
+			errors: []string{"[ERROR] Cannot modify elements of constant arr", "[ERROR] Cannot modify elements of constant arr"},
+			id:     4,
+		},
+		{
+			input:  "const x = 1; if true{x = 2;} while false{x--;}",
+			errors: []string{"[ERROR] Cannot reassign constant x", "[ERROR] Cannot reassign constant x"},
+			id:     5,
+		},
+		{
+			input:  "const x = 1; if true{let x = 2; x = 3;}",
+			errors: []string{},
+			id:     6,
+		},
+		{
+			input:  "const x = 1; let x = 2;",
+			errors: []string{"[ERROR] Cannot redeclare constant x"},
+			id:     7,
+		},
+		{
+			// Functions see their callers variables, so only their own constants are checked here
+			input:  "const x = 1; fn f(x){x = 2; const y = 3; y = 4;}",
+			errors: []string{"[ERROR] Cannot reassign constant y"},
+			id:     8,
+		},
+		{
+			input:  "struct P { x fn set(v){ self.x = v; } } const p = P{x: 1}; p.x = 2; p.x += 1; let q = P{x: 1}; q.x = 2;",
+			errors: []string{"[ERROR] Cannot modify fields of constant p", "[ERROR] Cannot modify fields of constant p"},
+			id:     9,
+		},
+		{
+			input:  "import \"m.toy\" as m; m = 1; if true { import \"n.toy\" as n; } fn f(){ export const x = 1; }",
+			errors: []string{"[ERROR] Cannot reassign constant m", "[ERROR] import is only allowed at the top level of a file", "[ERROR] export is only allowed at the top level of a file"},
+			id:     10,
+		},
+		{
+			input:  "struct P { x } struct P { y } struct Q { x } if true { struct Q { y } }",
+			errors: []string{"[ERROR] Struct P is declared twice"},
+			id:     11,
+		},
+	}
+
+	for _, tt := range tests {
+		lex := lexer.NewLexer()
+		parse := parser.NewParser()
+		errs := NewResolver().Resolve(parse.Parse(lex.Lex(tt.input)))
+
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.errors) {
+			t.Errorf("\033[31m[FAILURE] Test number %d has failed\033[0m\n%v\nGot:  %q\nWant: %q\n", tt.id, tt.input, got, tt.errors)
+		} else {
+			fmt.Printf("\033[32m[PASS] Test number %d has passed\033[0m\n", tt.id)
+		}
+	}
+}
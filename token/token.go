@@ -1,5 +1,10 @@
 package token
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type TokenType int
 
 const (
@@ -24,10 +29,15 @@ const (
 	COMMA
 	LBRACK
 	RBRACK
+	DOT
+	COLON
+	STRUCT_LBRACE
+	STRUCT_RBRACE
 	//User names
 	VAR_REF
 	VAR_NAME
 	FUNC_NAME
+	STRUCT_NAME
 
 	//Keywords
 	LET
@@ -38,6 +48,11 @@ const (
 	WHILE
 	BREAK
 	CONTINUE
+	CONST
+	STRUCT
+	IMPORT
+	EXPORT
+	AS
 
 	//Compound operators
 	COMPOUND_PLUS
@@ -46,12 +61,15 @@ const (
 	COMPOUND_DIVIDE
 	PLUS_PLUS
 	MINUS_MINUS
+	COMPOUND_MODULO
+	COMPOUND_EXPONENT
 
 	//Datatypes
 	INTEGER
 	BOOLEAN
 	STRING
 	FLOAT
+	NULL
 
 	//Boolean operators
 	LESS_THAN
@@ -63,6 +81,8 @@ const (
 	AND
 	OR
 	NOT
+	// Unary minus, the parser marks a MINUS with nothing to subtract from as one
+	NEG
 
 	//Placeholder
 	EMPTY
@@ -104,6 +124,10 @@ func (t TokenType) String() string {
 		return "PLUS_PLUS"
 	case MINUS_MINUS:
 		return "MINUS_MINUS"
+	case COMPOUND_MODULO:
+		return "COMPOUND_MODULO"
+	case COMPOUND_EXPONENT:
+		return "COMPOUND_EXPONENT"
 	case BOOLEAN:
 		return "BOOLEAN"
 	case LESS_THAN:
@@ -122,6 +146,8 @@ func (t TokenType) String() string {
 		return "||"
 	case NOT:
 		return "!"
+	case NEG:
+		return "NEG"
 	case IF:
 		return "IF"
 	case LBRACE:
@@ -154,24 +180,105 @@ func (t TokenType) String() string {
 		return "BREAK"
 	case CONTINUE:
 		return "CONTINUE"
+	case CONST:
+		return "CONST"
 	case MODULO:
 		return "MODULO"
 	case EXPONENT:
 		return "EXPONENT"
 	case FLOAT:
 		return "FLOAT"
+	case NULL:
+		return "NULL"
 	case LBRACK:
 		return "LBRACK"
 	case RBRACK:
 		return "RBRACK"
+	case DOT:
+		return "DOT"
+	case COLON:
+		return "COLON"
+	case STRUCT_LBRACE:
+		return "STRUCT_LBRACE"
+	case STRUCT_RBRACE:
+		return "STRUCT_RBRACE"
+	case STRUCT_NAME:
+		return "STRUCT_NAME"
+	case STRUCT:
+		return "STRUCT"
+	case IMPORT:
+		return "IMPORT"
+	case EXPORT:
+		return "EXPORT"
+	case AS:
+		return "AS"
 	default:
 		return "UNKNOWN"
 	}
 }
 
+// Position is where a token starts in the source, lines and columns count from 1 and the zero value means unknown
+type Position struct {
+	Line int `json:"line"`
+	Col  int `json:"col"`
+}
+
+// Before reports whether p comes earlier in the source than other
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || (p.Line == other.Line && p.Col < other.Col)
+}
+
+// Token types are written to JSON by name, like "LET" or "+"
+func (t TokenType) MarshalJSON() ([]byte, error) {
+	if t.String() == "UNKNOWN" {
+		return nil, fmt.Errorf("[ERROR] Token type %d has no name", int(t))
+	}
+	return json.Marshal(t.String())
+}
+
+func (t *TokenType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for tt := ILLEGAL; tt <= EMPTY; tt++ {
+		if tt.String() == name {
+			*t = tt
+			return nil
+		}
+	}
+	return fmt.Errorf("[ERROR] Unknown token type %q", name)
+}
+
 type Token struct {
-	TokType TokenType
-	Literal string
+	TokType TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Pos     Position  `json:"pos"`
+	// Comments are trivia, the parser ignores them. A comment goes on the end of the token before it on the same
+	// line, otherwise on the front of the token after it
+	Leading  []Comment `json:"leading,omitempty"`
+	Trailing []Comment `json:"trailing,omitempty"`
+}
+
+// Prints like the struct did before tokens had positions, parser errors include tokens
+func (t Token) String() string {
+	return fmt.Sprintf("{%v %v}", t.TokType, t.Literal)
+}
+
+// Comment is the text of a /* */ or // comment, including the delimiters
+type Comment struct {
+	Text string   `json:"text"`
+	Pos  Position `json:"pos"`
+}
+
+// Comments returns the trivia of toks in source order
+func Comments(toks []Token) []Comment {
+	var comments []Comment
+	for _, tok := range toks {
+		comments = append(comments, tok.Leading...)
+		comments = append(comments, tok.Trailing...)
+	}
+	return comments
 }
 
 func NewToken(tokType TokenType, literal string) *Token {